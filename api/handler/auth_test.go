@@ -0,0 +1,107 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/auth"
+	"github.com/bayugyug/building-custom-api/tools"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// whoami replies the caller of the request context
+type whoami struct{}
+
+func (whoami) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(auth.PrincipalFrom(r.Context()))
+}
+
+var _ = Describe("REST Building API Service::AUTH", func() {
+
+	var service *routes.APIService
+	var out *bytes.Buffer
+
+	BeforeEach(func() {
+		keys, err := auth.NewAPIKeys(auth.APIKey{Name: "ci", Hash: auth.HashAPIKey("ci-key"), Roles: []string{"editor"}})
+		if err != nil {
+			Fail(err.Error())
+		}
+		out = new(bytes.Buffer)
+		service, _ = routes.NewAPIService(
+			routes.WithSvcOptAddress(":8989"),
+			routes.WithSvcOptLogger(tools.NewLogger(tools.WithLoggerOptOutput(out))),
+			routes.WithSvcOptAuth(auth.Chain{keys}),
+			routes.WithSvcOptPublic("/v1/docs"),
+		)
+	})
+
+	Context("Protected end-points", func() {
+
+		It("should reply 401 problem without credentials", func() {
+			w, body := testReq(service.Mux, "GET", "/v1/api/building", nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			Expect(w.Header().Get("Content-Type")).To(HavePrefix(handler.ContentTypeProblem))
+			Expect(w.Header().Get("WWW-Authenticate")).To(ContainSubstring("Bearer"))
+			var problem handler.Problem
+			Expect(json.Unmarshal(body, &problem)).To(Succeed())
+			Expect(problem.Code).To(Equal(handler.CodeUnauthorized))
+			By("Missing ok")
+		})
+
+		It("should reply 401 problem on a wrong key or token", func() {
+			w, _ := testReqWithHeaders(service.Mux, "DELETE", "/v1/api/building/abc", nil,
+				map[string]string{auth.APIKeyHeader: "wrong"})
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+
+			w, _ = testReqWithHeaders(service.Mux, "GET", "/v1/api/building", nil,
+				map[string]string{"Authorization": "Bearer a.b.c"})
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			By("Wrong ok")
+		})
+
+		It("should pass the caller on to the handlers and logs", func() {
+			w, _ := testReqWithHeaders(service.Mux, "GET", "/v1/api/building/unknown", nil,
+				map[string]string{auth.APIKeyHeader: "ci-key"})
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+			Expect(out.String()).To(ContainSubstring(`"principal":"ci"`))
+
+			service.Mux.With(service.Authenticate).Handle("/whoami", whoami{})
+			w, body := testReqWithHeaders(service.Mux, "GET", "/whoami", nil,
+				map[string]string{"Authorization": "ApiKey ci-key"})
+			Expect(w.Code).To(Equal(http.StatusOK))
+			var p auth.Principal
+			Expect(json.Unmarshal(body, &p)).To(Succeed())
+			Expect(p.Subject).To(Equal("ci"))
+			Expect(p.Roles).To(Equal([]string{"editor"}))
+			By("Principal ok")
+		})
+	})
+
+	Context("Public end-points", func() {
+
+		It("should keep the welcome, health and configured paths open", func() {
+			for _, path := range []string{"/", "/v1/api/health", "/v1/api/health/live", "/v1/api/health/ready", "/metrics", "/v1/docs"} {
+				w, _ := testReq(service.Mux, "GET", path, nil)
+				Expect(w.Code).NotTo(Equal(http.StatusUnauthorized), path)
+			}
+			w, _ := testReq(service.Mux, "GET", "/v1/openapi.json", nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			By("Public ok")
+		})
+
+		It("should be open when no authenticator is set", func() {
+			open, _ := routes.NewAPIService(
+				routes.WithSvcOptAddress(":8989"),
+				routes.WithSvcOptLogger(tools.NewLogger(tools.WithLoggerOptOutput(out))),
+			)
+			w, _ := testReq(open.Mux, "GET", "/v1/api/building/unknown", nil)
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+			By("Open ok")
+		})
+	})
+})
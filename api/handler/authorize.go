@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/auth"
+	"github.com/bayugyug/building-custom-api/models"
+
+	"github.com/go-chi/chi"
+)
+
+// Authorized the building end-points behind the role policy, each check runs before the wrapped handler
+type Authorized struct {
+	*Building
+	Policy *auth.Policy
+}
+
+var (
+	_ BuildingEndpoints = (*Authorized)(nil)
+	_ FloorEndpoints    = (*Authorized)(nil)
+	_ RoomEndpoints     = (*Authorized)(nil)
+	_ BulkEndpoints     = (*Authorized)(nil)
+	_ ChangeEndpoints   = (*Authorized)(nil)
+)
+
+// NewAuthorized new instance
+func NewAuthorized(b *Building, policy *auth.Policy) *Authorized {
+	return &Authorized{
+		Building: b,
+		Policy:   policy,
+	}
+}
+
+// Create needs create
+func (a *Authorized) Create(w http.ResponseWriter, r *http.Request) {
+	if a.allow(w, r, nil, auth.ActionCreate) {
+		a.Building.Create(w, r)
+	}
+}
+
+// Update needs update on the building, manage too when the managers are given
+func (a *Authorized) Update(w http.ResponseWriter, r *http.Request) {
+	body, ok := a.peekBody(w, r)
+	if !ok {
+		return
+	}
+	var ref struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(body, &ref)
+	if a.allow(w, r, a.building(ref.ID), updateActions(body)...) {
+		a.Building.Update(w, r)
+	}
+}
+
+// Patch needs update on the building, manage too when the patch touches the managers
+func (a *Authorized) Patch(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxPatchBody)
+	body, ok := a.peekBody(w, r)
+	if !ok {
+		return
+	}
+	pid := strings.TrimSpace(chi.URLParam(r, "id"))
+	if pid == "" {
+		//legacy PATCH /building carries the id in the body
+		var ref struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal(body, &ref)
+		pid = strings.TrimSpace(ref.ID)
+	}
+	if a.allow(w, r, a.building(pid), updateActions(body)...) {
+		a.Building.Patch(w, r)
+	}
+}
+
+// GetAll needs read
+func (a *Authorized) GetAll(w http.ResponseWriter, r *http.Request) {
+	if a.allow(w, r, nil, auth.ActionRead) {
+		a.Building.GetAll(w, r)
+	}
+}
+
+// GetOne needs read
+func (a *Authorized) GetOne(w http.ResponseWriter, r *http.Request) {
+	if a.allow(w, r, nil, auth.ActionRead) {
+		a.Building.GetOne(w, r)
+	}
+}
+
+// Changes needs read
+func (a *Authorized) Changes(w http.ResponseWriter, r *http.Request) {
+	if a.allow(w, r, nil, auth.ActionRead) {
+		a.Building.Changes(w, r)
+	}
+}
+
+// Delete needs delete
+func (a *Authorized) Delete(w http.ResponseWriter, r *http.Request) {
+	if a.allow(w, r, a.building(chi.URLParam(r, "id")), auth.ActionDelete) {
+		a.Building.Delete(w, r)
+	}
+}
+
+// CreateFloor needs update on the building
+func (a *Authorized) CreateFloor(w http.ResponseWriter, r *http.Request) {
+	if a.allowUpdate(w, r) {
+		a.Building.CreateFloor(w, r)
+	}
+}
+
+// UpdateFloor needs update on the building
+func (a *Authorized) UpdateFloor(w http.ResponseWriter, r *http.Request) {
+	if a.allowUpdate(w, r) {
+		a.Building.UpdateFloor(w, r)
+	}
+}
+
+// GetFloors needs read
+func (a *Authorized) GetFloors(w http.ResponseWriter, r *http.Request) {
+	if a.allow(w, r, nil, auth.ActionRead) {
+		a.Building.GetFloors(w, r)
+	}
+}
+
+// GetFloor needs read
+func (a *Authorized) GetFloor(w http.ResponseWriter, r *http.Request) {
+	if a.allow(w, r, nil, auth.ActionRead) {
+		a.Building.GetFloor(w, r)
+	}
+}
+
+// DeleteFloor needs update on the building
+func (a *Authorized) DeleteFloor(w http.ResponseWriter, r *http.Request) {
+	if a.allowUpdate(w, r) {
+		a.Building.DeleteFloor(w, r)
+	}
+}
+
+// CreateRoom needs update on the building
+func (a *Authorized) CreateRoom(w http.ResponseWriter, r *http.Request) {
+	if a.allowUpdate(w, r) {
+		a.Building.CreateRoom(w, r)
+	}
+}
+
+// UpdateRoom needs update on the building
+func (a *Authorized) UpdateRoom(w http.ResponseWriter, r *http.Request) {
+	if a.allowUpdate(w, r) {
+		a.Building.UpdateRoom(w, r)
+	}
+}
+
+// GetRooms needs read
+func (a *Authorized) GetRooms(w http.ResponseWriter, r *http.Request) {
+	if a.allow(w, r, nil, auth.ActionRead) {
+		a.Building.GetRooms(w, r)
+	}
+}
+
+// GetRoom needs read
+func (a *Authorized) GetRoom(w http.ResponseWriter, r *http.Request) {
+	if a.allow(w, r, nil, auth.ActionRead) {
+		a.Building.GetRoom(w, r)
+	}
+}
+
+// DeleteRoom needs update on the building
+func (a *Authorized) DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	if a.allowUpdate(w, r) {
+		a.Building.DeleteRoom(w, r)
+	}
+}
+
+// Bulk each item needs what its single row end-point needs, 1 denied item denies the whole request
+func (a *Authorized) Bulk(w http.ResponseWriter, r *http.Request) {
+	body, ok := a.peekBody(w, r)
+	if !ok {
+		return
+	}
+	data := models.NewBuildingBulk()
+	if err := data.Decode(body); err != nil {
+		//the bulk handler gives the 400
+		a.Building.Bulk(w, r)
+		return
+	}
+	who := auth.PrincipalFrom(r.Context())
+	for i, item := range data.Items {
+		var res auth.Owned
+		actions := []string{auth.ActionCreate}
+		switch item.Op {
+		case models.BulkOpUpdate:
+			res = a.building(item.ID)
+			actions = []string{auth.ActionUpdate}
+			if item.Managers != nil {
+				actions = append(actions, auth.ActionManage)
+			}
+		case models.BulkOpDelete:
+			res = a.building(item.ID)
+			actions = []string{auth.ActionDelete}
+		}
+		for _, action := range actions {
+			if err := a.Policy.Authorize(who, action, res); err != nil {
+				p := ProblemFrom(err)
+				p.Detail = fmt.Sprintf("item %d: %s not allowed", i, item.Op)
+				a.ReplyProblem(w, r, p)
+				return
+			}
+		}
+	}
+	a.Building.Bulk(w, r)
+}
+
+// allow check each action on the resource, the problem is replied on the 1st denied
+func (a *Authorized) allow(w http.ResponseWriter, r *http.Request, res auth.Owned, actions ...string) bool {
+	who := auth.PrincipalFrom(r.Context())
+	for _, action := range actions {
+		if err := a.Policy.Authorize(who, action, res); err != nil {
+			a.ReplyErr(w, r, err)
+			return false
+		}
+	}
+	return true
+}
+
+// allowUpdate update on the building of the url
+func (a *Authorized) allowUpdate(w http.ResponseWriter, r *http.Request) bool {
+	return a.allow(w, r, a.building(chi.URLParam(r, "id")), auth.ActionUpdate)
+}
+
+// building the stored row, nil when there is none so the wrapped handler gives its own error
+func (a *Authorized) building(id string) auth.Owned {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil
+	}
+	row, err := models.NewBuildingGetOne(id).Get(a.Storage)
+	if err != nil {
+		return nil
+	}
+	return row
+}
+
+// peekBody read the body and put it back for the wrapped handler
+func (a *Authorized) peekBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		//400, 413 past the limit
+		a.ReplyProblem(w, r, readProblem(err))
+		return nil, false
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// updateActions update, and manage when the body sets the managers:
+// a "managers" member, or a json patch op on /managers or the whole document
+func updateActions(body []byte) []string {
+	actions := []string{auth.ActionUpdate}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return actions
+	}
+	switch val := doc.(type) {
+	case map[string]interface{}:
+		if _, ok := val["managers"]; ok {
+			return append(actions, auth.ActionManage)
+		}
+	case []interface{}:
+		for _, op := range val {
+			m, _ := op.(map[string]interface{})
+			for _, key := range []string{"path", "from"} {
+				path, ok := m[key].(string)
+				if ok && (path == "" || path == "/managers" || strings.HasPrefix(path, "/managers/")) {
+					return append(actions, auth.ActionManage)
+				}
+			}
+		}
+	}
+	return actions
+}
+
+// callerOf subject of the caller, empty when anonymous
+func callerOf(r *http.Request) string {
+	if p := auth.PrincipalFrom(r.Context()); p != nil {
+		return p.Subject
+	}
+	return ""
+}
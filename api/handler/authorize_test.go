@@ -0,0 +1,161 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/auth"
+	"github.com/bayugyug/building-custom-api/models"
+	"github.com/bayugyug/building-custom-api/tools"
+
+	"github.com/icrowley/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::AUTHORIZE", func() {
+
+	var service *routes.APIService
+
+	BeforeEach(func() {
+		var keys []auth.APIKey
+		for name, role := range map[string]string{
+			"viewer": "viewer", "bob": "viewer", "alice": "editor", "carol": "editor", "root": "admin",
+		} {
+			keys = append(keys, auth.APIKey{Name: name, Hash: auth.HashAPIKey(name + "-key"), Roles: []string{role}})
+		}
+		authn, err := auth.NewAPIKeys(keys...)
+		if err != nil {
+			Fail(err.Error())
+		}
+		policy, err := auth.NewPolicy(auth.WithPolicyOptOwnership(true))
+		if err != nil {
+			Fail(err.Error())
+		}
+		service, _ = routes.NewAPIService(
+			routes.WithSvcOptAddress(":8989"),
+			routes.WithSvcOptLogger(tools.NewLogger(tools.WithLoggerOptOutput(ioutil.Discard))),
+			routes.WithSvcOptAuth(authn),
+			routes.WithSvcOptPolicy(policy),
+		)
+	})
+
+	as := func(who, method, path, body string, headers ...string) (int, []byte) {
+		h := map[string]string{auth.APIKeyHeader: who + "-key"}
+		for i := 0; i+1 < len(headers); i += 2 {
+			h[headers[i]] = headers[i+1]
+		}
+		w, reply := testReqWithHeaders(service.Mux, method, path, bytes.NewReader([]byte(body)), h)
+		return w.Code, reply
+	}
+
+	create := func(who, managers string) string {
+		code, body := as(who, "POST", "/v1/api/building",
+			fmt.Sprintf(`{"name":"building-%s","address":"address here","managers":%s}`, fake.DigitsN(8), managers))
+		Expect(code).To(Equal(http.StatusCreated))
+		var response handler.Response
+		Expect(json.Unmarshal(body, &response)).To(Succeed())
+		return response.Result.(string)
+	}
+
+	expectForbidden := func(code int, body []byte) {
+		Expect(code).To(Equal(http.StatusForbidden))
+		var problem handler.Problem
+		Expect(json.Unmarshal(body, &problem)).To(Succeed())
+		Expect(problem.Code).To(Equal(handler.CodeForbidden))
+	}
+
+	Context("Roles", func() {
+
+		It("should let viewers only read", func() {
+			pid := create("alice", "null")
+			code, _ := as("viewer", "GET", "/v1/api/building/"+pid, "")
+			Expect(code).To(Equal(http.StatusOK))
+			code, _ = as("viewer", "GET", "/v1/api/building/"+pid+"/floors", "")
+			Expect(code).NotTo(Equal(http.StatusForbidden))
+
+			expectForbidden(as("viewer", "POST", "/v1/api/building", `{"name":"nope"}`))
+			expectForbidden(as("viewer", "PUT", "/v1/api/building", fmt.Sprintf(`{"id":"%s","name":"nope"}`, pid)))
+			expectForbidden(as("viewer", "POST", "/v1/api/building/"+pid+"/floors", `{"level":1,"label":"L1"}`))
+			expectForbidden(as("viewer", "DELETE", "/v1/api/building/"+pid, ""))
+			By("Viewer ok")
+		})
+
+		It("should let only admins delete", func() {
+			pid := create("alice", "null")
+			expectForbidden(as("alice", "DELETE", "/v1/api/building/"+pid, ""))
+			code, _ := as("root", "DELETE", "/v1/api/building/"+pid, "")
+			Expect(code).To(Equal(http.StatusOK))
+			By("Delete ok")
+		})
+
+		It("should check each bulk item", func() {
+			pid := create("alice", "null")
+			code, body := as("alice", "POST", "/v1/api/building/_bulk",
+				fmt.Sprintf(`[{"op":"create","name":"building-%s"},{"op":"delete","id":"%s"}]`, fake.DigitsN(8), pid))
+			expectForbidden(code, body)
+			Expect(string(body)).To(ContainSubstring("item 1"))
+
+			code, _ = as("root", "GET", "/v1/api/building/"+pid, "")
+			Expect(code).To(Equal(http.StatusOK))
+			By("Bulk ok")
+		})
+	})
+
+	Context("Ownership", func() {
+
+		It("should record the creator and managers", func() {
+			pid := create("alice", `["bob"," bob ",""]`)
+			code, body := as("viewer", "GET", "/v1/api/building/"+pid, "")
+			Expect(code).To(Equal(http.StatusOK))
+			var response struct {
+				Result models.BuildingData `json:"result"`
+			}
+			Expect(json.Unmarshal(body, &response)).To(Succeed())
+			Expect(response.Result.Owner).To(Equal("alice"))
+			Expect(response.Result.Managers).To(Equal([]string{"bob"}))
+			By("Owner ok")
+		})
+
+		It("should let the owner and managers edit, not the other editors", func() {
+			pid := create("alice", `["bob"]`)
+			merge := []string{"Content-Type", models.ContentTypeMergePatch}
+
+			expectForbidden(as("carol", "PATCH", "/v1/api/building/"+pid, `{"address":"carol was here"}`, merge...))
+			expectForbidden(as("carol", "POST", "/v1/api/building/"+pid+"/floors", `{"level":1,"label":"L1"}`))
+
+			code, _ := as("bob", "PATCH", "/v1/api/building/"+pid, `{"address":"bob was here"}`, merge...)
+			Expect(code).To(Equal(http.StatusOK))
+			code, _ = as("alice", "POST", "/v1/api/building/"+pid+"/floors", `{"level":1,"label":"L1"}`)
+			Expect(code).To(Equal(http.StatusCreated))
+			code, _ = as("bob", "PATCH", "/v1/api/building/"+pid, `{"address":"`+strings.Repeat("x", handler.MaxPatchBody)+`"}`, merge...)
+			Expect(code).To(Equal(http.StatusRequestEntityTooLarge))
+			By("Edit ok")
+		})
+
+		It("should let only the owner change the managers", func() {
+			pid := create("alice", `["bob"]`)
+			merge := []string{"Content-Type", models.ContentTypeMergePatch}
+			jsonPatch := []string{"Content-Type", models.ContentTypeJSONPatch}
+
+			expectForbidden(as("bob", "PATCH", "/v1/api/building/"+pid, `{"managers":["bob","carol"]}`, merge...))
+			expectForbidden(as("bob", "PATCH", "/v1/api/building/"+pid,
+				`[{"op":"add","path":"/managers/-","value":"carol"}]`, jsonPatch...))
+
+			code, _ := as("alice", "PATCH", "/v1/api/building/"+pid, `{"managers":["carol"]}`, merge...)
+			Expect(code).To(Equal(http.StatusOK))
+			code, _ = as("carol", "PATCH", "/v1/api/building/"+pid, `{"address":"carol now"}`, merge...)
+			Expect(code).To(Equal(http.StatusOK))
+
+			code, _ = as("alice", "PATCH", "/v1/api/building/"+pid, `{"owner":"carol"}`, merge...)
+			Expect(code).To(Equal(http.StatusBadRequest))
+			By("Manage ok")
+		})
+	})
+})
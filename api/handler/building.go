@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"strings"
 	"time"
@@ -8,15 +10,20 @@ import (
 	"github.com/bayugyug/building-custom-api/configs"
 	"github.com/bayugyug/building-custom-api/drivers"
 	"github.com/bayugyug/building-custom-api/models"
+	"github.com/bayugyug/building-custom-api/tools"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
 )
 
+// MaxPatchBody max bytes of a patch document
+const MaxPatchBody = 1 << 20
+
 // BuildingEndpoints the end-points-url mapping
 type BuildingEndpoints interface {
 	Create(w http.ResponseWriter, r *http.Request)
 	Update(w http.ResponseWriter, r *http.Request)
+	Patch(w http.ResponseWriter, r *http.Request)
 	GetAll(w http.ResponseWriter, r *http.Request)
 	GetOne(w http.ResponseWriter, r *http.Request)
 	Delete(w http.ResponseWriter, r *http.Request)
@@ -24,14 +31,15 @@ type BuildingEndpoints interface {
 
 // Response is the reply object
 type Response struct {
-	Status string      `json:"status"`
-	Result interface{} `json:"result,omitempty"`
-	Total  int         `json:"total,omitempty"`
+	Status     string      `json:"status"`
+	Result     interface{} `json:"result,omitempty"`
+	Total      int         `json:"total,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 // Building the api handler
 type Building struct {
-	Storage *drivers.Storage
+	Storage drivers.StorageDriver
 }
 
 // NewBuilding new instance
@@ -55,25 +63,17 @@ func (b *Building) Create(w http.ResponseWriter, r *http.Request) {
 	//sanity check
 	if err := render.Bind(r, data); err != nil {
 		//400
-		b.ReplyErrContent(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		b.ReplyBindErr(w, r, err)
 		return
 	}
+	data.Owner = callerOf(r)
 	pid, err := data.Create(b.Storage)
 	//chk
 	if err != nil {
-		switch err {
-		case models.ErrRecordExists:
-			//409
-			b.ReplyErrContent(w, r, http.StatusConflict, err.Error())
-		case models.ErrMissingRequiredParameters:
-			//400
-			b.ReplyErrContent(w, r, http.StatusBadRequest, err.Error())
-		default:
-			//500
-			b.ReplyErrContent(w, r, http.StatusInternalServerError, err.Error())
-		}
+		b.ReplyErr(w, r, err)
 		return
 	}
+	tools.SetLogField(r.Context(), "building_id", pid)
 	//good
 	render.Status(r, http.StatusCreated)
 	render.JSON(w, r, Response{
@@ -88,49 +88,79 @@ func (b *Building) Update(w http.ResponseWriter, r *http.Request) {
 	//sanity check
 	if err := render.Bind(r, data); err != nil {
 		//400
-		b.ReplyErrContent(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		b.ReplyBindErr(w, r, err)
 		return
 	}
+	data.IfMatch = r.Header.Get("If-Match")
+	tools.SetLogField(r.Context(), "building_id", data.ID)
 	//check
 	if err := data.Update(b.Storage); err != nil {
-		switch err {
-		case models.ErrRecordMismatch:
-			//409
-			b.ReplyErrContent(w, r, http.StatusConflict, err.Error())
-		case models.ErrMissingRequiredParameters:
-			//400
-			b.ReplyErrContent(w, r, http.StatusBadRequest, err.Error())
-		case models.ErrRecordNotFound:
-			//204 or 404?
-			b.ReplyErrContent(w, r, http.StatusNotFound, err.Error())
-		default:
-			//500
-			b.ReplyErrContent(w, r, http.StatusInternalServerError, err.Error())
+		b.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+	})
+}
+
+// Patch partial update of a row via merge patch or json patch
+func (b *Building) Patch(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxPatchBody))
+	if err != nil {
+		//400, 413 past the limit
+		b.ReplyProblem(w, r, readProblem(err))
+		return
+	}
+	pid := strings.TrimSpace(chi.URLParam(r, "id"))
+	if pid == "" {
+		//legacy PATCH /building carries the id in the body
+		var legacy struct {
+			ID string `json:"id"`
 		}
+		json.Unmarshal(body, &legacy)
+		pid = strings.TrimSpace(legacy.ID)
+	}
+	tools.SetLogField(r.Context(), "building_id", pid)
+	data := models.NewBuildingPatch(pid, r.Header.Get("Content-Type"), body)
+	data.IfMatch = r.Header.Get("If-Match")
+	//check
+	row, err := data.Patch(b.Storage)
+	if err != nil {
+		//400 when the patched building breaks the rules, same as create and update
+		b.ReplyErr(w, r, err)
 		return
 	}
 	//good
+	w.Header().Set("ETag", row.ETag())
 	render.JSON(w, r, Response{
 		Status: "success",
+		Result: row,
 	})
 }
 
-// GetAll list all
+// GetAll list all, filtered, sorted and paginated by the query string
 func (b *Building) GetAll(w http.ResponseWriter, r *http.Request) {
-	data := &models.BuildingGetParams{}
+	data := models.NewBuildingList()
+	//sanity check
+	if err := data.ParseQuery(r.URL.Query()); err != nil {
+		//400
+		b.ReplyErr(w, r, err)
+		return
+	}
 	//check
-	rows, err := data.GetAll(b.Storage)
+	rows, next, total, err := data.List(b.Storage)
 	//chk
 	if err != nil {
-		//404
-		b.ReplyErrContent(w, r, http.StatusNotFound, err.Error())
+		b.ReplyErr(w, r, err)
 		return
 	}
 	//good
 	render.JSON(w, r, Response{
-		Status: "success",
-		Result: rows,
-		Total:  len(rows),
+		Status:     "success",
+		Result:     rows,
+		Total:      total,
+		NextCursor: next,
 	})
 }
 
@@ -140,21 +170,26 @@ func (b *Building) GetOne(w http.ResponseWriter, r *http.Request) {
 	//chk
 	if data.ID == "" {
 		//400
-		b.ReplyErrContent(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		b.ReplyErr(w, r, models.ErrMissingRequiredParameters)
 		return
 	}
 	//check
 	row, err := data.Get(b.Storage)
 	//chk
 	if err != nil {
-		//404
-		b.ReplyErrContent(w, r, http.StatusNotFound, err.Error())
+		b.ReplyErr(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", row.ETag())
+	if match := r.Header.Get("If-None-Match"); match != "" && row.MatchETag(match) {
+		//304
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 	//good
 	render.JSON(w, r, Response{
 		Status: "success",
-		Result: row,
+		Result: row.Summary(),
 	})
 }
 
@@ -164,19 +199,13 @@ func (b *Building) Delete(w http.ResponseWriter, r *http.Request) {
 	//chk
 	if data.ID == "" {
 		//400
-		b.ReplyErrContent(w, r, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		b.ReplyErr(w, r, models.ErrMissingRequiredParameters)
 		return
 	}
+	data.IfMatch = r.Header.Get("If-Match")
 	//chk
 	if err := data.Delete(b.Storage); err != nil {
-		switch err {
-		case models.ErrRecordNotFound:
-			//404
-			b.ReplyErrContent(w, r, http.StatusNotFound, err.Error())
-		default:
-			//500
-			b.ReplyErrContent(w, r, http.StatusInternalServerError, err.Error())
-		}
+		b.ReplyErr(w, r, err)
 		return
 	}
 	//good
@@ -185,14 +214,6 @@ func (b *Building) Delete(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// ReplyErrContent send err-code/err-msg
-func (b *Building) ReplyErrContent(w http.ResponseWriter, r *http.Request, code int, msg string) {
-	render.Status(r, code)
-	render.JSON(w, r, Response{
-		Status: msg,
-	})
-}
-
 // HealthCheck index page
 func (b *Building) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	info := struct {
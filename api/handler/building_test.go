@@ -8,9 +8,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 
 	"github.com/bayugyug/building-custom-api/api/handler"
 	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/models"
 	"github.com/bayugyug/building-custom-api/tools"
 
 	"github.com/go-chi/chi"
@@ -32,6 +34,7 @@ var _ = Describe("REST Building API Service::HANDLERS", func() {
 		router = chi.NewRouter()
 		router.Post("/v1/api/building", service.Building.Create)
 		router.Put("/v1/api/building", service.Building.Update)
+		router.Patch("/v1/api/building/{id}", service.Building.Patch)
 		router.Get("/v1/api/building", service.Building.GetAll)
 		router.Get("/v1/api/building/{id}", service.Building.GetOne)
 		router.Delete("/v1/api/building/{id}", service.Building.Delete)
@@ -112,6 +115,47 @@ var _ = Describe("REST Building API Service::HANDLERS", func() {
 			})
 		})
 
+		Context("Get records page by page", func() {
+			It("should return the next cursor", func() {
+				prefix := fmt.Sprintf("page-%s", fake.DigitsN(8))
+				for i := 0; i < 3; i++ {
+					formdata = tools.Seeder{}.CreateWithName(fmt.Sprintf("%s-%d", prefix, i))
+					w, _ := testReq(router, "POST", "/v1/api/building",
+						bytes.NewReader([]byte(formdata)))
+					Expect(w.Code).To(Equal(http.StatusCreated))
+				}
+				w, body := testReq(router, "GET", "/v1/api/building?sort=name&limit=2&name_prefix="+prefix, nil)
+				var response handler.Response
+				if err := json.Unmarshal(body, &response); err != nil {
+					Fail(err.Error())
+				}
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(response.Total).To(Equal(3))
+				Expect(response.NextCursor).NotTo(BeEmpty())
+				By("First page ok")
+
+				w2, body2 := testReq(router, "GET", "/v1/api/building?sort=name&limit=2&name_prefix="+prefix+"&cursor="+response.NextCursor, nil)
+				var response2 handler.Response
+				if err := json.Unmarshal(body2, &response2); err != nil {
+					Fail(err.Error())
+				}
+				Expect(w2.Code).To(Equal(http.StatusOK))
+				rows, _ := response2.Result.([]interface{})
+				Expect(len(rows)).To(Equal(1))
+				Expect(response2.NextCursor).To(BeEmpty())
+				By("Last page ok")
+
+				w3, _ := testReq(router, "GET", "/v1/api/building?sort=floors", nil)
+				Expect(w3.Code).To(Equal(http.StatusBadRequest))
+				By("Bad sort rejected")
+
+				w4, body4 := testReq(router, "GET", "/v1/api/building?name_prefix="+prefix+"-none", nil)
+				Expect(w4.Code).To(Equal(http.StatusOK))
+				Expect(string(body4)).To(ContainSubstring(`"result":[]`))
+				By("No match ok")
+			})
+		})
+
 		Context("Get 1 record", func() {
 			It("should return ok", func() {
 				formdata = tools.Seeder{}.Create()
@@ -177,6 +221,162 @@ var _ = Describe("REST Building API Service::HANDLERS", func() {
 			})
 		})
 
+		Context("Rename record", func() {
+			It("should keep the id and free the old name", func() {
+				buildingName := fmt.Sprintf("building-%s", fake.DigitsN(5))
+				formdata = tools.Seeder{}.CreateWithName(buildingName)
+				w, body := testReq(router, "POST", "/v1/api/building",
+					bytes.NewReader([]byte(formdata)))
+				var response handler.Response
+				if err := json.Unmarshal(body, &response); err != nil {
+					Fail(err.Error())
+				}
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				By("Add before rename ok")
+
+				pid, _ := response.Result.(string)
+				formdata = tools.Seeder{}.Update(pid, buildingName+"-renamed")
+				w2, _ := testReq(router, "PUT", "/v1/api/building",
+					bytes.NewReader([]byte(formdata)))
+				Expect(w2.Code).To(Equal(http.StatusOK))
+
+				w3, body3 := testReq(router, "GET", "/v1/api/building/"+pid, nil)
+				Expect(w3.Code).To(Equal(http.StatusOK))
+				Expect(string(body3)).To(ContainSubstring(buildingName + "-renamed"))
+				By("Rename ok")
+
+				//the md5 of the name is no id of a record that never had one
+				alias := tools.Helper{}.HashMD5(buildingName + "-renamed")
+				w4, _ := testReq(router, "GET", "/v1/api/building/"+alias, nil)
+				Expect(w4.Code).To(Equal(http.StatusNotFound))
+				By("No name alias ok")
+
+				formdata = tools.Seeder{}.CreateWithName(buildingName)
+				w5, _ := testReq(router, "POST", "/v1/api/building",
+					bytes.NewReader([]byte(formdata)))
+				Expect(w5.Code).To(Equal(http.StatusCreated))
+				By("Old name reusable")
+			})
+		})
+
+		Context("Patch record", func() {
+			It("should change only the given fields", func() {
+				formdata = tools.Seeder{}.Create()
+				w, body := testReq(router, "POST", "/v1/api/building",
+					bytes.NewReader([]byte(formdata)))
+				var response handler.Response
+				if err := json.Unmarshal(body, &response); err != nil {
+					Fail(err.Error())
+				}
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				By("Add before patch ok")
+
+				pid, _ := response.Result.(string)
+				w2, body2 := testReqWithHeaders(router, "PATCH", "/v1/api/building/"+pid,
+					bytes.NewReader([]byte(`{"address":"patched address"}`)),
+					map[string]string{"Content-Type": "application/merge-patch+json"})
+				Expect(w2.Code).To(Equal(http.StatusOK))
+				var patched struct {
+					Result models.BuildingData `json:"result"`
+				}
+				if err := json.Unmarshal(body2, &patched); err != nil {
+					Fail(err.Error())
+				}
+				Expect(patched.Result.Address).To(Equal("patched address"))
+				Expect(len(patched.Result.Floors)).To(Equal(2))
+				Expect(w2.Header().Get("ETag")).To(Equal(`"2"`))
+				By("Merge patch ok")
+
+				w3, _ := testReqWithHeaders(router, "PATCH", "/v1/api/building/"+pid,
+					bytes.NewReader([]byte(`[{"op":"test","path":"/version","value":1},{"op":"remove","path":"/floors/0"}]`)),
+					map[string]string{"Content-Type": "application/json-patch+json"})
+				Expect(w3.Code).To(Equal(http.StatusConflict))
+				w4, body4 := testReqWithHeaders(router, "PATCH", "/v1/api/building/"+pid,
+					bytes.NewReader([]byte(`[{"op":"test","path":"/version","value":2},{"op":"remove","path":"/floors/0"}]`)),
+					map[string]string{"Content-Type": "application/json-patch+json"})
+				Expect(w4.Code).To(Equal(http.StatusOK))
+				if err := json.Unmarshal(body4, &patched); err != nil {
+					Fail(err.Error())
+				}
+				Expect(len(patched.Result.Floors)).To(Equal(1))
+				Expect(patched.Result.Address).To(Equal("patched address"))
+				By("JSON patch ok")
+
+				w5, body5 := testReqWithHeaders(router, "PATCH", "/v1/api/building/"+pid,
+					bytes.NewReader([]byte(`{"name":null,"floors":[{"level":1,"label":"a"},{"level":2,"label":"A"}]}`)),
+					map[string]string{"Content-Type": "application/merge-patch+json"})
+				Expect(w5.Code).To(Equal(http.StatusBadRequest))
+				var problem handler.Problem
+				if err := json.Unmarshal(body5, &problem); err != nil {
+					Fail(err.Error())
+				}
+				Expect(problem.Status).To(Equal(http.StatusBadRequest))
+				Expect(problem.Code).To(Equal(handler.CodeValidationFailed))
+				Expect(problem.Errors).To(Equal([]models.FieldError{
+					{Field: "name", Rule: models.RuleRequired, Message: "is required"},
+					{Field: "floors[1].label", Rule: models.RuleUnique, Message: "must be unique"},
+				}))
+				w6, _ := testReqWithHeaders(router, "PATCH", "/v1/api/building/"+pid,
+					bytes.NewReader([]byte(`name=x`)),
+					map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+				Expect(w6.Code).To(Equal(http.StatusUnsupportedMediaType))
+				w7, _ := testReqWithHeaders(router, "PATCH", "/v1/api/building/"+pid,
+					bytes.NewReader([]byte(`{"address":"`+strings.Repeat("x", handler.MaxPatchBody)+`"}`)),
+					map[string]string{"Content-Type": "application/merge-patch+json"})
+				Expect(w7.Code).To(Equal(http.StatusRequestEntityTooLarge))
+				By("Invalid patch rejected")
+			})
+		})
+
+		Context("Conditional requests", func() {
+			It("should honour the record version", func() {
+				formdata = tools.Seeder{}.Create()
+				w, body := testReq(router, "POST", "/v1/api/building",
+					bytes.NewReader([]byte(formdata)))
+				var response handler.Response
+				if err := json.Unmarshal(body, &response); err != nil {
+					Fail(err.Error())
+				}
+				Expect(w.Code).To(Equal(http.StatusCreated))
+				By("Add before conditional requests ok")
+
+				pid, _ := response.Result.(string)
+				w2, _ := testReq(router, "GET", "/v1/api/building/"+pid, nil)
+				Expect(w2.Code).To(Equal(http.StatusOK))
+				etag := w2.Header().Get("ETag")
+				Expect(etag).To(Equal(`"1"`))
+
+				w3, body3 := testReqWithHeaders(router, "GET", "/v1/api/building/"+pid, nil,
+					map[string]string{"If-None-Match": etag})
+				Expect(w3.Code).To(Equal(http.StatusNotModified))
+				Expect(len(body3)).To(Equal(0))
+				By("Not modified ok")
+
+				var row map[string]interface{}
+				json.Unmarshal([]byte(formdata), &row)
+				name, _ := row["name"].(string)
+				w4, _ := testReqWithHeaders(router, "PUT", "/v1/api/building",
+					bytes.NewReader([]byte(tools.Seeder{}.Update(pid, name))),
+					map[string]string{"If-Match": `"0"`})
+				Expect(w4.Code).To(Equal(http.StatusPreconditionFailed))
+				w5, _ := testReqWithHeaders(router, "PUT", "/v1/api/building",
+					bytes.NewReader([]byte(tools.Seeder{}.Update(pid, name))),
+					map[string]string{"If-Match": etag})
+				Expect(w5.Code).To(Equal(http.StatusOK))
+				By("Update with version ok")
+
+				w6, _ := testReq(router, "GET", "/v1/api/building/"+pid, nil)
+				Expect(w6.Header().Get("ETag")).To(Equal(`"2"`))
+				w7, _ := testReqWithHeaders(router, "DELETE", "/v1/api/building/"+pid, nil,
+					map[string]string{"If-Match": etag})
+				Expect(w7.Code).To(Equal(http.StatusPreconditionFailed))
+				w8, _ := testReqWithHeaders(router, "DELETE", "/v1/api/building/"+pid, nil,
+					map[string]string{"If-Match": `"2"`})
+				Expect(w8.Code).To(Equal(http.StatusOK))
+				By("Delete with version ok")
+			})
+		})
+
 	}) // valid params
 
 	Context("Invalid parameters", func() {
@@ -186,11 +386,12 @@ var _ = Describe("REST Building API Service::HANDLERS", func() {
 				formdata = tools.Seeder{}.CreateWithEmptyName()
 				w, body := testReq(router, "POST", "/v1/api/building",
 					bytes.NewReader([]byte(formdata)))
-				var response handler.Response
+				var response handler.Problem
 				if err := json.Unmarshal(body, &response); err != nil {
 					Fail(err.Error())
 				}
 				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(response.Code).To(Equal(handler.CodeValidationFailed))
 				By("Create data not done")
 			})
 		})
@@ -208,11 +409,12 @@ var _ = Describe("REST Building API Service::HANDLERS", func() {
 				By("Add before duplicate ok")
 				//do it again
 				w2, body2 := testReq(router, "POST", "/v1/api/building", bytes.NewReader([]byte(formdata)))
-				var response2 handler.Response
+				var response2 handler.Problem
 				if err := json.Unmarshal(body2, &response2); err != nil {
 					Fail(err.Error())
 				}
 				Expect(w2.Code).To(Equal(http.StatusConflict))
+				Expect(response2.Code).To(Equal(handler.CodeRecordExists))
 				By("Duplicate data not allowed")
 			})
 		})
@@ -222,11 +424,12 @@ var _ = Describe("REST Building API Service::HANDLERS", func() {
 				formdata = tools.Seeder{}.CreateWithEmptyName()
 				w, body := testReq(router, "POST", "/v1/api/building",
 					bytes.NewReader([]byte(formdata)))
-				var response handler.Response
+				var response handler.Problem
 				if err := json.Unmarshal(body, &response); err != nil {
 					Fail(err.Error())
 				}
 				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(response.Code).To(Equal(handler.CodeValidationFailed))
 				By("Create data not done")
 			})
 		})
@@ -234,11 +437,12 @@ var _ = Describe("REST Building API Service::HANDLERS", func() {
 		Context("Get 1 record with missing ID", func() {
 			It("should not return data", func() {
 				w, body := testReq(router, "GET", "/v1/api/building/no-id", nil)
-				var response handler.Response
+				var response handler.Problem
 				if err := json.Unmarshal(body, &response); err != nil {
 					Fail(err.Error())
 				}
 				Expect(w.Code).To(Equal(http.StatusNotFound))
+				Expect(response.Code).To(Equal(handler.CodeRecordNotFound))
 				By("Get data not found")
 			})
 		})
@@ -260,17 +464,18 @@ var _ = Describe("REST Building API Service::HANDLERS", func() {
 				formdata = tools.Seeder{}.Update(pid+"-not-exists", buildingName)
 				w2, body2 := testReq(router, "PUT", "/v1/api/building",
 					bytes.NewReader([]byte(formdata)))
-				var response2 handler.Response
+				var response2 handler.Problem
 				if err := json.Unmarshal(body2, &response2); err != nil {
 					Fail(err.Error())
 				}
 				Expect(w2.Code).To(Equal(http.StatusNotFound))
+				Expect(response2.Code).To(Equal(handler.CodeRecordNotFound))
 				By("Update data did not continue")
 			})
 		})
 
-		Context("Update record with different name", func() {
-			It("should return not exists", func() {
+		Context("Update record with name of another record", func() {
+			It("should return conflict", func() {
 				buildingName := fmt.Sprintf("building-%s", fake.DigitsN(5))
 				formdata = tools.Seeder{}.CreateWithName(buildingName)
 				w, body := testReq(router, "POST", "/v1/api/building",
@@ -280,17 +485,22 @@ var _ = Describe("REST Building API Service::HANDLERS", func() {
 					Fail(err.Error())
 				}
 				Expect(w.Code).To(Equal(http.StatusCreated))
+				formdata = tools.Seeder{}.CreateWithName(buildingName + "-diff-name")
+				w, _ = testReq(router, "POST", "/v1/api/building",
+					bytes.NewReader([]byte(formdata)))
+				Expect(w.Code).To(Equal(http.StatusCreated))
 				By("Add before update data ok")
 				//update it
 				pid, _ := response.Result.(string)
 				formdata = tools.Seeder{}.Update(pid, buildingName+"-diff-name")
 				w2, body2 := testReq(router, "PUT", "/v1/api/building",
 					bytes.NewReader([]byte(formdata)))
-				var response2 handler.Response
+				var response2 handler.Problem
 				if err := json.Unmarshal(body2, &response2); err != nil {
 					Fail(err.Error())
 				}
 				Expect(w2.Code).To(Equal(http.StatusConflict))
+				Expect(response2.Code).To(Equal(handler.CodeRecordExists))
 				By("Update data did not continue")
 			})
 		})
@@ -312,11 +522,12 @@ var _ = Describe("REST Building API Service::HANDLERS", func() {
 				formdata = tools.Seeder{}.Update(pid, "")
 				w2, body2 := testReq(router, "PUT", "/v1/api/building",
 					bytes.NewReader([]byte(formdata)))
-				var response2 handler.Response
+				var response2 handler.Problem
 				if err := json.Unmarshal(body2, &response2); err != nil {
 					Fail(err.Error())
 				}
 				Expect(w2.Code).To(Equal(http.StatusBadRequest))
+				Expect(response2.Code).To(Equal(handler.CodeValidationFailed))
 				By("Update data did not continue")
 			})
 		})
@@ -335,11 +546,12 @@ var _ = Describe("REST Building API Service::HANDLERS", func() {
 
 				pid, _ := response.Result.(string)
 				w2, body2 := testReq(router, "DELETE", "/v1/api/building/"+pid+"not-exists", nil)
-				var response2 handler.Response
+				var response2 handler.Problem
 				if err := json.Unmarshal(body2, &response2); err != nil {
 					Fail(err.Error())
 				}
 				Expect(w2.Code).To(Equal(http.StatusNotFound))
+				Expect(response2.Code).To(Equal(handler.CodeRecordNotFound))
 				By("Remove data did not continue")
 			})
 		})
@@ -348,6 +560,11 @@ var _ = Describe("REST Building API Service::HANDLERS", func() {
 
 // testReq dummy recorder for http
 func testReq(router *chi.Mux, method, path string, body io.Reader) (*httptest.ResponseRecorder, []byte) {
+	return testReqWithHeaders(router, method, path, body, nil)
+}
+
+// testReqWithHeaders dummy recorder for http with extra request headers
+func testReqWithHeaders(router *chi.Mux, method, path string, body io.Reader, headers map[string]string) (*httptest.ResponseRecorder, []byte) {
 
 	req, err := http.NewRequest(method, path, body)
 	if err != nil {
@@ -356,6 +573,9 @@ func testReq(router *chi.Mux, method, path string, body io.Reader) (*httptest.Re
 
 	w := httptest.NewRecorder()
 	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
 	router.ServeHTTP(w, req)
 
 	respBody, err := ioutil.ReadAll(w.Body)
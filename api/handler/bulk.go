@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/models"
+	"github.com/bayugyug/building-custom-api/tools"
+
+	"github.com/go-chi/render"
+)
+
+// BulkEndpoints the bulk end-points-url mapping
+type BulkEndpoints interface {
+	Bulk(w http.ResponseWriter, r *http.Request)
+}
+
+// BulkReply outcome of 1 bulk item
+type BulkReply struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Bulk run a list of create, update and delete items
+func (b *Building) Bulk(w http.ResponseWriter, r *http.Request) {
+	data := models.NewBuildingBulk()
+	if v := strings.TrimSpace(r.URL.Query().Get("atomic")); v != "" {
+		atomic, err := strconv.ParseBool(v)
+		if err != nil {
+			//400
+			b.ReplyErr(w, r, models.ErrInvalidParameters)
+			return
+		}
+		data.Atomic = atomic
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		//400
+		b.ReplyProblem(w, r, NewProblem(http.StatusBadRequest, CodeInvalidBody, err.Error()))
+		return
+	}
+	//sanity check
+	if err := data.Decode(body); err != nil {
+		//400
+		b.ReplyErr(w, r, err)
+		return
+	}
+	//the caller owns what it creates
+	for _, item := range data.Items {
+		item.Owner = callerOf(r)
+	}
+	results, err := data.Apply(b.Storage)
+	switch err {
+	case nil:
+		//good
+		render.JSON(w, r, Response{
+			Status: "success",
+			Result: bulkReplies(r, results),
+			Total:  len(results),
+		})
+	case models.ErrBulkAborted:
+		//422
+		p := ProblemFrom(err)
+		p.Detail = "no item was kept, see the items for the one that failed"
+		p.Items = bulkReplies(r, results)
+		b.ReplyProblem(w, r, p)
+	default:
+		b.ReplyErr(w, r, err)
+	}
+}
+
+// bulkReplies map the item errors the same way the single row end-points do
+func bulkReplies(r *http.Request, results []*models.BulkResult) []*BulkReply {
+	replies := make([]*BulkReply, len(results))
+	for i, result := range results {
+		reply := &BulkReply{
+			Index:  result.Index,
+			Op:     result.Op,
+			ID:     result.ID,
+			Status: http.StatusOK,
+		}
+		switch {
+		case result.Err == nil && result.Op == models.BulkOpCreate:
+			reply.Status = http.StatusCreated
+		case result.Err == models.ErrBulkAborted:
+			//424, the item itself was fine
+			reply.Status, reply.Code = http.StatusFailedDependency, CodeBulkAborted
+		case result.Err != nil:
+			p := ProblemFrom(result.Err)
+			reply.Status, reply.Code = p.Status, p.Code
+			if p.Status >= http.StatusInternalServerError {
+				tools.LoggerFrom(r.Context()).Error("bulk item failed", tools.Fields{"error": result.Err, "index": result.Index})
+			}
+		}
+		if result.Err != nil {
+			reply.Error = ProblemFrom(result.Err).Error()
+		}
+		replies[i] = reply
+	}
+	return replies
+}
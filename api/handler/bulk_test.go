@@ -0,0 +1,94 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/api/routes"
+
+	"github.com/go-chi/chi"
+	"github.com/icrowley/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::BULK-HANDLERS", func() {
+	//init
+	service, _ := routes.NewAPIService(
+		routes.WithSvcOptAddress(":8989"),
+	)
+
+	var router *chi.Mux
+
+	BeforeEach(func() {
+		router = chi.NewRouter()
+		router.Post("/v1/api/building/_bulk", service.Building.Bulk)
+		router.Get("/v1/api/building/{id}", service.Building.GetOne)
+	})
+
+	bulkReply := func(body []byte) []handler.BulkReply {
+		var response struct {
+			Result []handler.BulkReply `json:"result"`
+			Items  []handler.BulkReply `json:"items"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			Fail(err.Error())
+		}
+		if response.Items != nil {
+			return response.Items
+		}
+		return response.Result
+	}
+
+	Context("Valid parameters", func() {
+
+		It("should give a status per item", func() {
+			name := fmt.Sprintf("bulk::%s", fake.DigitsN(15))
+			w, body := testReqWithHeaders(router, "POST", "/v1/api/building/_bulk",
+				bytes.NewReader([]byte(fmt.Sprintf(`{"op":"create","name":"%s"}
+{"op":"create","name":"%s"}
+{"op":"delete","id":"not-exists-id"}`, name, name))),
+				map[string]string{"Content-Type": "application/x-ndjson"})
+			Expect(w.Code).To(Equal(http.StatusOK))
+			replies := bulkReply(body)
+			Expect(len(replies)).To(Equal(3))
+			Expect(replies[0].Status).To(Equal(http.StatusCreated))
+			Expect(replies[1].Status).To(Equal(http.StatusConflict))
+			Expect(replies[1].Code).To(Equal(handler.CodeRecordExists))
+			Expect(replies[2].Status).To(Equal(http.StatusNotFound))
+			w2, _ := testReq(router, "GET", "/v1/api/building/"+replies[0].ID, nil)
+			Expect(w2.Code).To(Equal(http.StatusOK))
+			By("Bulk per item ok")
+		})
+
+		It("should apply all or nothing when atomic", func() {
+			name := fmt.Sprintf("bulk::%s", fake.DigitsN(15))
+			w, body := testReq(router, "POST", "/v1/api/building/_bulk?atomic=true",
+				bytes.NewReader([]byte(fmt.Sprintf(`[{"op":"create","name":"%s"},{"op":"update","id":"not-exists-id","name":"x"}]`, name))))
+			Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(w.Header().Get("Content-Type")).To(Equal(handler.ContentTypeProblem))
+			replies := bulkReply(body)
+			Expect(replies[0].Status).To(Equal(http.StatusFailedDependency))
+			Expect(replies[1].Status).To(Equal(http.StatusNotFound))
+			w2, _ := testReq(router, "GET", "/v1/api/building/"+replies[0].ID, nil)
+			Expect(w2.Code).To(Equal(http.StatusNotFound))
+			By("Bulk atomic ok")
+		})
+	})
+
+	Context("Invalid parameters", func() {
+
+		It("should reject an empty or broken body", func() {
+			w, _ := testReq(router, "POST", "/v1/api/building/_bulk", bytes.NewReader([]byte(`[]`)))
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+			w2, _ := testReq(router, "POST", "/v1/api/building/_bulk", bytes.NewReader([]byte(`[{"op":`)))
+			Expect(w2.Code).To(Equal(http.StatusBadRequest))
+			w3, _ := testReq(router, "POST", "/v1/api/building/_bulk?atomic=maybe", bytes.NewReader([]byte(`[]`)))
+			Expect(w3.Code).To(Equal(http.StatusBadRequest))
+			By("Invalid bulk rejected")
+		})
+	})
+})
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/models"
+)
+
+const (
+	// LastEventIDHeader header of the last change a resuming client got
+	LastEventIDHeader = "Last-Event-ID"
+	// ContentTypeEventStream Server-Sent Events reply
+	ContentTypeEventStream = "text/event-stream"
+	// ChangeReset event telling the client the changes it missed are gone, it must reload
+	ChangeReset = "reset"
+
+	// changesKeepAlive time between the comments keeping an idle stream open
+	changesKeepAlive = 15 * time.Second
+	// changesRetry reconnect delay in ms the client is told to use
+	changesRetry = 2000
+)
+
+// ChangeEndpoints the change feed end-point
+type ChangeEndpoints interface {
+	Changes(w http.ResponseWriter, r *http.Request)
+}
+
+// ChangeEvent 1 building change as sent on the stream, Before is null on create and After on delete
+type ChangeEvent struct {
+	Seq    uint64               `json:"seq"`
+	Type   string               `json:"type"`
+	ID     string               `json:"id"`
+	Before *models.BuildingData `json:"before"`
+	After  *models.BuildingData `json:"after"`
+	Time   string               `json:"time"`
+}
+
+// Changes stream the building changes as Server-Sent Events.
+// A client sending Last-Event-ID, or ?last_event_id, gets the changes it missed first;
+// when those already left the log it gets a reset event and must reload.
+// The stream is kept open past the write timeout of the server, until the client goes or the server shuts down.
+func (b *Building) Changes(w http.ResponseWriter, r *http.Request) {
+	feed := drivers.Changes(b.Storage)
+	flusher, ok := w.(http.Flusher)
+	if feed == nil || !ok {
+		//501
+		b.ReplyProblem(w, r, NewProblem(http.StatusNotImplemented, CodeStreamUnsupported, "change stream not available"))
+		return
+	}
+	after, resume, err := lastEventID(r)
+	if err != nil {
+		//400
+		b.ReplyProblem(w, r, NewProblem(http.StatusBadRequest, CodeInvalidParameter, err.Error()))
+		return
+	}
+	if !resume {
+		after = feed.Seq()
+	}
+	sub, backlog, err := feed.Subscribe(after, 0)
+	reset := err == drivers.ErrChangesGone
+	if reset {
+		after = feed.Seq()
+		sub, backlog, err = feed.Subscribe(after, 0)
+	}
+	//chk
+	if err != nil {
+		b.ReplyErr(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	//no write deadline, the keep-alive pings notice a client gone away
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	h := w.Header()
+	h.Set("Content-Type", ContentTypeEventStream)
+	h.Set("Cache-Control", "no-cache")
+	//proxies must not buffer the stream
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", changesRetry); err != nil {
+		return
+	}
+	if reset {
+		if writeEvent(w, after, ChangeReset, map[string]uint64{"seq": after}) != nil {
+			return
+		}
+	}
+	for _, change := range backlog {
+		if writeChange(w, change) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(changesKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case change, ok := <-sub.C:
+			if !ok {
+				//dropped or shutting down, the client resumes with Last-Event-ID
+				return
+			}
+			if writeChange(w, change) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// lastEventID the sequence number the client resumes after, resume is false when none given
+func lastEventID(r *http.Request) (after uint64, resume bool, err error) {
+	raw := strings.TrimSpace(r.Header.Get(LastEventIDHeader))
+	if raw == "" {
+		raw = strings.TrimSpace(r.URL.Query().Get("last_event_id"))
+	}
+	if raw == "" {
+		return 0, false, nil
+	}
+	after, err = strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s must be a change sequence number", LastEventIDHeader)
+	}
+	return after, true, nil
+}
+
+// writeChange send the change of a building
+func writeChange(w http.ResponseWriter, change drivers.Change) error {
+	before, _ := change.Before.(*models.BuildingData)
+	after, _ := change.After.(*models.BuildingData)
+	ev := ChangeEvent{
+		Seq:    change.Seq,
+		Type:   change.Type,
+		ID:     change.Key,
+		Before: before,
+		After:  after,
+		Time:   change.Time.UTC().Format(time.RFC3339Nano),
+	}
+	return writeEvent(w, change.Seq, change.Type, ev)
+}
+
+// writeEvent 1 event in the text/event-stream format
+func writeEvent(w http.ResponseWriter, id uint64, event string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, raw)
+	return err
+}
@@ -0,0 +1,162 @@
+package handler_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/tools"
+
+	"github.com/icrowley/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// sseEvent 1 parsed event of the stream
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+var _ = Describe("REST Building API Service::CHANGES", func() {
+
+	var service *routes.APIService
+	var server *httptest.Server
+	var cancels []context.CancelFunc
+
+	BeforeEach(func() {
+		service, _ = routes.NewAPIService(
+			routes.WithSvcOptAddress(":8989"),
+			routes.WithSvcOptLogger(tools.NewLogger(tools.WithLoggerOptOutput(ioutil.Discard))),
+		)
+		server = httptest.NewServer(service.Mux)
+		cancels = nil
+	})
+
+	AfterEach(func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+		server.CloseClientConnections()
+		server.Close()
+	})
+
+	//open the stream, reading past the retry hint
+	stream := func(headers map[string]string) (*http.Response, *bufio.Reader) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels = append(cancels, cancel)
+		req, _ := http.NewRequest("GET", server.URL+"/v1/api/building/_changes", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req.WithContext(ctx))
+		Expect(err).NotTo(HaveOccurred())
+		rd := bufio.NewReader(res.Body)
+		if res.StatusCode == http.StatusOK {
+			Expect(next(rd).Event).To(BeEmpty())
+		}
+		return res, rd
+	}
+
+	create := func() string {
+		body := fmt.Sprintf(`{"name":"building-%s","address":"address here"}`, fake.DigitsN(8))
+		w, reply := testReq(service.Mux, "POST", "/v1/api/building", bytes.NewReader([]byte(body)))
+		Expect(w.Code).To(Equal(http.StatusCreated))
+		var res handler.Response
+		Expect(json.Unmarshal(reply, &res)).To(Succeed())
+		return res.Result.(string)
+	}
+
+	decode := func(ev sseEvent) handler.ChangeEvent {
+		var change handler.ChangeEvent
+		Expect(json.Unmarshal([]byte(ev.Data), &change)).To(Succeed())
+		return change
+	}
+
+	Context("Live", func() {
+
+		It("should stream the writes of the buildings only", func() {
+			res, rd := stream(nil)
+			Expect(res.Header.Get("Content-Type")).To(Equal(handler.ContentTypeEventStream))
+
+			pid := create()
+			ev := next(rd)
+			Expect(ev.Event).To(Equal("created"))
+			change := decode(ev)
+			Expect(change.ID).To(Equal(pid))
+			Expect(change.Before).To(BeNil())
+			Expect(change.After.ID).To(Equal(pid))
+			Expect(ev.ID).To(Equal(fmt.Sprint(change.Seq)))
+
+			w, _ := testReq(service.Mux, "DELETE", "/v1/api/building/"+pid, nil)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			ev = next(rd)
+			Expect(ev.Event).To(Equal("deleted"))
+			change = decode(ev)
+			Expect(change.Before.ID).To(Equal(pid))
+			Expect(change.After).To(BeNil())
+			By("Live ok")
+		})
+	})
+
+	Context("Resume", func() {
+
+		It("should send the missed changes after Last-Event-ID", func() {
+			first, second := create(), create()
+			_, rd := stream(map[string]string{handler.LastEventIDHeader: "0"})
+			ev := next(rd)
+			Expect(decode(ev).ID).To(Equal(first))
+			_, rd = stream(map[string]string{handler.LastEventIDHeader: ev.ID})
+			Expect(decode(next(rd)).ID).To(Equal(second))
+			By("Resume ok")
+		})
+
+		It("should tell the client to reload when the changes are gone", func() {
+			create()
+			_, rd := stream(map[string]string{handler.LastEventIDHeader: "9999"})
+			ev := next(rd)
+			Expect(ev.Event).To(Equal(handler.ChangeReset))
+			Expect(ev.Data).To(ContainSubstring(`"seq":` + ev.ID))
+			By("Reset ok")
+		})
+
+		It("should refuse a bad Last-Event-ID", func() {
+			res, _ := stream(map[string]string{handler.LastEventIDHeader: "abc"})
+			Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+			By("Bad id ok")
+		})
+	})
+})
+
+// next read 1 event of the stream, comments skipped
+func next(rd *bufio.Reader) sseEvent {
+	var ev sseEvent
+	seen := false
+	for {
+		line, err := rd.ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && seen:
+			return ev
+		case line == "", strings.HasPrefix(line, ":"):
+			continue
+		case strings.HasPrefix(line, "id: "):
+			ev.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			ev.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.Data = strings.TrimPrefix(line, "data: ")
+		}
+		seen = true
+	}
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// Docs the api document end-points
+type Docs struct {
+	Spec []byte
+}
+
+// NewDocs new instance
+func NewDocs() *Docs {
+	return &Docs{}
+}
+
+// OpenAPI the OpenAPI 3 document of the routes
+func (d *Docs) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(d.Spec)
+}
+
+// Page static docs page rendering the OpenAPI document
+func (d *Docs) Page(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
+
+// docsPage self-contained, no assets from outside
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Building API</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h2 { border-bottom: 1px solid #ccc; padding-bottom: .2em; }
+.op { margin: .5em 0; border: 1px solid #ddd; border-radius: 4px; }
+.op summary { padding: .5em; cursor: pointer; }
+.op div { padding: 0 1em 1em; }
+.method { display: inline-block; width: 5em; font-weight: bold; }
+.get { color: #2a7ae2; } .post { color: #2e8b57; } .put { color: #c77c02; }
+.patch { color: #8a4baf; } .delete { color: #c0392b; }
+pre { background: #f6f8fa; padding: .5em; overflow: auto; }
+</style>
+</head>
+<body>
+<h1 id="title">Building API</h1>
+<p><a href="/v1/openapi.json">openapi.json</a></p>
+<div id="ops"></div>
+<script>
+function el(tag, text, cls) {
+	var e = document.createElement(tag);
+	if (text) { e.textContent = text; }
+	if (cls) { e.className = cls; }
+	return e;
+}
+function resolve(spec, schema) {
+	if (schema && schema["$ref"]) {
+		return spec.components.schemas[schema["$ref"].split("/").pop()];
+	}
+	return schema;
+}
+fetch("/v1/openapi.json").then(function (r) { return r.json(); }).then(function (spec) {
+	document.getElementById("title").textContent = spec.info.title + " " + spec.info.version;
+	var ops = document.getElementById("ops"), groups = {};
+	Object.keys(spec.paths).sort().forEach(function (path) {
+		Object.keys(spec.paths[path]).forEach(function (method) {
+			var op = spec.paths[path][method], tag = (op.tags || ["other"])[0];
+			if (!groups[tag]) {
+				groups[tag] = el("section");
+				groups[tag].appendChild(el("h2", tag));
+				ops.appendChild(groups[tag]);
+			}
+			var box = el("details", null, "op"), head = el("summary");
+			head.appendChild(el("span", method.toUpperCase(), "method " + method));
+			head.appendChild(el("code", path));
+			head.appendChild(el("span", " " + (op.summary || "")));
+			box.appendChild(head);
+			var body = el("div");
+			(op.parameters || []).forEach(function (p) {
+				body.appendChild(el("p", p["in"] + " " + p.name + (p.required ? " (required)" : "") + " " + (p.description || "")));
+			});
+			if (op.requestBody) {
+				var content = op.requestBody.content;
+				Object.keys(content).forEach(function (ct) {
+					body.appendChild(el("p", "body " + ct));
+					body.appendChild(el("pre", JSON.stringify(resolve(spec, content[ct].schema), null, 2)));
+				});
+			}
+			Object.keys(op.responses).forEach(function (code) {
+				body.appendChild(el("p", code + " " + op.responses[code].description));
+			});
+			box.appendChild(body);
+			groups[tag].appendChild(box);
+		});
+	});
+});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,61 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/api/routes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::DOCS", func() {
+	//init
+	service, _ := routes.NewAPIService(
+		routes.WithSvcOptAddress(":8989"),
+	)
+
+	Context("OpenAPI document", func() {
+
+		It("should describe the mapped routes", func() {
+			w, body := testReq(service.Mux, "GET", "/v1/openapi.json", nil)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			var spec struct {
+				OpenAPI string `json:"openapi"`
+				Paths   map[string]map[string]struct {
+					OperationID string `json:"operationId"`
+				} `json:"paths"`
+				Components struct {
+					Schemas map[string]struct {
+						Required   []string `json:"required"`
+						Properties map[string]struct {
+							MaxLength *int `json:"maxLength"`
+						} `json:"properties"`
+					} `json:"schemas"`
+				} `json:"components"`
+			}
+			Expect(json.Unmarshal(body, &spec)).To(Succeed())
+			Expect(spec.OpenAPI).To(Equal("3.0.3"))
+			Expect(spec.Paths["/v1/api/building/{id}"]["get"].OperationID).To(Equal("getBuilding"))
+			Expect(spec.Paths["/v1/api/building/_bulk"]["post"].OperationID).To(Equal("bulkBuildings"))
+			Expect(spec.Paths).To(HaveKey("/v1/api/building/{id}/floors/{floorId}/rooms/{roomId}"))
+			params, ok := spec.Components.Schemas["BuildingCreateParams"]
+			Expect(ok).To(BeTrue())
+			Expect(params.Required).To(Equal([]string{"name"}))
+			Expect(params.Properties["name"].MaxLength).NotTo(BeNil())
+			Expect(*params.Properties["name"].MaxLength).To(Equal(200))
+			Expect(spec.Components.Schemas["BuildingUpdateParams"].Required).To(ContainElement("id"))
+			By("OpenAPI ok")
+		})
+
+		It("should serve the docs page", func() {
+			w, body := testReq(service.Mux, "GET", "/v1/docs", nil)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(strings.HasPrefix(w.Header().Get("Content-Type"), "text/html")).To(BeTrue())
+			Expect(string(body)).To(ContainSubstring("/v1/openapi.json"))
+			By("Docs ok")
+		})
+	})
+})
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/models"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+// FloorEndpoints the floor sub-resource end-points-url mapping
+type FloorEndpoints interface {
+	CreateFloor(w http.ResponseWriter, r *http.Request)
+	UpdateFloor(w http.ResponseWriter, r *http.Request)
+	GetFloors(w http.ResponseWriter, r *http.Request)
+	GetFloor(w http.ResponseWriter, r *http.Request)
+	DeleteFloor(w http.ResponseWriter, r *http.Request)
+}
+
+// CreateFloor add a floor to the building
+func (b *Building) CreateFloor(w http.ResponseWriter, r *http.Request) {
+	data := models.NewFloorCreate(strings.TrimSpace(chi.URLParam(r, "id")))
+	//sanity check
+	if err := render.Bind(r, data); err != nil {
+		//400
+		b.ReplyBindErr(w, r, err)
+		return
+	}
+	data.IfMatch = r.Header.Get("If-Match")
+	pid, err := data.Create(b.Storage)
+	//chk
+	if err != nil {
+		b.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: pid,
+	})
+}
+
+// UpdateFloor replace the floor fields
+func (b *Building) UpdateFloor(w http.ResponseWriter, r *http.Request) {
+	data := models.NewFloorUpdate(
+		strings.TrimSpace(chi.URLParam(r, "id")),
+		strings.TrimSpace(chi.URLParam(r, "floorId")),
+	)
+	//sanity check
+	if err := render.Bind(r, data); err != nil {
+		//400
+		b.ReplyBindErr(w, r, err)
+		return
+	}
+	data.IfMatch = r.Header.Get("If-Match")
+	row, err := data.Update(b.Storage)
+	//chk
+	if err != nil {
+		b.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: row,
+	})
+}
+
+// GetFloors list the floors of the building
+func (b *Building) GetFloors(w http.ResponseWriter, r *http.Request) {
+	data := models.NewFloorGet(strings.TrimSpace(chi.URLParam(r, "id")), "")
+	rows, err := data.GetAll(b.Storage)
+	//chk
+	if err != nil {
+		b.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: rows,
+		Total:  len(rows),
+	})
+}
+
+// GetFloor get 1 floor of the building
+func (b *Building) GetFloor(w http.ResponseWriter, r *http.Request) {
+	data := models.NewFloorGet(
+		strings.TrimSpace(chi.URLParam(r, "id")),
+		strings.TrimSpace(chi.URLParam(r, "floorId")),
+	)
+	row, err := data.Get(b.Storage)
+	//chk
+	if err != nil {
+		b.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: row.Summary(),
+	})
+}
+
+// DeleteFloor remove the floor from the building
+func (b *Building) DeleteFloor(w http.ResponseWriter, r *http.Request) {
+	data := models.NewFloorDelete(
+		strings.TrimSpace(chi.URLParam(r, "id")),
+		strings.TrimSpace(chi.URLParam(r, "floorId")),
+	)
+	data.IfMatch = r.Header.Get("If-Match")
+	//rooms go along only if asked
+	if v := strings.TrimSpace(r.URL.Query().Get("cascade")); v != "" {
+		cascade, err := strconv.ParseBool(v)
+		if err != nil {
+			//400
+			b.ReplyErr(w, r, models.ErrInvalidParameters)
+			return
+		}
+		data.Cascade = cascade
+	}
+	//chk
+	if err := data.Delete(b.Storage); err != nil {
+		b.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+	})
+}
@@ -0,0 +1,97 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/tools"
+
+	"github.com/go-chi/chi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::FLOOR-HANDLERS", func() {
+	//init
+	service, _ := routes.NewAPIService(
+		routes.WithSvcOptAddress(":8989"),
+	)
+
+	var router *chi.Mux
+	var pid string
+
+	BeforeEach(func() {
+		router = chi.NewRouter()
+		router.Post("/v1/api/building", service.Building.Create)
+		router.Get("/v1/api/building/{id}/floors", service.Building.GetFloors)
+		router.Post("/v1/api/building/{id}/floors", service.Building.CreateFloor)
+		router.Get("/v1/api/building/{id}/floors/{floorId}", service.Building.GetFloor)
+		router.Put("/v1/api/building/{id}/floors/{floorId}", service.Building.UpdateFloor)
+		router.Delete("/v1/api/building/{id}/floors/{floorId}", service.Building.DeleteFloor)
+
+		w, body := testReq(router, "POST", "/v1/api/building",
+			bytes.NewReader([]byte(tools.Seeder{}.Create())))
+		var response handler.Response
+		if err := json.Unmarshal(body, &response); err != nil {
+			Fail(err.Error())
+		}
+		Expect(w.Code).To(Equal(http.StatusCreated))
+		pid, _ = response.Result.(string)
+	})
+
+	Context("Valid parameters", func() {
+
+		It("should manage the floors", func() {
+			w, body := testReq(router, "GET", "/v1/api/building/"+pid+"/floors", nil)
+			var response handler.Response
+			if err := json.Unmarshal(body, &response); err != nil {
+				Fail(err.Error())
+			}
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(response.Total).To(Equal(2))
+			By("List floors ok")
+
+			w2, body2 := testReq(router, "POST", "/v1/api/building/"+pid+"/floors",
+				bytes.NewReader([]byte(`{"level":3,"label":"roof deck","gross_area":250,"usage_type":"amenity"}`)))
+			var response2 handler.Response
+			if err := json.Unmarshal(body2, &response2); err != nil {
+				Fail(err.Error())
+			}
+			Expect(w2.Code).To(Equal(http.StatusCreated))
+			fid, _ := response2.Result.(string)
+			By("Create floor ok")
+
+			w3, _ := testReq(router, "PUT", "/v1/api/building/"+pid+"/floors/"+fid,
+				bytes.NewReader([]byte(`{"level":4,"label":"roof deck","usage_type":"amenity"}`)))
+			Expect(w3.Code).To(Equal(http.StatusOK))
+			w4, body4 := testReq(router, "GET", "/v1/api/building/"+pid+"/floors/"+fid, nil)
+			Expect(w4.Code).To(Equal(http.StatusOK))
+			Expect(string(body4)).To(ContainSubstring(`"level":4`))
+			By("Update floor ok")
+
+			w5, _ := testReq(router, "DELETE", "/v1/api/building/"+pid+"/floors/"+fid, nil)
+			Expect(w5.Code).To(Equal(http.StatusOK))
+			w6, _ := testReq(router, "GET", "/v1/api/building/"+pid+"/floors/"+fid, nil)
+			Expect(w6.Code).To(Equal(http.StatusNotFound))
+			By("Delete floor ok")
+		})
+	})
+
+	Context("Invalid parameters", func() {
+
+		It("should reject a taken level or missing level", func() {
+			w, _ := testReq(router, "POST", "/v1/api/building/"+pid+"/floors",
+				bytes.NewReader([]byte(`{"level":1,"label":"again"}`)))
+			Expect(w.Code).To(Equal(http.StatusConflict))
+			w2, _ := testReq(router, "POST", "/v1/api/building/"+pid+"/floors",
+				bytes.NewReader([]byte(`{"label":"no level"}`)))
+			Expect(w2.Code).To(Equal(http.StatusBadRequest))
+			w3, _ := testReq(router, "GET", "/v1/api/building/not-exists/floors", nil)
+			Expect(w3.Code).To(Equal(http.StatusNotFound))
+			By("Invalid floor requests rejected")
+		})
+	})
+})
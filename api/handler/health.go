@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+
+	"github.com/go-chi/render"
+)
+
+// health status values
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+)
+
+// ErrShuttingDown the service is draining, no new traffic
+var ErrShuttingDown = errors.New("shutting down")
+
+// HealthReport reply of the probes
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// HealthCheckResult outcome of 1 check
+type HealthCheckResult struct {
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Health the liveness and readiness probes
+type Health struct {
+	mtx      *sync.Mutex
+	checks   []drivers.HealthCheck
+	stopping int32
+}
+
+// NewHealth new instance, the shutdown check included
+func NewHealth() *Health {
+	h := &Health{mtx: new(sync.Mutex)}
+	h.Register(drivers.HealthCheck{Name: "shutdown", Check: func() error {
+		if h.ShuttingDown() {
+			return ErrShuttingDown
+		}
+		return nil
+	}})
+	return h
+}
+
+// Register add checks to the readiness, a name already there is replaced
+func (h *Health) Register(checks ...drivers.HealthCheck) {
+	// ensure
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	for _, check := range checks {
+		replaced := false
+		for i := range h.checks {
+			if h.checks[i].Name == check.Name {
+				h.checks[i] = check
+				replaced = true
+			}
+		}
+		if !replaced {
+			h.checks = append(h.checks, check)
+		}
+	}
+}
+
+// BeginShutdown fail the readiness from now on so traffic drains
+func (h *Health) BeginShutdown() {
+	atomic.StoreInt32(&h.stopping, 1)
+}
+
+// ShuttingDown true once the shutdown began
+func (h *Health) ShuttingDown() bool {
+	return atomic.LoadInt32(&h.stopping) == 1
+}
+
+// Check run all checks
+func (h *Health) Check() HealthReport {
+	h.mtx.Lock()
+	checks := append([]drivers.HealthCheck{}, h.checks...)
+	h.mtx.Unlock()
+
+	report := HealthReport{Status: HealthOK, Checks: make(map[string]HealthCheckResult, len(checks))}
+	for _, check := range checks {
+		start := time.Now()
+		err := check.Check()
+		res := HealthCheckResult{
+			Status:    HealthOK,
+			LatencyMS: float64(time.Since(start).Nanoseconds()) / float64(time.Millisecond),
+		}
+		if err != nil {
+			res.Status, res.Error = HealthFail, err.Error()
+			report.Status = HealthFail
+		}
+		report.Checks[check.Name] = res
+	}
+	return report
+}
+
+// Live the process is up and serving
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, HealthReport{Status: HealthOK})
+}
+
+// Ready all checks pass, else 503 with the detail per check
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	report := h.Check()
+	if report.Status != HealthOK {
+		//503
+		render.Status(r, http.StatusServiceUnavailable)
+	}
+	render.JSON(w, r, report)
+}
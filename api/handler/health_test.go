@@ -0,0 +1,75 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/drivers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::HEALTH", func() {
+
+	var service *routes.APIService
+
+	BeforeEach(func() {
+		service, _ = routes.NewAPIService(
+			routes.WithSvcOptAddress(":8989"),
+		)
+	})
+
+	report := func(body []byte) handler.HealthReport {
+		var res handler.HealthReport
+		if err := json.Unmarshal(body, &res); err != nil {
+			Fail(err.Error())
+		}
+		return res
+	}
+
+	Context("Probes", func() {
+
+		It("should be live and ready", func() {
+			w, body := testReq(service.Mux, "GET", "/v1/api/health/live", nil)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(report(body).Status).To(Equal(handler.HealthOK))
+
+			w, body = testReq(service.Mux, "GET", "/v1/api/health/ready", nil)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			res := report(body)
+			Expect(res.Status).To(Equal(handler.HealthOK))
+			Expect(res.Checks).To(HaveKey("storage"))
+			Expect(res.Checks).To(HaveKey("shutdown"))
+			By("Probes ok")
+		})
+
+		It("should not be ready once a check fails", func() {
+			service.Health.Register(drivers.HealthCheck{Name: "extra", Check: func() error {
+				return errors.New("dependency down")
+			}})
+			w, body := testReq(service.Mux, "GET", "/v1/api/health/ready", nil)
+			Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+			res := report(body)
+			Expect(res.Status).To(Equal(handler.HealthFail))
+			Expect(res.Checks["extra"].Error).To(Equal("dependency down"))
+			Expect(res.Checks["storage"].Status).To(Equal(handler.HealthOK))
+
+			//still live
+			w, _ = testReq(service.Mux, "GET", "/v1/api/health/live", nil)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			By("Failing ok")
+		})
+
+		It("should not be ready as soon as shutdown begins", func() {
+			service.Health.BeginShutdown()
+			w, body := testReq(service.Mux, "GET", "/v1/api/health/ready", nil)
+			Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(report(body).Checks["shutdown"].Error).To(Equal(handler.ErrShuttingDown.Error()))
+			By("Draining ok")
+		})
+	})
+})
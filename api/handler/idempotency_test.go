@@ -0,0 +1,182 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/tools"
+
+	"github.com/icrowley/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::IDEMPOTENCY", func() {
+
+	var service *routes.APIService
+	var formdata string
+
+	newService := func(opts ...routes.Setup) *routes.APIService {
+		svc, _ := routes.NewAPIService(append([]routes.Setup{
+			routes.WithSvcOptAddress(":8989"),
+			routes.WithSvcOptLogger(tools.NewLogger(tools.WithLoggerOptOutput(ioutil.Discard))),
+		}, opts...)...)
+		return svc
+	}
+
+	BeforeEach(func() {
+		service = newService()
+		formdata = fmt.Sprintf(`{"name":"building-%s","address":"address here"}`, fake.DigitsN(8))
+	})
+
+	post := func(path, key, body string) (int, http.Header, []byte) {
+		w, reply := testReqWithHeaders(service.Mux, "POST", path, bytes.NewReader([]byte(body)),
+			map[string]string{routes.IdempotencyHeader: key})
+		return w.Code, w.Header(), reply
+	}
+
+	problemCode := func(body []byte) string {
+		var problem handler.Problem
+		Expect(json.Unmarshal(body, &problem)).To(Succeed())
+		return problem.Code
+	}
+
+	Context("Retries", func() {
+
+		It("should replay the reply of the 1st create", func() {
+			code, _, body := post("/v1/api/building", "job-1", formdata)
+			Expect(code).To(Equal(http.StatusCreated))
+
+			code2, header2, body2 := post("/v1/api/building", "job-1", formdata)
+			Expect(code2).To(Equal(http.StatusCreated))
+			Expect(body2).To(Equal(body))
+			Expect(header2.Get(routes.IdempotencyReplayedHeader)).To(Equal("true"))
+			Expect(header2.Get("Content-Type")).To(ContainSubstring("application/json"))
+
+			//without the key it is a new create of the same name
+			code3, _, _ := post("/v1/api/building", "", formdata)
+			Expect(code3).To(Equal(http.StatusConflict))
+			By("Replay ok")
+		})
+
+		It("should encode the replay for the retry, not for the 1st request", func() {
+			gzipped := map[string]string{routes.IdempotencyHeader: "job-7", "Accept-Encoding": "gzip"}
+			w, _ := testReqWithHeaders(service.Mux, "POST", "/v1/api/building", bytes.NewReader([]byte(formdata)), gzipped)
+			Expect(w.Code).To(Equal(http.StatusCreated))
+			Expect(w.Header().Get("Content-Encoding")).To(Equal("gzip"))
+
+			code, header, body := post("/v1/api/building", "job-7", formdata)
+			Expect(code).To(Equal(http.StatusCreated))
+			Expect(header.Get(routes.IdempotencyReplayedHeader)).To(Equal("true"))
+			Expect(header.Get("Content-Encoding")).To(BeEmpty())
+			var response handler.Response
+			Expect(json.Unmarshal(body, &response)).To(Succeed())
+
+			w, _ = testReqWithHeaders(service.Mux, "POST", "/v1/api/building", bytes.NewReader([]byte(formdata)), gzipped)
+			Expect(w.Code).To(Equal(http.StatusCreated))
+			Expect(w.Header().Get("Content-Encoding")).To(Equal("gzip"))
+			By("Encoding ok")
+		})
+
+		It("should refuse a body over the limit", func() {
+			code, _, _ := post("/v1/api/building", "job-8", `{"name":"`+strings.Repeat("x", 16<<20)+`"}`)
+			Expect(code).To(Equal(http.StatusRequestEntityTooLarge))
+			By("Large ok")
+		})
+
+		It("should refuse the key with another body", func() {
+			code, _, _ := post("/v1/api/building", "job-2", formdata)
+			Expect(code).To(Equal(http.StatusCreated))
+			code, _, body := post("/v1/api/building", "job-2", `{"name":"another one"}`)
+			Expect(code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(problemCode(body)).To(Equal(handler.CodeIdempotencyMismatch))
+			By("Mismatch ok")
+		})
+
+		It("should cover the bulk end-point and keep the paths apart", func() {
+			bulk := fmt.Sprintf(`[{"op":"create","name":"building-%s"}]`, fake.DigitsN(8))
+			code, _, body := post("/v1/api/building/_bulk", "job-3", bulk)
+			Expect(code).To(Equal(http.StatusOK))
+			code, header, body2 := post("/v1/api/building/_bulk", "job-3", bulk)
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(body2).To(Equal(body))
+			Expect(header.Get(routes.IdempotencyReplayedHeader)).To(Equal("true"))
+
+			code, _, _ = post("/v1/api/building", "job-3", formdata)
+			Expect(code).To(Equal(http.StatusCreated))
+			By("Bulk ok")
+		})
+
+		It("should refuse a too long key", func() {
+			code, _, _ := post("/v1/api/building", string(bytes.Repeat([]byte("k"), 256)), formdata)
+			Expect(code).To(Equal(http.StatusBadRequest))
+			By("Long ok")
+		})
+	})
+
+	Context("Concurrency and failures", func() {
+
+		It("should give 409 to a duplicate while the 1st is running", func() {
+			started, release := make(chan struct{}), make(chan struct{})
+			service.Mux.With(service.Idempotent).Post("/v1/slow", func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				<-release
+				w.WriteHeader(http.StatusCreated)
+			})
+			done := make(chan int)
+			go func() {
+				code, _, _ := post("/v1/slow", "job-4", "{}")
+				done <- code
+			}()
+			<-started
+			code, header, body := post("/v1/slow", "job-4", "{}")
+			Expect(code).To(Equal(http.StatusConflict))
+			Expect(header.Get("Retry-After")).NotTo(BeEmpty())
+			Expect(problemCode(body)).To(Equal(handler.CodeIdempotencyInFlight))
+			close(release)
+			Expect(<-done).To(Equal(http.StatusCreated))
+
+			code, header, _ = post("/v1/slow", "job-4", "{}")
+			Expect(code).To(Equal(http.StatusCreated))
+			Expect(header.Get(routes.IdempotencyReplayedHeader)).To(Equal("true"))
+			By("In flight ok")
+		})
+
+		It("should run again after a server error", func() {
+			calls := 0
+			service.Mux.With(service.Idempotent).Post("/v1/flaky", func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+			})
+			code, _, _ := post("/v1/flaky", "job-5", "{}")
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+			code, _, _ = post("/v1/flaky", "job-5", "{}")
+			Expect(code).To(Equal(http.StatusCreated))
+			code, _, _ = post("/v1/flaky", "job-5", "{}")
+			Expect(code).To(Equal(http.StatusCreated))
+			Expect(calls).To(Equal(2))
+			By("Failure ok")
+		})
+
+		It("should forget the key after the ttl", func() {
+			service = newService(routes.WithSvcOptIdempotency(50*time.Millisecond, 0))
+			code, _, _ := post("/v1/api/building", "job-6", formdata)
+			Expect(code).To(Equal(http.StatusCreated))
+			time.Sleep(100 * time.Millisecond)
+			code, _, _ = post("/v1/api/building", "job-6", formdata)
+			Expect(code).To(Equal(http.StatusConflict))
+			By("TTL ok")
+		})
+	})
+})
@@ -0,0 +1,100 @@
+package handler_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/tools"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::LOGGING", func() {
+
+	var out *bytes.Buffer
+	var logger *tools.Logger
+	var service *routes.APIService
+
+	BeforeEach(func() {
+		out = new(bytes.Buffer)
+		logger = tools.NewLogger(
+			tools.WithLoggerOptOutput(out),
+			tools.WithLoggerOptLevel(tools.LevelDebug),
+			tools.WithLoggerOptRedact("address"),
+		)
+		service, _ = routes.NewAPIService(
+			routes.WithSvcOptAddress(":8989"),
+			routes.WithSvcOptLogger(logger),
+		)
+		out.Reset()
+	})
+
+	entries := func() []map[string]interface{} {
+		var rows []map[string]interface{}
+		scanner := bufio.NewScanner(bytes.NewReader(out.Bytes()))
+		for scanner.Scan() {
+			row := make(map[string]interface{})
+			Expect(json.Unmarshal(scanner.Bytes(), &row)).To(Succeed())
+			rows = append(rows, row)
+		}
+		return rows
+	}
+
+	Context("Request entries", func() {
+
+		It("should write 1 json line per request with its correlation fields", func() {
+			w, _ := testReq(service.Mux, "GET", "/v1/api/building/not-exists-id", nil)
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+			rows := entries()
+			Expect(rows).To(HaveLen(1))
+			row := rows[0]
+			Expect(row["msg"]).To(Equal("request"))
+			Expect(row["level"]).To(Equal("warn"))
+			Expect(row["time"]).NotTo(BeEmpty())
+			Expect(row["request_id"]).NotTo(BeEmpty())
+			Expect(row["route"]).To(Equal("/v1/api/building/{id}"))
+			Expect(row["status"]).To(BeEquivalentTo(http.StatusNotFound))
+			Expect(row["building_id"]).To(Equal("not-exists-id"))
+			Expect(row).To(HaveKey("latency_ms"))
+			By("Entry ok")
+		})
+
+		It("should attach the id of a created building", func() {
+			w, _ := testReq(service.Mux, "POST", "/v1/api/building",
+				bytes.NewReader([]byte(`{"name":"logged building","address":"somewhere"}`)))
+			Expect(w.Code).To(Equal(http.StatusCreated))
+			rows := entries()
+			Expect(rows).To(HaveLen(1))
+			Expect(rows[0]["level"]).To(Equal("info"))
+			Expect(rows[0]["building_id"]).NotTo(BeEmpty())
+			By("Created ok")
+		})
+	})
+
+	Context("Debug dump", func() {
+
+		It("should redact the configured and default fields", func() {
+			logger.Dump("payload", map[string]interface{}{
+				"name":     "visible",
+				"address":  "hidden street",
+				"password": "hunter2",
+			})
+			Expect(out.String()).NotTo(ContainSubstring("hidden street"))
+			Expect(out.String()).NotTo(ContainSubstring("hunter2"))
+			Expect(out.String()).To(ContainSubstring("visible"))
+			Expect(out.String()).To(ContainSubstring(tools.Redacted))
+			By("Redact ok")
+		})
+
+		It("should skip the dump above debug level", func() {
+			quiet := tools.NewLogger(tools.WithLoggerOptOutput(out))
+			quiet.Dump("payload", "anything")
+			Expect(out.Len()).To(BeZero())
+			By("Level ok")
+		})
+	})
+})
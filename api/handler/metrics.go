@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/configs"
+	"github.com/bayugyug/building-custom-api/tools"
+)
+
+// ContentTypeMetrics the prometheus text exposition format
+const ContentTypeMetrics = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metrics the telemetry end-point
+type Metrics struct {
+	Registry *tools.Metrics
+}
+
+// NewMetrics new instance, the go runtime stats included
+func NewMetrics() *Metrics {
+	registry := tools.NewMetrics()
+	started := float64(time.Now().Unix())
+	registry.Collect(func() []tools.Sample {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		return []tools.Sample{
+			{Name: "go_info", Help: "Information about the Go environment.", Type: tools.MetricGauge,
+				Labels: map[string]string{"version": runtime.Version()}, Value: 1},
+			{Name: "building_api_info", Help: "Build of the service.", Type: tools.MetricGauge,
+				Labels: map[string]string{"release": configs.Release, "commit": configs.Commit}, Value: 1},
+			{Name: "process_start_time_seconds", Help: "Start time of the process since unix epoch in seconds.",
+				Type: tools.MetricGauge, Value: started},
+			{Name: "go_goroutines", Help: "Number of goroutines that currently exist.",
+				Type: tools.MetricGauge, Value: float64(runtime.NumGoroutine())},
+			{Name: "go_memstats_alloc_bytes", Help: "Number of bytes allocated and still in use.",
+				Type: tools.MetricGauge, Value: float64(mem.Alloc)},
+			{Name: "go_memstats_sys_bytes", Help: "Number of bytes obtained from system.",
+				Type: tools.MetricGauge, Value: float64(mem.Sys)},
+			{Name: "go_memstats_heap_objects", Help: "Number of allocated objects.",
+				Type: tools.MetricGauge, Value: float64(mem.HeapObjects)},
+			{Name: "go_memstats_mallocs_total", Help: "Total number of mallocs.",
+				Type: tools.MetricCounter, Value: float64(mem.Mallocs)},
+			{Name: "go_gc_cycles_total", Help: "Number of completed GC cycles.",
+				Type: tools.MetricCounter, Value: float64(mem.NumGC)},
+			{Name: "go_gc_pause_seconds_total", Help: "Total GC pause time in seconds.",
+				Type: tools.MetricCounter, Value: float64(mem.PauseTotalNs) / float64(time.Second)},
+		}
+	})
+	return &Metrics{Registry: registry}
+}
+
+// Scrape render the metrics for prometheus
+func (m *Metrics) Scrape(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentTypeMetrics)
+	m.Registry.WriteTo(w)
+}
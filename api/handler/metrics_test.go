@@ -0,0 +1,50 @@
+package handler_test
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/api/routes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::METRICS", func() {
+	//init
+	service, _ := routes.NewAPIService(
+		routes.WithSvcOptAddress(":8989"),
+	)
+
+	Context("Metrics end-point", func() {
+
+		It("should count the requests per route and status", func() {
+			testReq(service.Mux, "POST", "/v1/api/building",
+				bytes.NewReader([]byte(`{"name":"metered building","address":"somewhere"}`)))
+			testReq(service.Mux, "GET", "/v1/api/building/not-exists-id", nil)
+			testReq(service.Mux, "GET", "/v1/api/building/another-id", nil)
+
+			w, body := testReq(service.Mux, "GET", "/metrics", nil)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Header().Get("Content-Type")).To(Equal(handler.ContentTypeMetrics))
+			out := string(body)
+			Expect(out).To(ContainSubstring(`http_requests_total{method="POST",route="/v1/api/building",status="201"} 1`))
+			Expect(out).To(ContainSubstring(`http_requests_total{method="GET",route="/v1/api/building/{id}",status="404"} 2`))
+			Expect(out).To(ContainSubstring(`http_request_duration_seconds_count{method="GET",route="/v1/api/building/{id}",status="404"} 2`))
+			Expect(out).NotTo(ContainSubstring("not-exists-id"))
+			By("Requests ok")
+		})
+
+		It("should expose the storage and runtime stats", func() {
+			_, body := testReq(service.Mux, "GET", "/metrics", nil)
+			out := string(body)
+			Expect(out).To(ContainSubstring("# TYPE storage_records gauge"))
+			Expect(out).To(ContainSubstring(`storage_operations_total{op="batch",result="ok"}`))
+			Expect(out).To(ContainSubstring("# TYPE go_goroutines gauge"))
+			Expect(out).To(ContainSubstring("go_memstats_alloc_bytes "))
+			Expect(out).To(ContainSubstring("go_info{version="))
+			By("Stats ok")
+		})
+	})
+})
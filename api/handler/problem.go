@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bayugyug/building-custom-api/auth"
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/models"
+	"github.com/bayugyug/building-custom-api/tools"
+	"github.com/bayugyug/building-custom-api/webhooks"
+)
+
+const (
+	// ContentTypeProblem RFC 7807 error reply
+	ContentTypeProblem = "application/problem+json"
+	// ProblemTypePrefix type of the problem is this prefix plus the code
+	ProblemTypePrefix = "urn:building-api:problem:"
+)
+
+// stable error codes, clients branch on these
+const (
+	CodeInvalidBody          = "invalid_body"
+	CodeMissingParameter     = "missing_parameter"
+	CodeInvalidParameter     = "invalid_parameter"
+	CodeValidationFailed     = "validation_failed"
+	CodeRecordNotFound       = "record_not_found"
+	CodeRecordExists         = "record_exists"
+	CodeRecordMismatch       = "record_mismatch"
+	CodeRecordInUse          = "record_in_use"
+	CodeRecordChanged        = "record_changed"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodePatchTestFailed      = "patch_test_failed"
+	CodeBulkAborted          = "bulk_aborted"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeRateLimited          = "rate_limited"
+	CodeIdempotencyMismatch  = "idempotency_key_reused"
+	CodeIdempotencyInFlight  = "idempotency_key_in_use"
+	CodeStreamUnsupported    = "stream_unsupported"
+	CodeShuttingDown         = "shutting_down"
+	CodeStorageFailed        = "storage_failed"
+	CodeStorageClosed        = "storage_closed"
+	CodeInternal             = "internal_error"
+)
+
+// Problem RFC 7807 error reply with a stable code and the fields at fault
+type Problem struct {
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Code     string              `json:"code"`
+	Detail   string              `json:"detail,omitempty"`
+	Instance string              `json:"instance,omitempty"`
+	Errors   []models.FieldError `json:"errors,omitempty"`
+	Items    interface{}         `json:"items,omitempty"`
+}
+
+// problemKind status and code of a known error
+type problemKind struct {
+	status int
+	code   string
+}
+
+// problemKinds every error the models and drivers give back
+var problemKinds = map[error]problemKind{
+	models.ErrMissingRequiredParameters: {http.StatusBadRequest, CodeMissingParameter},
+	models.ErrInvalidParameters:         {http.StatusBadRequest, CodeInvalidParameter},
+	models.ErrRecordNotFound:            {http.StatusNotFound, CodeRecordNotFound},
+	models.ErrRecordsNotFound:           {http.StatusNotFound, CodeRecordNotFound},
+	models.ErrRecordExists:              {http.StatusConflict, CodeRecordExists},
+	models.ErrRecordMismatch:            {http.StatusConflict, CodeRecordMismatch},
+	models.ErrRecordInUse:               {http.StatusConflict, CodeRecordInUse},
+	models.ErrPreconditionFailed:        {http.StatusPreconditionFailed, CodePreconditionFailed},
+	models.ErrUnsupportedPatch:          {http.StatusUnsupportedMediaType, CodeUnsupportedMediaType},
+	models.ErrPatchTestFailed:           {http.StatusConflict, CodePatchTestFailed},
+	models.ErrBulkAborted:               {http.StatusUnprocessableEntity, CodeBulkAborted},
+	models.ErrDBTransaction:             {http.StatusInternalServerError, CodeStorageFailed},
+	drivers.ErrRecordNotFound:           {http.StatusNotFound, CodeRecordNotFound},
+	drivers.ErrRecordExists:             {http.StatusConflict, CodeRecordExists},
+	drivers.ErrRecordChanged:            {http.StatusConflict, CodeRecordChanged},
+	drivers.ErrStorageClosed:            {http.StatusServiceUnavailable, CodeStorageClosed},
+	auth.ErrUnauthenticated:             {http.StatusUnauthorized, CodeUnauthorized},
+	auth.ErrInvalidCredentials:          {http.StatusUnauthorized, CodeUnauthorized},
+	auth.ErrTokenExpired:                {http.StatusUnauthorized, CodeUnauthorized},
+	auth.ErrNoVerifyKey:                 {http.StatusUnauthorized, CodeUnauthorized},
+	auth.ErrForbidden:                   {http.StatusForbidden, CodeForbidden},
+	webhooks.ErrInvalidURL:              {http.StatusBadRequest, CodeInvalidParameter},
+	webhooks.ErrPrivateURL:              {http.StatusBadRequest, CodeInvalidParameter},
+	webhooks.ErrUnknownEvent:            {http.StatusBadRequest, CodeInvalidParameter},
+	webhooks.ErrNotFound:                {http.StatusNotFound, CodeRecordNotFound},
+	webhooks.ErrNoChanges:               {http.StatusNotImplemented, CodeStreamUnsupported},
+	webhooks.ErrClosed:                  {http.StatusServiceUnavailable, CodeShuttingDown},
+}
+
+// NewProblem new instance
+func NewProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   ProblemTypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// ProblemFrom map the error to its problem, unknown errors are internal
+func ProblemFrom(err error) *Problem {
+	switch e := err.(type) {
+	case *Problem:
+		return e
+	case *models.ValidationError:
+		p := NewProblem(http.StatusBadRequest, CodeValidationFailed, e.Error())
+		p.Errors = e.Fields
+		return p
+	}
+	if kind, ok := problemKinds[err]; ok {
+		return NewProblem(kind.status, kind.code, err.Error())
+	}
+	//the real text only goes to the log, it may tell too much
+	return NewProblem(http.StatusInternalServerError, CodeInternal, "internal server error")
+}
+
+// Error message of the problem
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// ReplyProblem send the problem as application/problem+json
+func (b *Building) ReplyProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	raw, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(p.Status)
+	w.Write(raw)
+}
+
+// ReplyErr send the problem of the error
+func (b *Building) ReplyErr(w http.ResponseWriter, r *http.Request, err error) {
+	p := ProblemFrom(err)
+	if p.Status >= http.StatusInternalServerError {
+		tools.LoggerFrom(r.Context()).Error("request failed", tools.Fields{"error": err, "code": p.Code})
+	}
+	b.ReplyProblem(w, r, p)
+}
+
+// readProblem problem of a body that could not be read
+func readProblem(err error) *Problem {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return NewProblem(http.StatusRequestEntityTooLarge, CodeInvalidBody, fmt.Sprintf("body is over %d bytes", tooLarge.Limit))
+	}
+	return NewProblem(http.StatusBadRequest, CodeInvalidBody, err.Error())
+}
+
+// ReplyBindErr send the problem of a failed bind, naming the fields at fault
+func (b *Building) ReplyBindErr(w http.ResponseWriter, r *http.Request, err error) {
+	var p *Problem
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		p = NewProblem(http.StatusBadRequest, CodeInvalidBody, fmt.Sprintf("malformed json at offset %d", e.Offset))
+	case *json.UnmarshalTypeError:
+		p = NewProblem(http.StatusBadRequest, CodeInvalidBody, "field has the wrong type")
+		p.Errors = []models.FieldError{{Field: e.Field, Rule: "type", Message: "must be " + e.Type.String()}}
+	default:
+		if err == io.EOF {
+			p = NewProblem(http.StatusBadRequest, CodeInvalidBody, "request body is empty")
+			break
+		}
+		if _, ok := err.(*models.ValidationError); !ok {
+			if _, ok := problemKinds[err]; !ok {
+				p = NewProblem(http.StatusBadRequest, CodeInvalidBody, err.Error())
+				break
+			}
+		}
+		p = ProblemFrom(err)
+	}
+	b.ReplyProblem(w, r, p)
+}
@@ -0,0 +1,97 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/models"
+
+	"github.com/go-chi/chi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::PROBLEMS", func() {
+	//init
+	service, _ := routes.NewAPIService(
+		routes.WithSvcOptAddress(":8989"),
+	)
+
+	var router *chi.Mux
+
+	BeforeEach(func() {
+		router = chi.NewRouter()
+		router.Post("/v1/api/building", service.Building.Create)
+		router.Get("/v1/api/building/{id}", service.Building.GetOne)
+		router.Post("/v1/api/building/{id}/floors", service.Building.CreateFloor)
+	})
+
+	problem := func(body []byte) *handler.Problem {
+		p := &handler.Problem{}
+		if err := json.Unmarshal(body, p); err != nil {
+			Fail(err.Error())
+		}
+		return p
+	}
+
+	Context("Error replies", func() {
+
+		It("should render problem+json with a stable code", func() {
+			w, body := testReq(router, "GET", "/v1/api/building/not-exists-id", nil)
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+			Expect(w.Header().Get("Content-Type")).To(Equal(handler.ContentTypeProblem))
+			p := problem(body)
+			Expect(p.Status).To(Equal(http.StatusNotFound))
+			Expect(p.Code).To(Equal(handler.CodeRecordNotFound))
+			Expect(p.Type).To(Equal(handler.ProblemTypePrefix + handler.CodeRecordNotFound))
+			Expect(p.Instance).To(Equal("/v1/api/building/not-exists-id"))
+			By("Problem ok")
+		})
+
+		It("should name the fields at fault", func() {
+			w, body := testReq(router, "POST", "/v1/api/building",
+				bytes.NewReader([]byte(`{"address":"somewhere"}`)))
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+			p := problem(body)
+			Expect(p.Code).To(Equal(handler.CodeValidationFailed))
+			Expect(p.Errors).To(ContainElement(models.FieldError{Field: "name", Rule: models.RuleRequired, Message: "is required"}))
+			By("Missing field ok")
+
+			w2, body2 := testReq(router, "POST", "/v1/api/building",
+				bytes.NewReader([]byte(`{"name":42}`)))
+			Expect(w2.Code).To(Equal(http.StatusBadRequest))
+			p2 := problem(body2)
+			Expect(p2.Code).To(Equal(handler.CodeInvalidBody))
+			Expect(len(p2.Errors)).To(Equal(1))
+			Expect(p2.Errors[0].Field).To(Equal("name"))
+			By("Wrong type ok")
+
+			w3, body3 := testReq(router, "POST", "/v1/api/building",
+				bytes.NewReader([]byte(`{"name":`)))
+			Expect(w3.Code).To(Equal(http.StatusBadRequest))
+			Expect(problem(body3).Code).To(Equal(handler.CodeInvalidBody))
+			By("Malformed body ok")
+
+			w4, body4 := testReq(router, "POST", "/v1/api/building/not-exists-id/floors",
+				bytes.NewReader([]byte(`{"label":"no level","gross_area":-1}`)))
+			Expect(w4.Code).To(Equal(http.StatusBadRequest))
+			Expect(len(problem(body4).Errors)).To(Equal(2))
+			By("Floor fields ok")
+		})
+
+		It("should map the model and driver errors", func() {
+			Expect(handler.ProblemFrom(models.ErrPreconditionFailed).Status).To(Equal(http.StatusPreconditionFailed))
+			Expect(handler.ProblemFrom(models.ErrRecordInUse).Code).To(Equal(handler.CodeRecordInUse))
+			Expect(handler.ProblemFrom(drivers.ErrRecordNotFound).Code).To(Equal(handler.CodeRecordNotFound))
+			Expect(handler.ProblemFrom(drivers.ErrStorageClosed).Status).To(Equal(http.StatusServiceUnavailable))
+			Expect(handler.ProblemFrom(errors.New("boom")).Code).To(Equal(handler.CodeInternal))
+			Expect(handler.ProblemFrom(errors.New("boom")).Detail).To(Equal("internal server error"))
+			By("Mapping ok")
+		})
+	})
+})
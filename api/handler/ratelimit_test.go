@@ -0,0 +1,158 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/auth"
+	"github.com/bayugyug/building-custom-api/configs"
+	"github.com/bayugyug/building-custom-api/tools"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::RATE LIMIT", func() {
+
+	var service *routes.APIService
+
+	budgets := func(read, write, clients int) *configs.RateLimitConfig {
+		return &configs.RateLimitConfig{
+			Read:       &configs.RateBudget{Requests: read, Per: configs.Duration(time.Hour)},
+			Write:      &configs.RateBudget{Requests: write, Per: configs.Duration(time.Hour)},
+			MaxClients: clients,
+		}
+	}
+
+	BeforeEach(func() {
+		service, _ = routes.NewAPIService(
+			routes.WithSvcOptAddress(":8989"),
+			routes.WithSvcOptLogger(tools.NewLogger(tools.WithLoggerOptOutput(ioutil.Discard))),
+			routes.WithSvcOptRateLimit(budgets(3, 1, 2)),
+		)
+	})
+
+	from := func(client, method, path string) *http.Response {
+		w, _ := testReqWithHeaders(service.Mux, method, path, nil, map[string]string{"X-Real-IP": client})
+		return w.Result()
+	}
+
+	Context("Budgets", func() {
+
+		It("should count down then refuse with 429", func() {
+			for i := 2; i >= 0; i-- {
+				res := from("10.0.0.1", "GET", "/v1/api/building/unknown")
+				Expect(res.StatusCode).To(Equal(http.StatusNotFound))
+				Expect(res.Header.Get("RateLimit-Limit")).To(Equal("3"))
+				Expect(res.Header.Get("RateLimit-Remaining")).To(Equal(strconv.Itoa(i)))
+			}
+			w, body := testReqWithHeaders(service.Mux, "GET", "/v1/api/building/unknown", nil,
+				map[string]string{"X-Real-IP": "10.0.0.1"})
+			Expect(w.Code).To(Equal(http.StatusTooManyRequests))
+			retry, err := strconv.Atoi(w.Header().Get("Retry-After"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retry).To(BeNumerically(">", 1000))
+			Expect(w.Header().Get("RateLimit-Reset")).To(Equal("3600"))
+			var problem handler.Problem
+			Expect(json.Unmarshal(body, &problem)).To(Succeed())
+			Expect(problem.Code).To(Equal(handler.CodeRateLimited))
+			By("Budget ok")
+		})
+
+		It("should keep reads, writes and clients apart", func() {
+			Expect(from("10.0.0.1", "DELETE", "/v1/api/building/unknown").StatusCode).To(Equal(http.StatusNotFound))
+			Expect(from("10.0.0.1", "DELETE", "/v1/api/building/unknown").StatusCode).To(Equal(http.StatusTooManyRequests))
+			Expect(from("10.0.0.1", "GET", "/v1/api/building/unknown").StatusCode).To(Equal(http.StatusNotFound))
+			Expect(from("10.0.0.2", "DELETE", "/v1/api/building/unknown").StatusCode).To(Equal(http.StatusNotFound))
+			By("Apart ok")
+		})
+
+		It("should not limit the probes", func() {
+			for i := 0; i < 5; i++ {
+				res := from("10.0.0.1", "GET", "/v1/api/health/live")
+				Expect(res.StatusCode).To(Equal(http.StatusOK))
+				Expect(res.Header.Get("RateLimit-Limit")).To(BeEmpty())
+			}
+			By("Probes ok")
+		})
+	})
+
+	Context("Failed credentials", func() {
+
+		It("should count them against the client address before checking them", func() {
+			keys, err := auth.NewAPIKeys(auth.APIKey{Name: "ci", Hash: auth.HashAPIKey("ci-key"), Roles: []string{"editor"}})
+			if err != nil {
+				Fail(err.Error())
+			}
+			service, _ = routes.NewAPIService(
+				routes.WithSvcOptAddress(":8989"),
+				routes.WithSvcOptLogger(tools.NewLogger(tools.WithLoggerOptOutput(ioutil.Discard))),
+				routes.WithSvcOptAuth(auth.Chain{keys}),
+				routes.WithSvcOptRateLimit(budgets(3, 1, 10)),
+			)
+			with := func(client, key string) int {
+				w, _ := testReqWithHeaders(service.Mux, "GET", "/v1/api/building/unknown", nil,
+					map[string]string{"X-Real-IP": client, auth.APIKeyHeader: key})
+				return w.Code
+			}
+			for i := 0; i < 3; i++ {
+				Expect(with("10.0.0.1", "guess")).To(Equal(http.StatusUnauthorized))
+			}
+			Expect(with("10.0.0.1", "guess")).To(Equal(http.StatusTooManyRequests))
+			//not even the right key is checked from there
+			Expect(with("10.0.0.1", "ci-key")).To(Equal(http.StatusTooManyRequests))
+			Expect(with("10.0.0.2", "ci-key")).To(Equal(http.StatusNotFound))
+			By("Failed credentials ok")
+		})
+	})
+
+	Context("Bounded state", func() {
+
+		It("should drop the least recently seen client past the max", func() {
+			from("10.0.0.1", "DELETE", "/v1/api/building/unknown")
+			Expect(from("10.0.0.1", "DELETE", "/v1/api/building/unknown").StatusCode).To(Equal(http.StatusTooManyRequests))
+			from("10.0.0.2", "DELETE", "/v1/api/building/unknown")
+			from("10.0.0.3", "DELETE", "/v1/api/building/unknown")
+			//10.0.0.1 was dropped, it starts over
+			Expect(from("10.0.0.1", "DELETE", "/v1/api/building/unknown").StatusCode).To(Equal(http.StatusNotFound))
+			By("Bounded ok")
+		})
+
+		It("should drop the idle clients", func() {
+			now := time.Now()
+			limiter := tools.NewLimiter(1, time.Hour,
+				tools.WithLimiterOptIdle(time.Minute),
+				tools.WithLimiterOptClock(func() time.Time { return now }))
+			Expect(limiter.Allow("a").Allowed).To(BeTrue())
+			Expect(limiter.Allow("a").Allowed).To(BeFalse())
+			now = now.Add(2 * time.Minute)
+			Expect(limiter.Allow("b").Allowed).To(BeTrue())
+			Expect(limiter.Len()).To(Equal(1))
+			Expect(limiter.Allow("a").Allowed).To(BeTrue())
+			By("Idle ok")
+		})
+	})
+
+	Context("Reload", func() {
+
+		It("should apply the new budgets without a restart", func() {
+			from("10.0.0.1", "DELETE", "/v1/api/building/unknown")
+			Expect(from("10.0.0.1", "DELETE", "/v1/api/building/unknown").StatusCode).To(Equal(http.StatusTooManyRequests))
+
+			service.Reload(&configs.ParameterConfig{RateLimit: budgets(3, 5, 2)})
+			res := from("10.0.0.1", "DELETE", "/v1/api/building/unknown")
+			Expect(res.StatusCode).To(Equal(http.StatusNotFound))
+			Expect(res.Header.Get("RateLimit-Limit")).To(Equal("5"))
+
+			service.Reload(&configs.ParameterConfig{})
+			res = from("10.0.0.1", "DELETE", "/v1/api/building/unknown")
+			Expect(res.Header.Get("RateLimit-Limit")).To(BeEmpty())
+			By("Reload ok")
+		})
+	})
+})
@@ -0,0 +1,65 @@
+package handler_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/configs"
+	"github.com/bayugyug/building-custom-api/tools"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::RELOAD", func() {
+
+	var service *routes.APIService
+	var out *bytes.Buffer
+
+	BeforeEach(func() {
+		out = new(bytes.Buffer)
+		service, _ = routes.NewAPIService(
+			routes.WithSvcOptAddress(":8989"),
+			routes.WithSvcOptLogger(tools.NewLogger(tools.WithLoggerOptOutput(out))),
+			routes.WithSvcOptCORS(routes.CORSOptions(&configs.CORSConfig{
+				AllowedOrigins: []string{"https://old.example.com"},
+			})),
+		)
+	})
+
+	origin := func(from string) string {
+		req, _ := http.NewRequest("GET", "/v1/api/health/live", nil)
+		req.Header.Set("Origin", from)
+		w := httptest.NewRecorder()
+		service.Mux.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	Context("Safe settings", func() {
+
+		It("should swap the CORS origins without a restart", func() {
+			Expect(origin("https://old.example.com")).To(Equal("https://old.example.com"))
+			Expect(origin("https://new.example.com")).To(BeEmpty())
+
+			service.Reload(&configs.ParameterConfig{Server: &configs.ServerConfig{
+				CORS: &configs.CORSConfig{AllowedOrigins: []string{"https://new.example.com"}},
+			}})
+			Expect(origin("https://new.example.com")).To(Equal("https://new.example.com"))
+			Expect(origin("https://old.example.com")).To(BeEmpty())
+			By("CORS ok")
+		})
+
+		It("should change the log level of the request logger", func() {
+			testReq(service.Mux, "GET", "/v1/api/health/live", nil)
+			Expect(out.Len()).NotTo(BeZero())
+
+			service.Reload(&configs.ParameterConfig{Log: &configs.LogConfig{Level: "error"}})
+			out.Reset()
+			testReq(service.Mux, "GET", "/v1/api/health/live", nil)
+			Expect(out.Len()).To(BeZero())
+			By("Level ok")
+		})
+	})
+})
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/models"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+// RoomEndpoints the room sub-resource end-points-url mapping
+type RoomEndpoints interface {
+	CreateRoom(w http.ResponseWriter, r *http.Request)
+	UpdateRoom(w http.ResponseWriter, r *http.Request)
+	GetRooms(w http.ResponseWriter, r *http.Request)
+	GetRoom(w http.ResponseWriter, r *http.Request)
+	DeleteRoom(w http.ResponseWriter, r *http.Request)
+}
+
+// CreateRoom add a room to the floor
+func (b *Building) CreateRoom(w http.ResponseWriter, r *http.Request) {
+	data := models.NewRoomCreate(
+		strings.TrimSpace(chi.URLParam(r, "id")),
+		strings.TrimSpace(chi.URLParam(r, "floorId")),
+	)
+	//sanity check
+	if err := render.Bind(r, data); err != nil {
+		//400
+		b.ReplyBindErr(w, r, err)
+		return
+	}
+	data.IfMatch = r.Header.Get("If-Match")
+	pid, err := data.Create(b.Storage)
+	//chk
+	if err != nil {
+		b.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: pid,
+	})
+}
+
+// UpdateRoom replace the room fields
+func (b *Building) UpdateRoom(w http.ResponseWriter, r *http.Request) {
+	data := models.NewRoomUpdate(
+		strings.TrimSpace(chi.URLParam(r, "id")),
+		strings.TrimSpace(chi.URLParam(r, "floorId")),
+		strings.TrimSpace(chi.URLParam(r, "roomId")),
+	)
+	//sanity check
+	if err := render.Bind(r, data); err != nil {
+		//400
+		b.ReplyBindErr(w, r, err)
+		return
+	}
+	data.IfMatch = r.Header.Get("If-Match")
+	row, err := data.Update(b.Storage)
+	//chk
+	if err != nil {
+		b.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: row,
+	})
+}
+
+// GetRooms list the rooms of the floor
+func (b *Building) GetRooms(w http.ResponseWriter, r *http.Request) {
+	data := models.NewRoomGet(
+		strings.TrimSpace(chi.URLParam(r, "id")),
+		strings.TrimSpace(chi.URLParam(r, "floorId")),
+		"",
+	)
+	rows, err := data.GetAll(b.Storage)
+	//chk
+	if err != nil {
+		b.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: rows,
+		Total:  len(rows),
+	})
+}
+
+// GetRoom get 1 room of the floor
+func (b *Building) GetRoom(w http.ResponseWriter, r *http.Request) {
+	data := models.NewRoomGet(
+		strings.TrimSpace(chi.URLParam(r, "id")),
+		strings.TrimSpace(chi.URLParam(r, "floorId")),
+		strings.TrimSpace(chi.URLParam(r, "roomId")),
+	)
+	row, err := data.Get(b.Storage)
+	//chk
+	if err != nil {
+		b.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: row,
+	})
+}
+
+// DeleteRoom remove the room from the floor
+func (b *Building) DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	data := models.NewRoomDelete(
+		strings.TrimSpace(chi.URLParam(r, "id")),
+		strings.TrimSpace(chi.URLParam(r, "floorId")),
+		strings.TrimSpace(chi.URLParam(r, "roomId")),
+	)
+	data.IfMatch = r.Header.Get("If-Match")
+	//chk
+	if err := data.Delete(b.Storage); err != nil {
+		b.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+	})
+}
@@ -0,0 +1,118 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/tools"
+
+	"github.com/go-chi/chi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::ROOM-HANDLERS", func() {
+	//init
+	service, _ := routes.NewAPIService(
+		routes.WithSvcOptAddress(":8989"),
+	)
+
+	var router *chi.Mux
+	var pid string
+
+	BeforeEach(func() {
+		router = chi.NewRouter()
+		router.Post("/v1/api/building", service.Building.Create)
+		router.Get("/v1/api/building/{id}", service.Building.GetOne)
+		router.Delete("/v1/api/building/{id}/floors/{floorId}", service.Building.DeleteFloor)
+		router.Get("/v1/api/building/{id}/floors/{floorId}/rooms", service.Building.GetRooms)
+		router.Post("/v1/api/building/{id}/floors/{floorId}/rooms", service.Building.CreateRoom)
+		router.Get("/v1/api/building/{id}/floors/{floorId}/rooms/{roomId}", service.Building.GetRoom)
+		router.Put("/v1/api/building/{id}/floors/{floorId}/rooms/{roomId}", service.Building.UpdateRoom)
+		router.Delete("/v1/api/building/{id}/floors/{floorId}/rooms/{roomId}", service.Building.DeleteRoom)
+
+		w, body := testReq(router, "POST", "/v1/api/building",
+			bytes.NewReader([]byte(tools.Seeder{}.Create())))
+		var response handler.Response
+		if err := json.Unmarshal(body, &response); err != nil {
+			Fail(err.Error())
+		}
+		Expect(w.Code).To(Equal(http.StatusCreated))
+		pid, _ = response.Result.(string)
+	})
+
+	Context("Valid parameters", func() {
+
+		It("should manage the rooms", func() {
+			rooms := "/v1/api/building/" + pid + "/floors/floor-1/rooms"
+			w, body := testReq(router, "POST", rooms,
+				bytes.NewReader([]byte(`{"code":"101","type":"office","capacity":4,"area":32.5,"occupied":true}`)))
+			var response handler.Response
+			if err := json.Unmarshal(body, &response); err != nil {
+				Fail(err.Error())
+			}
+			Expect(w.Code).To(Equal(http.StatusCreated))
+			rid, _ := response.Result.(string)
+			By("Create room ok")
+
+			w2, _ := testReq(router, "PUT", rooms+"/"+rid,
+				bytes.NewReader([]byte(`{"code":"101","type":"office","capacity":6}`)))
+			Expect(w2.Code).To(Equal(http.StatusOK))
+			w3, body3 := testReq(router, "GET", rooms+"/"+rid, nil)
+			Expect(w3.Code).To(Equal(http.StatusOK))
+			Expect(string(body3)).To(ContainSubstring(`"capacity":6`))
+			By("Update room ok")
+
+			w4, body4 := testReq(router, "GET", rooms, nil)
+			var response4 handler.Response
+			if err := json.Unmarshal(body4, &response4); err != nil {
+				Fail(err.Error())
+			}
+			Expect(w4.Code).To(Equal(http.StatusOK))
+			Expect(response4.Total).To(Equal(1))
+			w5, body5 := testReq(router, "GET", "/v1/api/building/"+pid, nil)
+			Expect(w5.Code).To(Equal(http.StatusOK))
+			Expect(string(body5)).To(ContainSubstring(`"occupancy":{"rooms":1`))
+			By("List rooms and roll-up ok")
+
+			w6, _ := testReq(router, "DELETE", rooms+"/"+rid, nil)
+			Expect(w6.Code).To(Equal(http.StatusOK))
+			w7, _ := testReq(router, "GET", rooms+"/"+rid, nil)
+			Expect(w7.Code).To(Equal(http.StatusNotFound))
+			By("Delete room ok")
+		})
+
+		It("should delete a floor with rooms only on cascade", func() {
+			floor := "/v1/api/building/" + pid + "/floors/floor-1"
+			w, _ := testReq(router, "POST", floor+"/rooms",
+				bytes.NewReader([]byte(`{"code":"101"}`)))
+			Expect(w.Code).To(Equal(http.StatusCreated))
+			w2, _ := testReq(router, "DELETE", floor, nil)
+			Expect(w2.Code).To(Equal(http.StatusConflict))
+			w3, _ := testReq(router, "DELETE", floor+"?cascade=maybe", nil)
+			Expect(w3.Code).To(Equal(http.StatusBadRequest))
+			w4, _ := testReq(router, "DELETE", floor+"?cascade=true", nil)
+			Expect(w4.Code).To(Equal(http.StatusOK))
+			By("Cascade delete ok")
+		})
+	})
+
+	Context("Invalid parameters", func() {
+
+		It("should reject a duplicate or missing code", func() {
+			rooms := "/v1/api/building/" + pid + "/floors/floor-1/rooms"
+			w, _ := testReq(router, "POST", rooms, bytes.NewReader([]byte(`{"code":"101"}`)))
+			Expect(w.Code).To(Equal(http.StatusCreated))
+			w2, _ := testReq(router, "POST", rooms, bytes.NewReader([]byte(`{"code":"101"}`)))
+			Expect(w2.Code).To(Equal(http.StatusConflict))
+			w3, _ := testReq(router, "POST", rooms, bytes.NewReader([]byte(`{"type":"office"}`)))
+			Expect(w3.Code).To(Equal(http.StatusBadRequest))
+			w4, _ := testReq(router, "GET", "/v1/api/building/"+pid+"/floors/floor-9/rooms", nil)
+			Expect(w4.Code).To(Equal(http.StatusNotFound))
+			By("Invalid room requests rejected")
+		})
+	})
+})
@@ -0,0 +1,118 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/api/routes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::LIFECYCLE", func() {
+
+	var service *routes.APIService
+	var ln net.Listener
+
+	BeforeEach(func() {
+		var err error
+		service, _ = routes.NewAPIService(
+			routes.WithSvcOptAddress("127.0.0.1:0"),
+			routes.WithSvcOptDrainTimeout(2*time.Second),
+		)
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	serve := func(ctx context.Context) chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- service.Serve(ctx, ln)
+		}()
+		return done
+	}
+
+	get := func(path string) (int, string) {
+		res, err := http.Get("http://" + ln.Addr().String() + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return res.StatusCode, string(body)
+	}
+
+	Context("Start and stop", func() {
+
+		It("should stop on ctx and run the hooks in order", func() {
+			var order []string
+			service.OnShutdown("first", func(ctx context.Context) error {
+				order = append(order, "first")
+				return nil
+			})
+			service.OnShutdown("second", func(ctx context.Context) error {
+				order = append(order, "second")
+				return nil
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			done := serve(ctx)
+			Eventually(func() int {
+				code, _ := get("/v1/api/health/live")
+				return code
+			}).Should(Equal(http.StatusOK))
+
+			cancel()
+			Eventually(done, 3*time.Second).Should(Receive(BeNil()))
+			Expect(order).To(Equal([]string{"first", "second"}))
+			Expect(service.Health.ShuttingDown()).To(BeTrue())
+			By("Stop ok")
+		})
+
+		It("should let the in-flight requests finish", func() {
+			started := make(chan struct{})
+			service.Mux.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				time.Sleep(200 * time.Millisecond)
+				w.Write([]byte("drained"))
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			done := serve(ctx)
+			replied := make(chan string, 1)
+			go func() {
+				defer GinkgoRecover()
+				_, body := get("/slow")
+				replied <- body
+			}()
+			Eventually(started).Should(BeClosed())
+			cancel()
+			Eventually(replied, 3*time.Second).Should(Receive(Equal("drained")))
+			Eventually(done, 3*time.Second).Should(Receive(BeNil()))
+			By("Drain ok")
+		})
+
+		It("should give back the hook error", func() {
+			failed := errors.New("flush failed")
+			service.OnShutdown("storage", func(ctx context.Context) error {
+				return failed
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			done := serve(ctx)
+			cancel()
+			Eventually(done, 3*time.Second).Should(Receive(Equal(failed)))
+			By("Hook error ok")
+		})
+
+		It("should give back a bind failure instead of exiting", func() {
+			taken, _ := routes.NewAPIService(
+				routes.WithSvcOptAddress(ln.Addr().String()),
+			)
+			err := taken.Start(context.Background())
+			Expect(err).To(HaveOccurred())
+			ln.Close()
+			By("Bind error ok")
+		})
+	})
+})
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/webhooks"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+// WebhookEndpoints the webhook end-points-url mapping
+type WebhookEndpoints interface {
+	Create(w http.ResponseWriter, r *http.Request)
+	GetAll(w http.ResponseWriter, r *http.Request)
+	GetOne(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+	Deliveries(w http.ResponseWriter, r *http.Request)
+	DeadLetters(w http.ResponseWriter, r *http.Request)
+	Redeliver(w http.ResponseWriter, r *http.Request)
+}
+
+// Webhooks the subscriptions to the building changes
+type Webhooks struct {
+	*Building
+	Dispatcher *webhooks.Dispatcher
+}
+
+var _ WebhookEndpoints = (*Webhooks)(nil)
+
+// NewWebhooks new instance, the problems are replied as the building ones
+func NewWebhooks(b *Building, d *webhooks.Dispatcher) *Webhooks {
+	return &Webhooks{
+		Building:   b,
+		Dispatcher: d,
+	}
+}
+
+// Create add a subscription, the reply has the secret, it is not shown again
+func (h *Webhooks) Create(w http.ResponseWriter, r *http.Request) {
+	data := &webhooks.SubscriptionParams{}
+	//sanity check
+	if err := render.Bind(r, data); err != nil {
+		//400
+		h.ReplyBindErr(w, r, err)
+		return
+	}
+	sub, err := h.Dispatcher.Add(data)
+	//chk
+	if err != nil {
+		h.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: sub,
+	})
+}
+
+// GetAll list the subscriptions
+func (h *Webhooks) GetAll(w http.ResponseWriter, r *http.Request) {
+	all := h.Dispatcher.Subscriptions()
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: all,
+		Total:  len(all),
+	})
+}
+
+// GetOne 1 subscription
+func (h *Webhooks) GetOne(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.Dispatcher.Subscription(strings.TrimSpace(chi.URLParam(r, "id")))
+	//chk
+	if err != nil {
+		h.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: sub,
+	})
+}
+
+// Delete remove a subscription
+func (h *Webhooks) Delete(w http.ResponseWriter, r *http.Request) {
+	//chk
+	if err := h.Dispatcher.Remove(strings.TrimSpace(chi.URLParam(r, "id"))); err != nil {
+		h.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+	})
+}
+
+// Deliveries the delivery log of a subscription, newest first
+func (h *Webhooks) Deliveries(w http.ResponseWriter, r *http.Request) {
+	all, err := h.Dispatcher.Deliveries(strings.TrimSpace(chi.URLParam(r, "id")))
+	//chk
+	if err != nil {
+		h.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: all,
+		Total:  len(all),
+	})
+}
+
+// DeadLetters the deliveries that used up their retries, newest first
+func (h *Webhooks) DeadLetters(w http.ResponseWriter, r *http.Request) {
+	all := h.Dispatcher.DeadLetters()
+	//good
+	render.JSON(w, r, Response{
+		Status: "success",
+		Result: all,
+		Total:  len(all),
+	})
+}
+
+// Redeliver queue a dead letter again
+func (h *Webhooks) Redeliver(w http.ResponseWriter, r *http.Request) {
+	//chk
+	if err := h.Dispatcher.Redeliver(strings.TrimSpace(chi.URLParam(r, "id"))); err != nil {
+		h.ReplyErr(w, r, err)
+		return
+	}
+	//good
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, Response{
+		Status: "success",
+	})
+}
@@ -0,0 +1,190 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/auth"
+	"github.com/bayugyug/building-custom-api/configs"
+	"github.com/bayugyug/building-custom-api/tools"
+	"github.com/bayugyug/building-custom-api/webhooks"
+
+	"github.com/icrowley/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::WEBHOOKS", func() {
+
+	var service *routes.APIService
+	var receiver *httptest.Server
+	var mtx sync.Mutex
+	var got [][]byte
+	var failing bool
+
+	newService := func(opts ...routes.Setup) *routes.APIService {
+		svc, _ := routes.NewAPIService(append([]routes.Setup{
+			routes.WithSvcOptAddress(":8989"),
+			routes.WithSvcOptLogger(tools.NewLogger(tools.WithLoggerOptOutput(ioutil.Discard))),
+			routes.WithSvcOptWebhooks(&configs.WebhookConfig{
+				Attempts: 2, Backoff: configs.Duration(10 * time.Millisecond), AllowPrivate: true,
+			}),
+		}, opts...)...)
+		return svc
+	}
+
+	BeforeEach(func() {
+		got, failing = nil, false
+		receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mtx.Lock()
+			defer mtx.Unlock()
+			if failing {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			got = append(got, body)
+		}))
+		service = newService()
+	})
+
+	AfterEach(func() {
+		service.Webhooks.Close(context.Background())
+		receiver.Close()
+	})
+
+	received := func() int {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(got)
+	}
+
+	call := func(method, path, body string) (int, handler.Response) {
+		w, reply := testReq(service.Mux, method, path, bytes.NewReader([]byte(body)))
+		var res handler.Response
+		json.Unmarshal(reply, &res)
+		return w.Code, res
+	}
+
+	subscribe := func(body string) map[string]interface{} {
+		code, res := call("POST", "/v1/api/webhooks", body)
+		Expect(code).To(Equal(http.StatusCreated))
+		return res.Result.(map[string]interface{})
+	}
+
+	createBuilding := func() {
+		code, _ := call("POST", "/v1/api/building",
+			fmt.Sprintf(`{"name":"building-%s","address":"address here"}`, fake.DigitsN(8)))
+		Expect(code).To(Equal(http.StatusCreated))
+	}
+
+	Context("Subscriptions", func() {
+
+		It("should deliver the building changes and log them", func() {
+			sub := subscribe(fmt.Sprintf(`{"url":%q,"events":[%q]}`, receiver.URL, webhooks.EventCreated))
+			Expect(sub["secret"]).NotTo(BeEmpty())
+			id := sub["id"].(string)
+
+			createBuilding()
+			Eventually(received).Should(Equal(1))
+
+			code, res := call("GET", "/v1/api/webhooks", "")
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(res.Total).To(Equal(1))
+			Expect(res.Result.([]interface{})[0].(map[string]interface{})).NotTo(HaveKey("secret"))
+
+			Eventually(func() int {
+				_, res := call("GET", "/v1/api/webhooks/"+id+"/deliveries", "")
+				return res.Total
+			}).Should(Equal(1))
+
+			code, _ = call("DELETE", "/v1/api/webhooks/"+id, "")
+			Expect(code).To(Equal(http.StatusOK))
+			code, _ = call("GET", "/v1/api/webhooks/"+id, "")
+			Expect(code).To(Equal(http.StatusNotFound))
+			By("Subscriptions ok")
+		})
+
+		It("should refuse a bad subscription", func() {
+			w, body := testReq(service.Mux, "POST", "/v1/api/webhooks", bytes.NewReader([]byte(`{"url":"not a url"}`)))
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+			var problem handler.Problem
+			Expect(json.Unmarshal(body, &problem)).To(Succeed())
+			Expect(problem.Code).To(Equal(handler.CodeInvalidParameter))
+			code, _ := call("POST", "/v1/api/webhooks", fmt.Sprintf(`{"url":%q,"events":["room.created"]}`, receiver.URL))
+			Expect(code).To(Equal(http.StatusBadRequest))
+			By("Bad subscription ok")
+
+			other := newService(routes.WithSvcOptWebhooks(&configs.WebhookConfig{}))
+			defer other.Webhooks.Close(context.Background())
+			w, body = testReq(other.Mux, "POST", "/v1/api/webhooks", bytes.NewReader([]byte(fmt.Sprintf(`{"url":%q}`, receiver.URL))))
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+			Expect(string(body)).To(ContainSubstring(webhooks.ErrPrivateURL.Error()))
+			By("Private receiver refused")
+		})
+	})
+
+	Context("Dead letters", func() {
+
+		It("should list the failed deliveries and retry them", func() {
+			mtx.Lock()
+			failing = true
+			mtx.Unlock()
+			subscribe(fmt.Sprintf(`{"url":%q}`, receiver.URL))
+			createBuilding()
+
+			var dead []interface{}
+			Eventually(func() int {
+				_, res := call("GET", "/v1/api/webhooks/_dead", "")
+				dead, _ = res.Result.([]interface{})
+				return res.Total
+			}).Should(Equal(1))
+
+			mtx.Lock()
+			failing = false
+			mtx.Unlock()
+			id := dead[0].(map[string]interface{})["id"].(string)
+			code, _ := call("POST", "/v1/api/webhooks/_dead/"+id+"/retry", "")
+			Expect(code).To(Equal(http.StatusAccepted))
+			Eventually(received).Should(Equal(1))
+			code, _ = call("POST", "/v1/api/webhooks/_dead/"+id+"/retry", "")
+			Expect(code).To(Equal(http.StatusNotFound))
+			By("Dead letters ok")
+		})
+	})
+
+	Context("Roles", func() {
+
+		It("should leave the webhooks to the admins", func() {
+			var keys []auth.APIKey
+			for name, role := range map[string]string{"alice": "editor", "root": "admin"} {
+				keys = append(keys, auth.APIKey{Name: name, Hash: auth.HashAPIKey(name + "-key"), Roles: []string{role}})
+			}
+			authn, _ := auth.NewAPIKeys(keys...)
+			policy, _ := auth.NewPolicy()
+			service.Webhooks.Close(context.Background())
+			service = newService(routes.WithSvcOptAuth(authn), routes.WithSvcOptPolicy(policy))
+
+			body := fmt.Sprintf(`{"url":%q}`, receiver.URL)
+			w, _ := testReqWithHeaders(service.Mux, "POST", "/v1/api/webhooks", bytes.NewReader([]byte(body)),
+				map[string]string{auth.APIKeyHeader: "alice-key"})
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+			w, _ = testReqWithHeaders(service.Mux, "GET", "/v1/api/webhooks", nil,
+				map[string]string{auth.APIKeyHeader: "alice-key"})
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+			w, _ = testReqWithHeaders(service.Mux, "POST", "/v1/api/webhooks", bytes.NewReader([]byte(body)),
+				map[string]string{auth.APIKeyHeader: "root-key"})
+			Expect(w.Code).To(Equal(http.StatusCreated))
+			By("Roles ok")
+		})
+	})
+})
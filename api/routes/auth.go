@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/auth"
+	"github.com/bayugyug/building-custom-api/tools"
+)
+
+// authRealm realm of the WWW-Authenticate challenge
+const authRealm = "building-api"
+
+// DefaultPublic paths open without credentials, the welcome, the health probes and the scrape of the metrics
+var DefaultPublic = []string{
+	"/",
+	"/v1/api/health",
+	"/v1/api/health/live",
+	"/v1/api/health/ready",
+	"/metrics",
+}
+
+// Authenticate identify the caller and put it in the request context, 401 when it cannot be.
+// No authenticator means the api is open, the public paths are always open.
+func (svc *APIService) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if svc.Auth == nil || svc.isPublic(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		//failed attempts are counted against the client address, once it is used up
+		//the credentials are not even checked, so guessing them is throttled too
+		limiter, class := svc.limiterFor(r)
+		if limiter != nil {
+			if res := limiter.Peek(clientKey(r)); !res.Allowed {
+				svc.rateHeaders(w, r, class, res)
+				return
+			}
+		}
+		p, err := svc.Auth.Authenticate(r)
+		if err == nil && p == nil {
+			err = auth.ErrUnauthenticated
+		}
+		if err != nil {
+			if limiter != nil && !svc.rateHeaders(w, r, class, limiter.Allow(clientKey(r))) {
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+authRealm+`"`)
+			svc.Building.ReplyErr(w, r, err)
+			return
+		}
+		tools.SetLogField(r.Context(), "principal", p.Subject)
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+	})
+}
+
+// Require the caller may do the action, open when no policy is set
+func (svc *APIService) Require(action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if svc.Policy != nil {
+				if err := svc.Policy.Authorize(auth.PrincipalFrom(r.Context()), action, nil); err != nil {
+					svc.Building.ReplyErr(w, r, err)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isPublic exact path match, or a prefix match for the entries ending in "/*"
+func (svc *APIService) isPublic(path string) bool {
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	for _, public := range svc.Public {
+		if strings.HasSuffix(public, "/*") {
+			if strings.HasPrefix(path+"/", strings.TrimSuffix(public, "*")) {
+				return true
+			}
+			continue
+		}
+		if path == public {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/bayugyug/building-custom-api/configs"
+
+	"github.com/go-chi/cors"
+)
+
+// CORSOptions the cross origin settings of the config, missing fields keep the defaults
+func CORSOptions(cfg *configs.CORSConfig) cors.Options {
+	opts := cors.Options{
+		AllowedOrigins:   []string{"*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "X-API-Key", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match", "Idempotency-Key"},
+		ExposedHeaders:   []string{"ETag", "WWW-Authenticate", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Idempotent-Replayed"},
+		AllowCredentials: false,
+	}
+	if cfg == nil {
+		return opts
+	}
+	if len(cfg.AllowedOrigins) > 0 {
+		opts.AllowedOrigins = cfg.AllowedOrigins
+	}
+	if len(cfg.AllowedMethods) > 0 {
+		opts.AllowedMethods = cfg.AllowedMethods
+	}
+	if len(cfg.AllowedHeaders) > 0 {
+		opts.AllowedHeaders = cfg.AllowedHeaders
+	}
+	if len(cfg.ExposedHeaders) > 0 {
+		opts.ExposedHeaders = cfg.ExposedHeaders
+	}
+	if cfg.AllowCredentials != nil {
+		opts.AllowCredentials = *cfg.AllowCredentials
+	}
+	if cfg.MaxAge > 0 {
+		opts.MaxAge = cfg.MaxAge
+	}
+	return opts
+}
+
+// SetCORS replace the cross origin settings, safe while serving
+func (svc *APIService) SetCORS(opts cors.Options) {
+	svc.cors.Store(cors.New(opts))
+}
+
+// CORSHandler the cross origin middleware of the current settings
+func (svc *APIService) CORSHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		svc.cors.Load().(*cors.Cors).Handler(next).ServeHTTP(w, r)
+	})
+}
+
+// Reload apply the settings safe to change while serving: log level, CORS and rate limits.
+// Addresses, timeouts, auth and storage need a restart.
+func (svc *APIService) Reload(cfg *configs.ParameterConfig) {
+	if cfg == nil {
+		return
+	}
+	if level, err := cfg.LogLevel(); err == nil {
+		svc.Logger.SetLevel(level)
+	}
+	var origins *configs.CORSConfig
+	if cfg.Server != nil {
+		origins = cfg.Server.CORS
+	}
+	svc.SetCORS(CORSOptions(origins))
+	svc.SetRateLimit(cfg.RateLimit)
+}
@@ -0,0 +1,225 @@
+package routes
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/auth"
+)
+
+const (
+	// IdempotencyHeader header of the client chosen key of a POST
+	IdempotencyHeader = "Idempotency-Key"
+	// IdempotencyReplayedHeader set on a reply given back from the cache
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+	// DefaultIdempotencyTTL time a reply is kept for the retries
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// DefaultIdempotencyKeys replies kept at most, the oldest is dropped past it
+	DefaultIdempotencyKeys = 10000
+
+	// maxIdempotencyKey longest key accepted
+	maxIdempotencyKey = 255
+	// maxIdempotencyBody largest body read for the check, a bulk of the max items fits
+	maxIdempotencyBody = 16 << 20
+)
+
+// replayHeaders headers of the stored reply given back on a replay
+var replayHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// idempotencyEntry 1 key, pending until its request is done
+type idempotencyEntry struct {
+	scope   string
+	sum     [sha256.Size]byte
+	created time.Time
+	done    bool
+	status  int
+	header  http.Header
+	body    []byte
+}
+
+// idempotencyCache the keys in the order they came, so the expired and the oldest are at the front
+type idempotencyCache struct {
+	ttl     time.Duration
+	maxKeys int
+	mtx     *sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newIdempotencyCache(ttl time.Duration, maxKeys int) *idempotencyCache {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	if maxKeys <= 0 {
+		maxKeys = DefaultIdempotencyKeys
+	}
+	return &idempotencyCache{
+		ttl:     ttl,
+		maxKeys: maxKeys,
+		mtx:     new(sync.Mutex),
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// begin the entry of the scope, a new pending one when first is true
+func (c *idempotencyCache) begin(scope string, sum [sha256.Size]byte) (entry idempotencyEntry, first bool) {
+	// ensure
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := time.Now()
+	for el := c.order.Front(); el != nil; el = c.order.Front() {
+		if now.Sub(el.Value.(*idempotencyEntry).created) < c.ttl {
+			break
+		}
+		c.remove(el)
+	}
+	if el, ok := c.entries[scope]; ok {
+		return *el.Value.(*idempotencyEntry), false
+	}
+	e := &idempotencyEntry{scope: scope, sum: sum, created: now}
+	c.entries[scope] = c.order.PushBack(e)
+	if c.order.Len() > c.maxKeys {
+		c.remove(c.order.Front())
+	}
+	return *e, true
+}
+
+// finish keep the reply of the pending entry
+func (c *idempotencyCache) finish(scope string, status int, header http.Header, body []byte) {
+	// ensure
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if el, ok := c.entries[scope]; ok {
+		e := el.Value.(*idempotencyEntry)
+		e.done, e.status, e.header, e.body = true, status, header, body
+	}
+}
+
+// forget drop the entry, the next retry runs again
+func (c *idempotencyCache) forget(scope string) {
+	// ensure
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if el, ok := c.entries[scope]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *idempotencyCache) remove(el *list.Element) {
+	delete(c.entries, el.Value.(*idempotencyEntry).scope)
+	c.order.Remove(el)
+}
+
+// Idempotent run a POST with an Idempotency-Key once, a retry with the same body gets the stored reply.
+// The same key with another body is 422, while the 1st request is still running it is 409.
+// Server errors and 429 are not stored so they can be retried for real.
+func (svc *APIService) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			//400
+			svc.Building.ReplyProblem(w, r, handler.NewProblem(http.StatusBadRequest, handler.CodeInvalidParameter,
+				IdempotencyHeader+" is longer than 255"))
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotencyBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				//413
+				svc.Building.ReplyProblem(w, r, handler.NewProblem(http.StatusRequestEntityTooLarge, handler.CodeInvalidBody,
+					fmt.Sprintf("body is over %d bytes", tooLarge.Limit)))
+				return
+			}
+			//400
+			svc.Building.ReplyProblem(w, r, handler.NewProblem(http.StatusBadRequest, handler.CodeInvalidBody, err.Error()))
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		//keys are per caller and end-point
+		scope := r.URL.Path + "\n" + key
+		if p := auth.PrincipalFrom(r.Context()); p != nil {
+			scope = p.Method + ":" + p.Subject + "\n" + scope
+		}
+		sum := sha256.Sum256(body)
+		entry, first := svc.idempotency.begin(scope, sum)
+		switch {
+		case entry.sum != sum:
+			//422
+			svc.Building.ReplyProblem(w, r, handler.NewProblem(http.StatusUnprocessableEntity, handler.CodeIdempotencyMismatch,
+				IdempotencyHeader+" was used with another body"))
+			return
+		case !first && !entry.done:
+			//409
+			w.Header().Set("Retry-After", "1")
+			svc.Building.ReplyProblem(w, r, handler.NewProblem(http.StatusConflict, handler.CodeIdempotencyInFlight,
+				"a request with this "+IdempotencyHeader+" is still running"))
+			return
+		case !first:
+			for k, v := range entry.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set(IdempotencyReplayedHeader, "true")
+			w.WriteHeader(entry.status)
+			w.Write(entry.body)
+			return
+		}
+
+		rec := &replyRecorder{ResponseWriter: w, status: http.StatusOK}
+		kept := false
+		defer func() {
+			//a panic or a failure leaves nothing behind
+			if !kept {
+				svc.idempotency.forget(scope)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+		if rec.status >= http.StatusInternalServerError || rec.status == http.StatusTooManyRequests {
+			return
+		}
+		header := make(http.Header)
+		for _, k := range replayHeaders {
+			if v, ok := w.Header()[k]; ok {
+				header[k] = append([]string(nil), v...)
+			}
+		}
+		svc.idempotency.finish(scope, rec.status, header, rec.body.Bytes())
+		kept = true
+	})
+}
+
+// replyRecorder pass the reply on, keeping a copy
+type replyRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *replyRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status, rec.wroteHeader = status, true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *replyRecorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(p)
+	return rec.ResponseWriter.Write(p)
+}
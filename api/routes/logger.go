@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/tools"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+// LogRequests 1 json entry per request, the request id, route, status, latency and building id attached.
+// Entries logged by the handlers through tools.LoggerFrom get the same fields.
+func (svc *APIService) LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		scope := tools.NewLogScope(tools.Fields{
+			"request_id": middleware.GetReqID(r.Context()),
+			"method":     r.Method,
+			"path":       r.URL.Path,
+		})
+		logger := svc.Logger.Scoped(scope)
+		entry := &requestLogEntry{logger: logger}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		r = middleware.WithLogEntry(r.WithContext(tools.WithLogger(r.Context(), logger)), entry)
+		defer func() {
+			scope.Set("route", requestRoute(r))
+			if id := requestBuildingID(r); id != "" {
+				if _, ok := scope.Fields()["building_id"]; !ok {
+					scope.Set("building_id", id)
+				}
+			}
+			entry.Write(ww.Status(), ww.BytesWritten(), time.Since(start))
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// requestLogEntry the chi log entry, so panics caught by middleware.Recoverer are logged as json too
+type requestLogEntry struct {
+	logger *tools.Logger
+}
+
+// Write the entry of a finished request
+func (e *requestLogEntry) Write(status, bytes int, elapsed time.Duration) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	level := tools.LevelInfo
+	switch {
+	case status >= http.StatusInternalServerError:
+		level = tools.LevelError
+	case status >= http.StatusBadRequest:
+		level = tools.LevelWarn
+	}
+	e.logger.Log(level, "request", tools.Fields{
+		"status":     status,
+		"bytes":      bytes,
+		"latency_ms": float64(elapsed.Nanoseconds()) / float64(time.Millisecond),
+	})
+}
+
+// Panic the entry of a handler panic
+func (e *requestLogEntry) Panic(v interface{}, stack []byte) {
+	e.logger.Error("panic", tools.Fields{
+		"panic": v,
+		"stack": string(stack),
+	})
+}
+
+// requestRoute route pattern of the request, known once routed
+func requestRoute(r *http.Request) string {
+	route := routeUnmatched
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		route = rctx.RoutePattern()
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+	}
+	return route
+}
+
+// requestBuildingID the {id} of the building routes
+func requestBuildingID(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && strings.HasPrefix(rctx.RoutePattern(), "/v1/api/building") {
+		return rctx.URLParam("id")
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// routeUnmatched label of the requests no route took, keeps the raw paths out of the series
+const routeUnmatched = "unmatched"
+
+// Instrument count and time each request by method, route and status
+func (svc *APIService) Instrument(next http.Handler) http.Handler {
+	requests := svc.Metrics.Registry.Counter("http_requests_total",
+		"HTTP requests by method, route and status.", "method", "route", "status")
+	latency := svc.Metrics.Registry.Histogram("http_request_duration_seconds",
+		"HTTP request latencies in seconds.", nil, "method", "route", "status")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		route := requestRoute(r)
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		code := strconv.Itoa(status)
+		requests.Inc(r.Method, route, code)
+		latency.Observe(time.Since(start).Seconds(), r.Method, route, code)
+	})
+}
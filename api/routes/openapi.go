@@ -0,0 +1,341 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/configs"
+	"github.com/bayugyug/building-custom-api/models"
+	"github.com/bayugyug/building-custom-api/tools"
+	"github.com/bayugyug/building-custom-api/webhooks"
+
+	"github.com/go-chi/chi"
+)
+
+var (
+	pathParamRe = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+)
+
+// queryDoc 1 query string parameter
+type queryDoc struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// operationDoc what the router cannot tell about an end-point
+type operationDoc struct {
+	ID      string
+	Summary string
+	Tag     string
+	Body    interface{}
+	Media   []string
+	Result  interface{}
+	Reply   interface{}
+	ReplyAs string
+	Status  int
+	Query   []queryDoc
+	Headers []string
+}
+
+var (
+	listQuery = []queryDoc{
+		{"limit", "integer", "rows per page, 1..1000 (default 100)"},
+		{"page", "integer", "page number, not with cursor"},
+		{"cursor", "string", "next_cursor of the previous page"},
+		{"sort", "string", "id, name, created or modified, prefix with - for descending"},
+		{"name_prefix", "string", "name starts with, case-insensitive"},
+		{"address_contains", "string", "address contains, case-insensitive"},
+		{"min_floors", "integer", "at least this many floors"},
+		{"max_floors", "integer", "at most this many floors"},
+		{"created_after", "string", "RFC3339 timestamp"},
+		{"created_before", "string", "RFC3339 timestamp"},
+	}
+
+	// operationDocs keyed by method and route as the router walks them
+	operationDocs = map[string]operationDoc{
+		"GET /": {ID: "welcome", Summary: "Welcome", Tag: "service"},
+		"GET /metrics": {ID: "getMetrics", Summary: "Prometheus metrics of the service", Tag: "service",
+			Reply: "", ReplyAs: "text/plain"},
+		"GET /v1/openapi.json": {ID: "getOpenAPI", Summary: "This OpenAPI document", Tag: "service",
+			Reply: map[string]interface{}{}},
+		"GET /v1/docs": {ID: "getDocs", Summary: "Docs page of this document", Tag: "service",
+			Reply: "", ReplyAs: "text/html"},
+		"GET /v1/api/health": {ID: "healthCheck", Summary: "Build and time of the service", Tag: "service",
+			Reply: map[string]string{}},
+		"GET /v1/api/health/live": {ID: "healthLive", Summary: "Liveness probe", Tag: "service",
+			Reply: handler.HealthReport{}},
+		"GET /v1/api/health/ready": {ID: "healthReady", Summary: "Readiness probe, 503 with the failed checks", Tag: "service",
+			Reply: handler.HealthReport{}},
+		"POST /v1/api/building": {ID: "createBuilding", Summary: "Create a building", Tag: "building",
+			Body: models.BuildingCreateParams{}, Result: "", Status: http.StatusCreated},
+		"PUT /v1/api/building": {ID: "updateBuilding", Summary: "Replace a building", Tag: "building",
+			Body: models.BuildingUpdateParams{}, Headers: []string{"If-Match"}},
+		"PATCH /v1/api/building": {ID: "patchBuildingLegacy", Summary: "Partial update, id in the body", Tag: "building",
+			Body: map[string]interface{}{}, Media: []string{models.ContentTypeMergePatch, models.ContentTypeJSONPatch},
+			Result: models.BuildingData{}, Headers: []string{"If-Match"}},
+		"PATCH /v1/api/building/{id}": {ID: "patchBuilding", Summary: "Partial update", Tag: "building",
+			Body: map[string]interface{}{}, Media: []string{models.ContentTypeMergePatch, models.ContentTypeJSONPatch},
+			Result: models.BuildingData{}, Headers: []string{"If-Match"}},
+		"GET /v1/api/building": {ID: "listBuildings", Summary: "List buildings", Tag: "building",
+			Result: []models.BuildingData{}, Query: listQuery},
+		"GET /v1/api/building/{id}": {ID: "getBuilding", Summary: "Get a building with its occupancy", Tag: "building",
+			Result: models.BuildingSummary{}, Headers: []string{"If-None-Match"}},
+		"DELETE /v1/api/building/{id}": {ID: "deleteBuilding", Summary: "Delete a building", Tag: "building",
+			Headers: []string{"If-Match"}},
+		"GET /v1/api/building/_changes": {ID: "streamBuildingChanges", Summary: "Stream the building changes as Server-Sent Events", Tag: "building",
+			Reply: "", ReplyAs: handler.ContentTypeEventStream, Headers: []string{handler.LastEventIDHeader},
+			Query: []queryDoc{{"last_event_id", "integer", "resume after this change, for clients unable to send " + handler.LastEventIDHeader}}},
+		"POST /v1/api/building/_bulk": {ID: "bulkBuildings", Summary: "Bulk create, update and delete", Tag: "building",
+			Body: []models.BulkItem{}, Media: []string{"application/json", "application/x-ndjson"},
+			Result: []handler.BulkReply{}, Query: []queryDoc{{"atomic", "boolean", "keep all or nothing"}}},
+		"GET /v1/api/building/{id}/floors": {ID: "listFloors", Summary: "List the floors", Tag: "floor",
+			Result: models.FloorList{}},
+		"POST /v1/api/building/{id}/floors": {ID: "createFloor", Summary: "Add a floor", Tag: "floor",
+			Body: models.FloorCreateParams{}, Result: "", Status: http.StatusCreated, Headers: []string{"If-Match"}},
+		"GET /v1/api/building/{id}/floors/{floorId}": {ID: "getFloor", Summary: "Get a floor with its occupancy", Tag: "floor",
+			Result: models.FloorSummary{}},
+		"PUT /v1/api/building/{id}/floors/{floorId}": {ID: "updateFloor", Summary: "Replace a floor", Tag: "floor",
+			Body: models.FloorCreateParams{}, Result: models.FloorData{}, Headers: []string{"If-Match"}},
+		"DELETE /v1/api/building/{id}/floors/{floorId}": {ID: "deleteFloor", Summary: "Delete a floor", Tag: "floor",
+			Query: []queryDoc{{"cascade", "boolean", "delete the rooms too"}}, Headers: []string{"If-Match"}},
+		"GET /v1/api/building/{id}/floors/{floorId}/rooms": {ID: "listRooms", Summary: "List the rooms", Tag: "room",
+			Result: models.RoomList{}},
+		"POST /v1/api/building/{id}/floors/{floorId}/rooms": {ID: "createRoom", Summary: "Add a room", Tag: "room",
+			Body: models.RoomCreateParams{}, Result: "", Status: http.StatusCreated, Headers: []string{"If-Match"}},
+		"GET /v1/api/building/{id}/floors/{floorId}/rooms/{roomId}": {ID: "getRoom", Summary: "Get a room", Tag: "room",
+			Result: models.RoomData{}},
+		"PUT /v1/api/building/{id}/floors/{floorId}/rooms/{roomId}": {ID: "updateRoom", Summary: "Replace a room", Tag: "room",
+			Body: models.RoomCreateParams{}, Result: models.RoomData{}, Headers: []string{"If-Match"}},
+		"DELETE /v1/api/building/{id}/floors/{floorId}/rooms/{roomId}": {ID: "deleteRoom", Summary: "Delete a room", Tag: "room",
+			Headers: []string{"If-Match"}},
+		"GET /v1/api/webhooks": {ID: "listWebhooks", Summary: "List the webhook subscriptions", Tag: "webhook",
+			Result: []webhooks.Subscription{}},
+		"POST /v1/api/webhooks": {ID: "createWebhook", Summary: "Subscribe a url to the building changes, the secret is only shown here", Tag: "webhook",
+			Body: webhooks.SubscriptionParams{}, Result: webhooks.Subscription{}, Status: http.StatusCreated},
+		"GET /v1/api/webhooks/_dead": {ID: "listWebhookDeadLetters", Summary: "Deliveries that used up their retries", Tag: "webhook",
+			Result: []webhooks.DeadLetter{}},
+		"POST /v1/api/webhooks/_dead/{id}/retry": {ID: "retryWebhookDeadLetter", Summary: "Send a dead letter again", Tag: "webhook",
+			Status: http.StatusAccepted},
+		"GET /v1/api/webhooks/{id}": {ID: "getWebhook", Summary: "Get a webhook subscription", Tag: "webhook",
+			Result: webhooks.Subscription{}},
+		"DELETE /v1/api/webhooks/{id}": {ID: "deleteWebhook", Summary: "Delete a webhook subscription", Tag: "webhook"},
+		"GET /v1/api/webhooks/{id}/deliveries": {ID: "listWebhookDeliveries", Summary: "Delivery log of a subscription, newest first", Tag: "webhook",
+			Result: []webhooks.Delivery{}},
+	}
+
+	// headerDocs description of the request headers
+	headerDocs = map[string]string{
+		"If-Match":                "ETag of the record",
+		"If-None-Match":           "ETag of the record",
+		IdempotencyHeader:         "client chosen key, a retry with the same key and body gets the 1st reply",
+		handler.LastEventIDHeader: "seq of the last change received, the missed ones are sent first",
+	}
+
+	// ruleSchemas components checked by the validation rules, with the rule key prefix and if required applies
+	ruleSchemas = []struct {
+		Name     string
+		Prefix   string
+		Required bool
+		Extra    []string
+	}{
+		{"BuildingCreateParams", "", true, nil},
+		{"BuildingUpdateParams", "", true, []string{"id"}},
+		{"BulkItem", "", false, []string{"op"}},
+		{"FloorCreateParams", "floors.", true, nil},
+		{"RoomCreateParams", "floors.rooms.", true, nil},
+		{"FloorData", "floors.", false, nil},
+		{"RoomData", "floors.rooms.", false, nil},
+	}
+)
+
+// BuildOpenAPI the OpenAPI 3 document of the routes
+func BuildOpenAPI(routes chi.Routes) ([]byte, error) {
+	registry := tools.NewSchemaRegistry()
+	problem := registry.Ref(handler.Problem{})
+	paths := make(map[string]map[string]interface{})
+
+	walkFunc := func(method string, route string, h http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.Replace(route, "/*/", "/", -1)
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+		doc := operationDocs[method+" "+route]
+		op := map[string]interface{}{
+			"operationId": doc.ID,
+			"summary":     doc.Summary,
+			"responses": map[string]interface{}{
+				"default": map[string]interface{}{
+					"description": "problem",
+					"content": map[string]interface{}{
+						handler.ContentTypeProblem: map[string]interface{}{"schema": problem},
+					},
+				},
+			},
+		}
+		if doc.ID == "" {
+			op["operationId"] = strings.ToLower(method) + pathParamRe.ReplaceAllString(strings.Replace(route, "/", "_", -1), "$1")
+		}
+		if doc.Tag != "" {
+			op["tags"] = []string{doc.Tag}
+		}
+		//parameters
+		var params []interface{}
+		for _, m := range pathParamRe.FindAllStringSubmatch(route, -1) {
+			params = append(params, map[string]interface{}{
+				"name": m[1], "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, q := range doc.Query {
+			params = append(params, map[string]interface{}{
+				"name": q.Name, "in": "query", "description": q.Description,
+				"schema": map[string]interface{}{"type": q.Type},
+			})
+		}
+		headers := doc.Headers
+		if method == http.MethodPost {
+			//every POST is run once per key
+			headers = append(append([]string{}, headers...), IdempotencyHeader)
+		}
+		for _, name := range headers {
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "header", "description": headerDocs[name],
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		route = pathParamRe.ReplaceAllString(route, "{$1}")
+		//body
+		if doc.Body != nil {
+			media := doc.Media
+			if len(media) == 0 {
+				media = []string{"application/json"}
+			}
+			content := make(map[string]interface{})
+			for _, mt := range media {
+				content[mt] = map[string]interface{}{"schema": registry.Ref(doc.Body)}
+			}
+			op["requestBody"] = map[string]interface{}{"required": true, "content": content}
+		}
+		//good reply
+		status := doc.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		media, schema := "application/json", registry.Ref(handler.Response{})
+		if doc.Reply != nil {
+			schema = registry.Ref(doc.Reply)
+		}
+		if doc.ReplyAs != "" {
+			media = doc.ReplyAs
+		}
+		if doc.Result != nil {
+			schema = map[string]interface{}{
+				"allOf": []interface{}{schema, map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"result": registry.Ref(doc.Result)},
+				}},
+			}
+		}
+		responses := op["responses"].(map[string]interface{})
+		responses[strconv.Itoa(status)] = map[string]interface{}{
+			"description": http.StatusText(status),
+			"content": map[string]interface{}{
+				media: map[string]interface{}{"schema": schema},
+			},
+		}
+		if paths[route] == nil {
+			paths[route] = make(map[string]interface{})
+		}
+		paths[route][strings.ToLower(method)] = op
+		return nil
+	}
+	if err := chi.Walk(routes, walkFunc); err != nil {
+		return nil, err
+	}
+
+	//constraints from the validation rules in use
+	for _, rs := range ruleSchemas {
+		if schema, ok := registry.Schemas[rs.Name]; ok {
+			applyRules(schema, rs.Prefix, rs.Required, rs.Extra...)
+		}
+	}
+	if item, ok := registry.Schemas["BulkItem"]; ok {
+		props := item["properties"].(map[string]interface{})
+		props["op"].(map[string]interface{})["enum"] = []string{models.BulkOpCreate, models.BulkOpUpdate, models.BulkOpDelete}
+	}
+	version := configs.Release
+	if version == "" {
+		version = "dev"
+	}
+	spec := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   configs.Application,
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": registry.Schemas,
+		},
+	}
+	return json.MarshalIndent(spec, "", "  ")
+}
+
+// applyRules add the rule constraints to the object schema, extra fields are always required
+func applyRules(schema map[string]interface{}, prefix string, withRequired bool, extra ...string) {
+	props, _ := schema["properties"].(map[string]interface{})
+	rules := models.Rules()
+	required := append([]string{}, extra...)
+	for name, raw := range props {
+		rule, ok := rules[prefix+name]
+		prop, _ := raw.(map[string]interface{})
+		if !ok || prop == nil {
+			continue
+		}
+		if withRequired && rule.Required {
+			required = append(required, name)
+		}
+		if _, isRef := prop["$ref"]; isRef {
+			continue
+		}
+		switch prop["type"] {
+		case "array":
+			if rule.MinLength > 0 {
+				prop["minItems"] = rule.MinLength
+			}
+			if rule.MaxLength > 0 {
+				prop["maxItems"] = rule.MaxLength
+			}
+		case "string":
+			if rule.MinLength > 0 {
+				prop["minLength"] = rule.MinLength
+			}
+			if rule.MaxLength > 0 {
+				prop["maxLength"] = rule.MaxLength
+			}
+			if rule.Pattern != nil {
+				prop["pattern"] = rule.Pattern.String()
+			}
+		case "integer", "number":
+			if rule.Min != nil {
+				prop["minimum"] = *rule.Min
+			}
+			if rule.Max != nil {
+				prop["maximum"] = *rule.Max
+			}
+		}
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+}
@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/auth"
+	"github.com/bayugyug/building-custom-api/configs"
+	"github.com/bayugyug/building-custom-api/tools"
+)
+
+// rateExempt paths never limited, the probes must not be refused
+const rateExempt = "/v1/api/health"
+
+// rateLimits the limiters in effect, nil is not limited
+type rateLimits struct {
+	read  *tools.Limiter
+	write *tools.Limiter
+}
+
+// SetRateLimit replace the limiters, safe while serving; the clients start over with full budgets
+func (svc *APIService) SetRateLimit(cfg *configs.RateLimitConfig) {
+	limits := &rateLimits{}
+	if cfg != nil {
+		opts := []tools.LimiterSetup{
+			tools.WithLimiterOptMaxKeys(cfg.MaxClients),
+			tools.WithLimiterOptIdle(cfg.IdleTimeout.D()),
+		}
+		if b := cfg.Read; b != nil && b.Requests > 0 {
+			limits.read = tools.NewLimiter(b.Requests, b.Per.D(), opts...)
+		}
+		if b := cfg.Write; b != nil && b.Requests > 0 {
+			limits.write = tools.NewLimiter(b.Requests, b.Per.D(), opts...)
+		}
+	}
+	svc.limits.Store(limits)
+}
+
+// RateLimit token bucket per client, with separate read and write budgets.
+// Each limited reply has the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers,
+// a refused one is 429 with Retry-After.
+func (svc *APIService) RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter, class := svc.limiterFor(r)
+		if limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if res := limiter.Allow(rateKey(r)); !svc.rateHeaders(w, r, class, res) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limiterFor the limiter and class of the request, nil when it is not limited
+func (svc *APIService) limiterFor(r *http.Request) (*tools.Limiter, string) {
+	limits, _ := svc.limits.Load().(*rateLimits)
+	if limits == nil || strings.HasPrefix(r.URL.Path, rateExempt) {
+		return nil, ""
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return limits.read, "read"
+	}
+	return limits.write, "write"
+}
+
+// rateHeaders set the budget headers, refusing with 429 when it is used up
+func (svc *APIService) rateHeaders(w http.ResponseWriter, r *http.Request, class string, res tools.LimitResult) bool {
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+	if res.Allowed {
+		return true
+	}
+	svc.Metrics.Registry.Counter("http_requests_throttled_total",
+		"HTTP requests refused by the rate limiter by class.", "class").Inc(class)
+	wait := ceilSeconds(res.RetryAfter)
+	h.Set("Retry-After", wait)
+	//429
+	svc.Building.ReplyProblem(w, r, handler.NewProblem(http.StatusTooManyRequests, handler.CodeRateLimited,
+		fmt.Sprintf("%s budget used up, retry after %ss", class, wait)))
+	return false
+}
+
+// rateKey the authenticated caller, else the client address
+func rateKey(r *http.Request) string {
+	if p := auth.PrincipalFrom(r.Context()); p != nil {
+		return p.Method + ":" + p.Subject
+	}
+	return clientKey(r)
+}
+
+// clientKey the client address, what a caller not yet known is counted against
+func clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		//middleware.RealIP gives the bare address
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ceilSeconds whole seconds rounded up, as the headers want
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
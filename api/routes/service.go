@@ -2,15 +2,22 @@ package routes
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/bayugyug/building-custom-api/api/handler"
+	"github.com/bayugyug/building-custom-api/auth"
+	"github.com/bayugyug/building-custom-api/configs"
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/tools"
+	"github.com/bayugyug/building-custom-api/webhooks"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -26,8 +33,52 @@ const (
 // APIService the svc map
 type APIService struct {
 	Building *handler.Building
+	Docs     *handler.Docs
+	Metrics  *handler.Metrics
+	Logger   *tools.Logger
+	Health   *handler.Health
+	Checks   drivers.HealthSettings
+	Storage  drivers.StorageDriver
+	Auth     auth.Authenticator
+	Policy   *auth.Policy
+	Public   []string
+	Webhooks *webhooks.Dispatcher
 	Mux      *chi.Mux
 	Address  string
+
+	DrainTimeout    time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	HandlerTimeout  time.Duration
+	CORS            cors.Options
+	RateLimits      *configs.RateLimitConfig
+	IdempotencyTTL  time.Duration
+	IdempotencyKeys int
+	WebhookConfig   *configs.WebhookConfig
+	idempotency     *idempotencyCache
+	cors            atomic.Value
+	limits          atomic.Value
+	mtx             *sync.Mutex
+	hooks           []shutdownHook
+}
+
+const (
+	// DefaultDrainTimeout time given to the in-flight requests on shutdown
+	DefaultDrainTimeout = 15 * time.Second
+	// DefaultServerTimeout read, write and idle timeout of the http server
+	DefaultServerTimeout = 30 * time.Second
+	// DefaultHandlerTimeout time a handler gets before its context is cancelled
+	DefaultHandlerTimeout = 60 * time.Second
+)
+
+// buildingRoutes the handlers mapped under /v1/api/building
+type buildingRoutes interface {
+	handler.BuildingEndpoints
+	handler.FloorEndpoints
+	handler.RoomEndpoints
+	handler.BulkEndpoints
+	handler.ChangeEndpoints
 }
 
 // Setup options settings
@@ -54,6 +105,119 @@ func WithSvcOptAddress(r string) Setup {
 	}
 }
 
+// WithSvcOptStorage opts for the storage backend
+func WithSvcOptStorage(r drivers.StorageDriver) Setup {
+	return func(args *APIService) {
+		args.Storage = r
+	}
+}
+
+// WithSvcOptMetrics opts for the metrics registry
+func WithSvcOptMetrics(r *handler.Metrics) Setup {
+	return func(args *APIService) {
+		args.Metrics = r
+	}
+}
+
+// WithSvcOptLogger opts for the request logger
+func WithSvcOptLogger(r *tools.Logger) Setup {
+	return func(args *APIService) {
+		args.Logger = r
+	}
+}
+
+// WithSvcOptHealthSettings opts for the thresholds of the storage checks
+func WithSvcOptHealthSettings(r drivers.HealthSettings) Setup {
+	return func(args *APIService) {
+		args.Checks = r
+	}
+}
+
+// WithSvcOptDrainTimeout opts for the time given to the in-flight requests on shutdown
+func WithSvcOptDrainTimeout(r time.Duration) Setup {
+	return func(args *APIService) {
+		args.DrainTimeout = r
+	}
+}
+
+// WithSvcOptServerTimeouts opts for the read, write and idle timeouts of the http server, zero keeps the default
+func WithSvcOptServerTimeouts(read, write, idle time.Duration) Setup {
+	return func(args *APIService) {
+		if read > 0 {
+			args.ReadTimeout = read
+		}
+		if write > 0 {
+			args.WriteTimeout = write
+		}
+		if idle > 0 {
+			args.IdleTimeout = idle
+		}
+	}
+}
+
+// WithSvcOptHandlerTimeout opts for the time a handler gets, zero keeps the default
+func WithSvcOptHandlerTimeout(r time.Duration) Setup {
+	return func(args *APIService) {
+		if r > 0 {
+			args.HandlerTimeout = r
+		}
+	}
+}
+
+// WithSvcOptCORS opts for the cross origin settings
+func WithSvcOptCORS(r cors.Options) Setup {
+	return func(args *APIService) {
+		args.CORS = r
+	}
+}
+
+// WithSvcOptAuth opts for the authenticator, nil keeps the api open
+func WithSvcOptAuth(r auth.Authenticator) Setup {
+	return func(args *APIService) {
+		args.Auth = r
+	}
+}
+
+// WithSvcOptPolicy opts for the role policy of the building and webhook end-points, nil lets any caller do anything
+func WithSvcOptPolicy(r *auth.Policy) Setup {
+	return func(args *APIService) {
+		args.Policy = r
+	}
+}
+
+// WithSvcOptPublic opts for more paths open without credentials, on top of DefaultPublic
+func WithSvcOptPublic(r ...string) Setup {
+	return func(args *APIService) {
+		args.Public = append(args.Public, r...)
+	}
+}
+
+// WithSvcOptRateLimit opts for the per client read and write budgets, nil is not limited
+func WithSvcOptRateLimit(r *configs.RateLimitConfig) Setup {
+	return func(args *APIService) {
+		args.RateLimits = r
+	}
+}
+
+// WithSvcOptIdempotency opts for the time the Idempotency-Key replies are kept and how many at most
+func WithSvcOptIdempotency(ttl time.Duration, maxKeys int) Setup {
+	return func(args *APIService) {
+		if ttl > 0 {
+			args.IdempotencyTTL = ttl
+		}
+		if maxKeys > 0 {
+			args.IdempotencyKeys = maxKeys
+		}
+	}
+}
+
+// WithSvcOptWebhooks opts for the retries, workers and logs of the webhook deliveries
+func WithSvcOptWebhooks(r *configs.WebhookConfig) Setup {
+	return func(args *APIService) {
+		args.WebhookConfig = r
+	}
+}
+
 // NewAPIService service new instance
 func NewAPIService(opts ...Setup) (*APIService, error) {
 
@@ -61,6 +225,21 @@ func NewAPIService(opts ...Setup) (*APIService, error) {
 	svc := &APIService{
 		Address:  ":8989",
 		Building: handler.NewBuilding(),
+		Docs:     handler.NewDocs(),
+		Metrics:  handler.NewMetrics(),
+		Logger:   tools.Log,
+		Health:   handler.NewHealth(),
+		Public:   append([]string{}, DefaultPublic...),
+
+		DrainTimeout:    DefaultDrainTimeout,
+		ReadTimeout:     DefaultServerTimeout,
+		WriteTimeout:    DefaultServerTimeout,
+		IdleTimeout:     DefaultServerTimeout,
+		HandlerTimeout:  DefaultHandlerTimeout,
+		CORS:            CORSOptions(nil),
+		IdempotencyTTL:  DefaultIdempotencyTTL,
+		IdempotencyKeys: DefaultIdempotencyKeys,
+		mtx:             new(sync.Mutex),
 	}
 
 	//add options if any
@@ -68,6 +247,38 @@ func NewAPIService(opts ...Setup) (*APIService, error) {
 		setter(svc)
 	}
 
+	if svc.DrainTimeout <= 0 {
+		svc.DrainTimeout = DefaultDrainTimeout
+	}
+
+	//storage given takes over the handler default
+	if svc.Storage != nil {
+		svc.Building.Storage = svc.Storage
+	}
+	//count and time each storage operation
+	svc.Building.Storage = drivers.NewMeteredStorage(svc.Building.Storage, svc.Metrics.Registry)
+	svc.Storage = svc.Building.Storage
+	svc.Health.Register(drivers.HealthChecks(svc.Storage, svc.Checks)...)
+
+	svc.idempotency = newIdempotencyCache(svc.IdempotencyTTL, svc.IdempotencyKeys)
+
+	//deliveries of the changes, stopped before the storage is flushed
+	hooks := []webhooks.DispatcherSetup{
+		webhooks.WithDispatcherOptLogger(svc.Logger),
+		webhooks.WithDispatcherOptMetrics(svc.Metrics.Registry),
+	}
+	if cfg := svc.WebhookConfig; cfg != nil {
+		hooks = append(hooks,
+			webhooks.WithDispatcherOptRetry(cfg.Attempts, cfg.Backoff.D(), cfg.MaxBackoff.D()),
+			webhooks.WithDispatcherOptWorkers(cfg.Workers),
+			webhooks.WithDispatcherOptTimeout(cfg.Timeout.D()),
+			webhooks.WithDispatcherOptLogSize(cfg.LogSize),
+			webhooks.WithDispatcherOptAllowPrivate(cfg.AllowPrivate),
+		)
+	}
+	svc.Webhooks = webhooks.NewDispatcher(svc.Storage, hooks...)
+	svc.OnShutdown("webhooks", svc.Webhooks.Close)
+
 	//set the actual router
 	svc.Mux = svc.MapRoute()
 
@@ -75,38 +286,125 @@ func NewAPIService(opts ...Setup) (*APIService, error) {
 	return svc, nil
 }
 
-// Run the http server based on settings
-func (svc *APIService) Run() {
+// Run the http server until SIGTERM or SIGINT, then drain and run the shutdown hooks
+func (svc *APIService) Run() error {
+	//watcher
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopChan := make(chan os.Signal, 1)
+	signal.Notify(stopChan, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(stopChan)
+	go func() {
+		select {
+		case sig := <-stopChan:
+			svc.Logger.Info("signal received", tools.Fields{"signal": sig.String()})
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return svc.Start(ctx)
+}
+
+// Start listen on the address then serve until ctx is done
+func (svc *APIService) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", svc.Address)
+	if err != nil {
+		//bind failed, nothing to drain but the hooks still flush
+		svc.shutdownHooks()
+		return err
+	}
+	return svc.Serve(ctx, ln)
+}
+
+// Serve the http server on the listener until ctx is done, then drain and run the shutdown hooks
+func (svc *APIService) Serve(ctx context.Context, ln net.Listener) error {
 
 	//gracious timing
 	srv := &http.Server{
 		Addr:         svc.Address,
 		Handler:      svc.Mux,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  30 * time.Second,
+		ReadTimeout:  svc.ReadTimeout,
+		WriteTimeout: svc.WriteTimeout,
+		IdleTimeout:  svc.IdleTimeout,
 	}
+	//the change streams never end on their own, cut them so the drain is not held up
+	srv.RegisterOnShutdown(func() {
+		if feed := drivers.Changes(svc.Storage); feed != nil {
+			feed.CloseSubscriptions()
+		}
+	})
 
 	//async run
+	served := make(chan error, 1)
 	go func() {
-		log.Println("Listening on port", svc.Address)
-		if err := srv.ListenAndServe(); err != nil {
-			log.Printf("listen: %s\n", err)
-			os.Exit(0)
+		svc.Logger.Info("listening", tools.Fields{"address": ln.Addr().String()})
+		served <- srv.Serve(ln)
+	}()
+
+	var err error
+	select {
+	case err = <-served:
+		//listener died on its own
+		svc.Logger.Error("listen", tools.Fields{"error": err})
+		svc.Health.BeginShutdown()
+	case <-ctx.Done():
+		svc.Health.BeginShutdown()
+		svc.Logger.Info("shutting down service", tools.Fields{"drain_timeout": svc.DrainTimeout.String()})
+		drain, cancel := context.WithTimeout(context.Background(), svc.DrainTimeout)
+		err = srv.Shutdown(drain)
+		cancel()
+		if err != nil {
+			//drain took too long, cut the rest
+			svc.Logger.Error("drain", tools.Fields{"error": err})
+			srv.Close()
 		}
+		<-served
+	}
+	if herr := svc.shutdownHooks(); err == nil {
+		err = herr
+	}
+	if err == nil {
+		svc.Logger.Info("server gracefully stopped")
+	}
+	return err
+}
 
-	}()
+// OnShutdown add a hook run after the server drained, in the order added
+func (svc *APIService) OnShutdown(name string, fn func(ctx context.Context) error) {
+	// ensure
+	svc.mtx.Lock()
+	defer svc.mtx.Unlock()
+	svc.hooks = append(svc.hooks, shutdownHook{name: name, fn: fn})
+}
 
-	//watcher
-	stopChan := make(chan os.Signal)
-	signal.Notify(stopChan, os.Interrupt)
+// shutdownHook 1 named step of the shutdown
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
 
-	<-stopChan
-	log.Println("Shutting down service...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	srv.Shutdown(ctx)
-	defer cancel()
-	log.Println("Server gracefully stopped!")
+// shutdownHooks run each hook once, all of them even if 1 fails, the 1st error is given back
+func (svc *APIService) shutdownHooks() error {
+	svc.mtx.Lock()
+	hooks := svc.hooks
+	svc.hooks = nil
+	svc.mtx.Unlock()
+
+	var first error
+	for _, hook := range hooks {
+		ctx, cancel := context.WithTimeout(context.Background(), svc.DrainTimeout)
+		err := hook.fn(ctx)
+		cancel()
+		if err != nil {
+			svc.Logger.Error("shutdown hook", tools.Fields{"hook": hook.name, "error": err})
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		svc.Logger.Info("shutdown hook", tools.Fields{"hook": hook.name})
+	}
+	return first
 }
 
 // MapRoute route map all endpoints
@@ -118,62 +416,138 @@ func (svc *APIService) MapRoute() *chi.Mux {
 	// Basic settings
 	router.Use(
 		render.SetContentType(render.ContentTypeJSON),
-		middleware.Logger,
-		middleware.DefaultCompress,
-		middleware.StripSlashes,
-		middleware.Recoverer,
 		middleware.RequestID,
 		middleware.RealIP,
+		svc.LogRequests,
+		svc.Instrument,
+		middleware.StripSlashes,
+		middleware.Recoverer,
 	)
 
-	// Basic gracious timing
-	router.Use(middleware.Timeout(60 * time.Second))
+	// Basic gracious timing, the long lived change stream is left out of it and of the compression;
+	// a retried POST with an Idempotency-Key runs once, it keeps the reply before it is compressed
+	// so a replay is encoded for the retry and not for the 1st request
+	timed := chi.Chain(middleware.DefaultCompress, svc.Idempotent, middleware.Timeout(svc.HandlerTimeout))
 
-	// Basic CORS
-	cors := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		AllowCredentials: true,
-	})
+	// Basic CORS, swappable on reload
+	svc.SetCORS(svc.CORS)
+	router.Use(svc.CORSHandler)
+
+	// Caller identity, open when no authenticator is set
+	router.Use(svc.Authenticate)
 
-	router.Use(cors.Handler)
+	// Per client budgets, keyed by the caller so after the identity, swappable on reload;
+	// the failed identities are already counted against the client address
+	svc.SetRateLimit(svc.RateLimits)
+	router.Use(svc.RateLimit)
 
-	router.Get("/", svc.Building.Welcome)
+	router.With(timed...).Get("/", svc.Building.Welcome)
+	router.With(timed...).Get("/metrics", svc.Metrics.Scrape)
 
 	/*
 		@end-points
 
+		GET    /metrics
+		GET    /v1/openapi.json
+		GET    /v1/docs
+
+		GET    /v1/api/health
+		GET    /v1/api/health/live
+		GET    /v1/api/health/ready
+
 		GET    /v1/api/building/:id
+		GET    /v1/api/building/_changes
 		POST   /v1/api/building
+		POST   /v1/api/building/_bulk
 		PUT    /v1/api/building
+		PATCH  /v1/api/building/:id
 		DELETE /v1/api/building/:id
 
+		GET    /v1/api/building/:id/floors
+		POST   /v1/api/building/:id/floors
+		GET    /v1/api/building/:id/floors/:floorId
+		PUT    /v1/api/building/:id/floors/:floorId
+		DELETE /v1/api/building/:id/floors/:floorId
+
+		GET    /v1/api/building/:id/floors/:floorId/rooms
+		POST   /v1/api/building/:id/floors/:floorId/rooms
+		GET    /v1/api/building/:id/floors/:floorId/rooms/:roomId
+		PUT    /v1/api/building/:id/floors/:floorId/rooms/:roomId
+		DELETE /v1/api/building/:id/floors/:floorId/rooms/:roomId
+
+		GET    /v1/api/webhooks
+		POST   /v1/api/webhooks
+		GET    /v1/api/webhooks/_dead
+		POST   /v1/api/webhooks/_dead/:id/retry
+		GET    /v1/api/webhooks/:id
+		DELETE /v1/api/webhooks/:id
+		GET    /v1/api/webhooks/:id/deliveries
+
 	*/
 
+	//the role checks wrap the handlers when a policy is set
+	var endpoints buildingRoutes = svc.Building
+	if svc.Policy != nil {
+		endpoints = handler.NewAuthorized(svc.Building, svc.Policy)
+	}
+	var hooks handler.WebhookEndpoints = handler.NewWebhooks(svc.Building, svc.Webhooks)
+
 	//end-points-mapping
 	router.Route("/v1", func(r chi.Router) {
+		r.With(timed...).Get("/openapi.json", svc.Docs.OpenAPI)
+		r.With(timed...).Get("/docs", svc.Docs.Page)
 		r.Mount("/api",
-			func(h *handler.Building) *chi.Mux {
-				sr := chi.NewRouter()
-				sr.Get("/health", h.HealthCheck)
+			func(h buildingRoutes) *chi.Mux {
+				mux := chi.NewRouter()
+				mux.Get("/building/_changes", h.Changes)
+				sr := mux.With(timed...)
+				sr.Get("/health", svc.Building.HealthCheck)
+				sr.Get("/health/live", svc.Health.Live)
+				sr.Get("/health/ready", svc.Health.Ready)
 				sr.Post("/building", h.Create)
+				sr.Post("/building/_bulk", h.Bulk)
 				sr.Put("/building", h.Update)
-				sr.Patch("/building", h.Update)
+				sr.Patch("/building", h.Patch)
+				sr.Patch("/building/{id}", h.Patch)
 				sr.Get("/building", h.GetAll)
 				sr.Get("/building/{id}", h.GetOne)
 				sr.Delete("/building/{id}", h.Delete)
-				return sr
-			}(svc.Building))
+				sr.Get("/building/{id}/floors", h.GetFloors)
+				sr.Post("/building/{id}/floors", h.CreateFloor)
+				sr.Get("/building/{id}/floors/{floorId}", h.GetFloor)
+				sr.Put("/building/{id}/floors/{floorId}", h.UpdateFloor)
+				sr.Delete("/building/{id}/floors/{floorId}", h.DeleteFloor)
+				sr.Get("/building/{id}/floors/{floorId}/rooms", h.GetRooms)
+				sr.Post("/building/{id}/floors/{floorId}/rooms", h.CreateRoom)
+				sr.Get("/building/{id}/floors/{floorId}/rooms/{roomId}", h.GetRoom)
+				sr.Put("/building/{id}/floors/{floorId}/rooms/{roomId}", h.UpdateRoom)
+				sr.Delete("/building/{id}/floors/{floorId}/rooms/{roomId}", h.DeleteRoom)
+				//the receivers are reached from inside the network, only the webhooks role may set them
+				wh := sr.With(svc.Require(auth.ActionWebhooks))
+				wh.Get("/webhooks", hooks.GetAll)
+				wh.Post("/webhooks", hooks.Create)
+				wh.Get("/webhooks/_dead", hooks.DeadLetters)
+				wh.Post("/webhooks/_dead/{id}/retry", hooks.Redeliver)
+				wh.Get("/webhooks/{id}", hooks.GetOne)
+				wh.Delete("/webhooks/{id}", hooks.Delete)
+				wh.Get("/webhooks/{id}/deliveries", hooks.Deliveries)
+				return mux
+			}(endpoints))
 	})
 	//show
 	walkFunc := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
 		route = strings.Replace(route, "/*/", "/", -1)
-		fmt.Printf("... %s %s\n", method, route)
+		svc.Logger.Debug("route", tools.Fields{"method": method, "route": route})
 		return nil
 	}
 	if err := chi.Walk(router, walkFunc); err != nil {
-		fmt.Printf("Logging err: %s\n", err.Error())
+		svc.Logger.Error("routes walk", tools.Fields{"error": err})
+	}
+	//document of what got mapped
+	spec, err := BuildOpenAPI(router)
+	if err != nil {
+		svc.Logger.Error("openapi", tools.Fields{"error": err})
 	}
+	svc.Docs.Spec = spec
 	return router
 }
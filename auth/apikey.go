@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader header of the api key, "Authorization: ApiKey <key>" works too
+const APIKeyHeader = "X-API-Key"
+
+// hashPrefix scheme of the stored hashes
+const hashPrefix = "sha256:"
+
+// APIKey 1 static key, only its hash is kept
+type APIKey struct {
+	Name  string
+	Hash  string
+	Roles []string
+}
+
+// HashAPIKey the at rest form of a key, put this in the config and not the key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// APIKeys authenticate by static keys
+type APIKeys struct {
+	keys []apiKeyHash
+}
+
+// apiKeyHash parsed hash of 1 key
+type apiKeyHash struct {
+	APIKey
+	sum []byte
+}
+
+// NewAPIKeys new instance, the hashes are "sha256:<hex>"
+func NewAPIKeys(keys ...APIKey) (*APIKeys, error) {
+	a := &APIKeys{}
+	for _, key := range keys {
+		if !strings.HasPrefix(key.Hash, hashPrefix) {
+			return nil, ErrInvalidCredentials
+		}
+		sum, err := hex.DecodeString(strings.TrimPrefix(key.Hash, hashPrefix))
+		if err != nil || len(sum) != sha256.Size {
+			return nil, ErrInvalidCredentials
+		}
+		a.keys = append(a.keys, apiKeyHash{APIKey: key, sum: sum})
+	}
+	return a, nil
+}
+
+// Authenticate the caller by its api key
+func (a *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := strings.TrimSpace(r.Header.Get(APIKeyHeader))
+	if key == "" {
+		authz := r.Header.Get("Authorization")
+		if len(authz) > 7 && strings.EqualFold(authz[:7], "ApiKey ") {
+			key = strings.TrimSpace(authz[7:])
+		}
+	}
+	if key == "" {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	//all compared, the time does not tell which one matched
+	var found *apiKeyHash
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(sum[:], a.keys[i].sum) == 1 {
+			found = &a.keys[i]
+		}
+	}
+	if found == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{
+		Subject: found.Name,
+		Method:  MethodAPIKey,
+		Roles:   append([]string{}, found.Roles...),
+	}, nil
+}
@@ -0,0 +1,71 @@
+package auth_test
+
+import (
+	"net/http"
+
+	"github.com/bayugyug/building-custom-api/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::AUTH API KEY", func() {
+
+	var keys *auth.APIKeys
+
+	BeforeEach(func() {
+		var err error
+		keys, err = auth.NewAPIKeys(
+			auth.APIKey{Name: "ci", Hash: auth.HashAPIKey("ci-key"), Roles: []string{"editor"}},
+			auth.APIKey{Name: "ops", Hash: auth.HashAPIKey("ops-key"), Roles: []string{"admin"}},
+		)
+		if err != nil {
+			Fail(err.Error())
+		}
+	})
+
+	request := func(headers map[string]string) *http.Request {
+		req, _ := http.NewRequest("GET", "/v1/api/building", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		return req
+	}
+
+	Context("Keys", func() {
+
+		It("should keep only the hash", func() {
+			Expect(auth.HashAPIKey("ci-key")).To(HavePrefix("sha256:"))
+			Expect(auth.HashAPIKey("ci-key")).NotTo(ContainSubstring("ci-key"))
+			_, err := auth.NewAPIKeys(auth.APIKey{Name: "plain", Hash: "ci-key"})
+			Expect(err).To(Equal(auth.ErrInvalidCredentials))
+			By("Hash ok")
+		})
+
+		It("should identify the caller by header", func() {
+			p, err := keys.Authenticate(request(map[string]string{auth.APIKeyHeader: "ops-key"}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Subject).To(Equal("ops"))
+			Expect(p.Method).To(Equal(auth.MethodAPIKey))
+			Expect(p.HasRole("admin")).To(BeTrue())
+
+			p, err = keys.Authenticate(request(map[string]string{"Authorization": "ApiKey ci-key"}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Subject).To(Equal("ci"))
+			By("Identify ok")
+		})
+
+		It("should reject a wrong key and skip a missing one", func() {
+			_, err := keys.Authenticate(request(map[string]string{auth.APIKeyHeader: "nope"}))
+			Expect(err).To(Equal(auth.ErrInvalidCredentials))
+
+			p, err := keys.Authenticate(request(nil))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p).To(BeNil())
+
+			_, err = auth.Chain{keys}.Authenticate(request(nil))
+			Expect(err).To(Equal(auth.ErrUnauthenticated))
+			By("Reject ok")
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"io/ioutil"
+
+	"github.com/bayugyug/building-custom-api/configs"
+)
+
+// NewFromConfig the authenticators of the config, api keys first then jwt, nil when none is set
+func NewFromConfig(cfg *configs.AuthConfig) (Authenticator, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	var chain Chain
+	if len(cfg.APIKeys) > 0 {
+		var keys []APIKey
+		for _, key := range cfg.APIKeys {
+			keys = append(keys, APIKey{Name: key.Name, Hash: key.Hash, Roles: key.Roles})
+		}
+		apiKeys, err := NewAPIKeys(keys...)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, apiKeys)
+	}
+	if jc := cfg.JWT; jc != nil {
+		opts := []JWTSetup{
+			WithJWTOptIssuer(jc.Issuer),
+			WithJWTOptAudience(jc.Audience),
+			WithJWTOptLeeway(jc.Leeway.D()),
+			WithJWTOptRolesClaim(jc.RolesClaim),
+		}
+		for _, secret := range jc.Secrets {
+			opts = append(opts, WithJWTOptHMAC("", []byte(secret)))
+		}
+		for _, path := range jc.PublicKeys {
+			raw, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			key, err := ParseRSAPublicKeyPEM(raw)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, WithJWTOptRSA("", key))
+		}
+		if jc.JWKSFile != "" {
+			set, err := LoadJWKS(jc.JWKSFile)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, WithJWTOptKeySet(set))
+		}
+		chain = append(chain, NewJWT(opts...))
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+// NewPolicyFromConfig the role policy of the config, nil when auth is not set
+func NewPolicyFromConfig(cfg *configs.AuthConfig) (*Policy, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	return NewPolicy(
+		WithPolicyOptRoles(cfg.Roles),
+		WithPolicyOptOwnership(cfg.Ownership),
+	)
+}
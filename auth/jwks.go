@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+)
+
+// ErrInvalidKey key material that cannot be used
+var ErrInvalidKey = errors.New("invalid key")
+
+// KeySet verify keys by kid, RSA public keys and HMAC secrets
+type KeySet struct {
+	Public  map[string]*rsa.PublicKey
+	Secrets map[string][]byte
+}
+
+// jwks the json web key set document
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		K   string `json:"k"`
+	} `json:"keys"`
+}
+
+// LoadJWKS read a local JWKS file, RSA and oct keys, the ones not for signing skipped
+func LoadJWKS(path string) (*KeySet, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(raw)
+}
+
+// ParseJWKS decode a JWKS document
+func ParseJWKS(raw []byte) (*KeySet, error) {
+	var doc jwks
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	set := &KeySet{
+		Public:  make(map[string]*rsa.PublicKey),
+		Secrets: make(map[string][]byte),
+	}
+	for _, key := range doc.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		switch key.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(key.N)
+			if err != nil {
+				return nil, ErrInvalidKey
+			}
+			e, err := base64.RawURLEncoding.DecodeString(key.E)
+			if err != nil || len(e) == 0 || len(e) > 4 {
+				return nil, ErrInvalidKey
+			}
+			set.Public[key.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "oct":
+			k, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil || len(k) == 0 {
+				return nil, ErrInvalidKey
+			}
+			set.Secrets[key.Kid] = k
+		}
+	}
+	return set, nil
+}
+
+// ParseRSAPublicKeyPEM a PKIX "PUBLIC KEY" or PKCS1 "RSA PUBLIC KEY" block
+func ParseRSAPublicKeyPEM(raw []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
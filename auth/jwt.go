@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+// DefaultRolesClaim claim holding the roles, a list or a space separated string
+const DefaultRolesClaim = "roles"
+
+// ErrNoVerifyKey no key configured for the alg or kid of the token
+var ErrNoVerifyKey = errors.New("no key for token")
+
+// JWT authenticate by bearer tokens signed with HS256 or RS256
+type JWT struct {
+	hmacKeys   []jwtKey
+	rsaKeys    []jwtKey
+	Issuer     string
+	Audience   string
+	Leeway     time.Duration
+	RolesClaim string
+	now        func() time.Time
+}
+
+// jwtKey 1 verify key, kid is optional
+type jwtKey struct {
+	kid    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// JWTSetup options settings
+type JWTSetup func(*JWT)
+
+// WithJWTOptHMAC opts for a HS256 shared secret
+func WithJWTOptHMAC(kid string, secret []byte) JWTSetup {
+	return func(args *JWT) {
+		args.hmacKeys = append(args.hmacKeys, jwtKey{kid: kid, secret: secret})
+	}
+}
+
+// WithJWTOptRSA opts for a RS256 public key
+func WithJWTOptRSA(kid string, key *rsa.PublicKey) JWTSetup {
+	return func(args *JWT) {
+		args.rsaKeys = append(args.rsaKeys, jwtKey{kid: kid, public: key})
+	}
+}
+
+// WithJWTOptKeySet opts for all the keys of a JWKS
+func WithJWTOptKeySet(set *KeySet) JWTSetup {
+	return func(args *JWT) {
+		for kid, secret := range set.Secrets {
+			args.hmacKeys = append(args.hmacKeys, jwtKey{kid: kid, secret: secret})
+		}
+		for kid, key := range set.Public {
+			args.rsaKeys = append(args.rsaKeys, jwtKey{kid: kid, public: key})
+		}
+	}
+}
+
+// WithJWTOptIssuer opts for the required iss
+func WithJWTOptIssuer(r string) JWTSetup {
+	return func(args *JWT) {
+		args.Issuer = r
+	}
+}
+
+// WithJWTOptAudience opts for the required aud
+func WithJWTOptAudience(r string) JWTSetup {
+	return func(args *JWT) {
+		args.Audience = r
+	}
+}
+
+// WithJWTOptLeeway opts for the clock skew allowed on exp and nbf
+func WithJWTOptLeeway(r time.Duration) JWTSetup {
+	return func(args *JWT) {
+		args.Leeway = r
+	}
+}
+
+// WithJWTOptRolesClaim opts for the claim holding the roles
+func WithJWTOptRolesClaim(r string) JWTSetup {
+	return func(args *JWT) {
+		if r != "" {
+			args.RolesClaim = r
+		}
+	}
+}
+
+// WithJWTOptClock opts for the time source, for tests
+func WithJWTOptClock(r func() time.Time) JWTSetup {
+	return func(args *JWT) {
+		args.now = r
+	}
+}
+
+// NewJWT new instance
+func NewJWT(opts ...JWTSetup) *JWT {
+	j := &JWT{
+		RolesClaim: DefaultRolesClaim,
+		now:        time.Now,
+	}
+	//add options if any
+	for _, setter := range opts {
+		setter(j)
+	}
+	return j
+}
+
+// jwtHeader the part of the header used
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Authenticate the caller by its bearer token
+func (j *JWT) Authenticate(r *http.Request) (*Principal, error) {
+	authz := r.Header.Get("Authorization")
+	if len(authz) < 7 || !strings.EqualFold(authz[:7], "Bearer ") {
+		return nil, nil
+	}
+	claims, err := j.Verify(strings.TrimSpace(authz[7:]))
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{
+		Subject: sub,
+		Method:  MethodJWT,
+		Roles:   claimStrings(claims[j.RolesClaim]),
+		Claims:  claims,
+	}, nil
+}
+
+// Verify check the signature and the time, iss and aud claims, giving back the claims
+func (j *JWT) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidCredentials
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	//the alg picks the key kind, a RSA public key is never used as a HMAC secret
+	switch header.Alg {
+	case AlgHS256:
+		err = verifyWith(j.hmacKeys, header.Kid, func(key jwtKey) bool {
+			mac := hmac.New(sha256.New, key.secret)
+			mac.Write(signed)
+			return hmac.Equal(sig, mac.Sum(nil))
+		})
+	case AlgRS256:
+		sum := sha256.Sum256(signed)
+		err = verifyWith(j.rsaKeys, header.Kid, func(key jwtKey) bool {
+			return rsa.VerifyPKCS1v15(key.public, crypto.SHA256, sum[:], sig) == nil
+		})
+	default:
+		err = ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if err := j.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// verifyWith try the keys of the kid, a token or key without kid tries all
+func verifyWith(keys []jwtKey, kid string, ok func(key jwtKey) bool) error {
+	tried := false
+	for _, key := range keys {
+		if kid != "" && key.kid != "" && key.kid != kid {
+			continue
+		}
+		tried = true
+		if ok(key) {
+			return nil
+		}
+	}
+	if !tried {
+		return ErrNoVerifyKey
+	}
+	return ErrInvalidCredentials
+}
+
+// checkClaims exp is required, nbf, iss and aud when set
+func (j *JWT) checkClaims(claims map[string]interface{}) error {
+	now := j.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return ErrInvalidCredentials
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(j.Leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(j.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return ErrTokenExpired
+	}
+	if j.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != j.Issuer {
+			return ErrInvalidCredentials
+		}
+	}
+	if j.Audience != "" {
+		found := false
+		for _, aud := range claimStrings(claims["aud"]) {
+			if aud == j.Audience {
+				found = true
+			}
+		}
+		if !found {
+			return ErrInvalidCredentials
+		}
+	}
+	return nil
+}
+
+// claimStrings a list claim, or a space separated string
+func claimStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return strings.Fields(val)
+	case []interface{}:
+		var list []string
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(bytes.NewReader(raw)).Decode(v)
+}
@@ -0,0 +1,215 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::AUTH JWT", func() {
+
+	//init
+	secret := []byte("unit-test-secret")
+	now := time.Unix(1600000000, 0)
+	clock := func() time.Time { return now }
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		Fail(err.Error())
+	}
+
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":   "alice",
+			"exp":   now.Add(time.Hour).Unix(),
+			"roles": []string{"editor"},
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	bearer := func(token string) *http.Request {
+		req, _ := http.NewRequest("GET", "/v1/api/building", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+
+	Context("HS256", func() {
+
+		It("should accept a valid token", func() {
+			j := auth.NewJWT(auth.WithJWTOptHMAC("", secret), auth.WithJWTOptClock(clock))
+			p, err := j.Authenticate(bearer(signHS256(secret, "", claims(nil))))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Subject).To(Equal("alice"))
+			Expect(p.Method).To(Equal(auth.MethodJWT))
+			Expect(p.Roles).To(Equal([]string{"editor"}))
+			By("Valid ok")
+		})
+
+		It("should reject a bad signature, expired or missing sub", func() {
+			j := auth.NewJWT(auth.WithJWTOptHMAC("", secret), auth.WithJWTOptClock(clock))
+			_, err := j.Verify(signHS256([]byte("other"), "", claims(nil)))
+			Expect(err).To(Equal(auth.ErrInvalidCredentials))
+
+			_, err = j.Verify(signHS256(secret, "", claims(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()})))
+			Expect(err).To(Equal(auth.ErrTokenExpired))
+
+			_, err = j.Verify(signHS256(secret, "", claims(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()})))
+			Expect(err).To(Equal(auth.ErrTokenExpired))
+
+			noExp := claims(nil)
+			delete(noExp, "exp")
+			_, err = j.Verify(signHS256(secret, "", noExp))
+			Expect(err).To(Equal(auth.ErrInvalidCredentials))
+
+			_, err = j.Authenticate(bearer(signHS256(secret, "", claims(map[string]interface{}{"sub": ""}))))
+			Expect(err).To(Equal(auth.ErrInvalidCredentials))
+			By("Reject ok")
+		})
+
+		It("should allow the leeway and check iss and aud", func() {
+			j := auth.NewJWT(
+				auth.WithJWTOptHMAC("", secret),
+				auth.WithJWTOptClock(clock),
+				auth.WithJWTOptLeeway(time.Minute),
+				auth.WithJWTOptIssuer("https://issuer.example.com"),
+				auth.WithJWTOptAudience("building-api"),
+			)
+			good := claims(map[string]interface{}{
+				"exp": now.Add(-30 * time.Second).Unix(),
+				"iss": "https://issuer.example.com",
+				"aud": []string{"other", "building-api"},
+			})
+			_, err := j.Verify(signHS256(secret, "", good))
+			Expect(err).NotTo(HaveOccurred())
+
+			good["aud"] = "other"
+			_, err = j.Verify(signHS256(secret, "", good))
+			Expect(err).To(Equal(auth.ErrInvalidCredentials))
+
+			good["aud"] = "building-api"
+			good["iss"] = "https://evil.example.com"
+			_, err = j.Verify(signHS256(secret, "", good))
+			Expect(err).To(Equal(auth.ErrInvalidCredentials))
+			By("Claims ok")
+		})
+	})
+
+	Context("RS256", func() {
+
+		It("should accept a token of a configured public key", func() {
+			j := auth.NewJWT(auth.WithJWTOptRSA("k1", &rsaKey.PublicKey), auth.WithJWTOptClock(clock))
+			_, err := j.Verify(signRS256(rsaKey, "k1", claims(nil)))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = j.Verify(signRS256(rsaKey, "k2", claims(nil)))
+			Expect(err).To(Equal(auth.ErrNoVerifyKey))
+			By("RS256 ok")
+		})
+
+		It("should not verify a HS256 token with the public key as secret", func() {
+			der := x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)
+			asSecret := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: der})
+			j := auth.NewJWT(auth.WithJWTOptRSA("", &rsaKey.PublicKey), auth.WithJWTOptClock(clock))
+			_, err := j.Verify(signHS256(asSecret, "", claims(nil)))
+			Expect(err).To(Equal(auth.ErrNoVerifyKey))
+
+			_, err = j.Verify(signToken("none", "", claims(nil), nil))
+			Expect(err).To(Equal(auth.ErrInvalidCredentials))
+			By("Alg ok")
+		})
+
+		It("should read the PEM public key", func() {
+			der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+			Expect(err).NotTo(HaveOccurred())
+			key, err := auth.ParseRSAPublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key.N.Cmp(rsaKey.PublicKey.N)).To(BeZero())
+
+			_, err = auth.ParseRSAPublicKeyPEM([]byte("not a pem"))
+			Expect(err).To(Equal(auth.ErrInvalidKey))
+			By("PEM ok")
+		})
+	})
+
+	Context("JWKS", func() {
+
+		It("should verify with the keys of the set by kid", func() {
+			doc := map[string]interface{}{
+				"keys": []map[string]string{
+					{"kty": "RSA", "kid": "rsa-1", "use": "sig",
+						"n": base64.RawURLEncoding.EncodeToString(rsaKey.PublicKey.N.Bytes()),
+						"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.PublicKey.E)).Bytes())},
+					{"kty": "oct", "kid": "hmac-1", "k": base64.RawURLEncoding.EncodeToString(secret)},
+					{"kty": "oct", "kid": "enc-1", "use": "enc", "k": base64.RawURLEncoding.EncodeToString([]byte("x"))},
+				},
+			}
+			raw, _ := json.Marshal(doc)
+			set, err := auth.ParseJWKS(raw)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(set.Public).To(HaveKey("rsa-1"))
+			Expect(set.Secrets).To(HaveKey("hmac-1"))
+			Expect(set.Secrets).NotTo(HaveKey("enc-1"))
+
+			j := auth.NewJWT(auth.WithJWTOptKeySet(set), auth.WithJWTOptClock(clock))
+			_, err = j.Verify(signRS256(rsaKey, "rsa-1", claims(nil)))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = j.Verify(signHS256(secret, "hmac-1", claims(nil)))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = j.Verify(signHS256(secret, "enc-1", claims(nil)))
+			Expect(err).To(Equal(auth.ErrNoVerifyKey))
+			By("JWKS ok")
+		})
+	})
+})
+
+// signHS256 test token signed with the secret
+func signHS256(secret []byte, kid string, claims map[string]interface{}) string {
+	return signToken(auth.AlgHS256, kid, claims, func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	})
+}
+
+// signRS256 test token signed with the private key
+func signRS256(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	return signToken(auth.AlgRS256, kid, claims, func(signed []byte) []byte {
+		sum := sha256.Sum256(signed)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		if err != nil {
+			Fail(err.Error())
+		}
+		return sig
+	})
+}
+
+func signToken(alg, kid string, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	var sig []byte
+	if sign != nil {
+		sig = sign([]byte(signed))
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"errors"
+)
+
+// actions a role may be granted
+const (
+	ActionRead   = "read"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	// ActionManage change who manages a resource
+	ActionManage = "manage"
+	// ActionWebhooks manage the webhook subscriptions
+	ActionWebhooks = "webhooks"
+	// ActionAll every action, on any resource whoever owns it
+	ActionAll = "*"
+)
+
+var (
+	// ErrForbidden the caller is known but may not do the action
+	ErrForbidden = errors.New("permission denied")
+	// ErrUnknownAction permission name not one of the actions
+	ErrUnknownAction = errors.New("unknown permission")
+
+	// DefaultRoles viewer reads, editor reads, creates and updates, admin does all
+	DefaultRoles = map[string][]string{
+		"viewer": {ActionRead},
+		"editor": {ActionRead, ActionCreate, ActionUpdate},
+		"admin":  {ActionAll},
+	}
+
+	actions = map[string]bool{
+		ActionRead: true, ActionCreate: true, ActionUpdate: true,
+		ActionDelete: true, ActionManage: true, ActionWebhooks: true, ActionAll: true,
+	}
+)
+
+// Owned a resource with a creator and managers
+type Owned interface {
+	Ownership() (owner string, managers []string)
+}
+
+// Policy what each role may do, with the optional per resource ownership
+type Policy struct {
+	Roles     map[string][]string
+	Ownership bool
+	grants    map[string]map[string]bool
+}
+
+// PolicySetup options settings
+type PolicySetup func(*Policy)
+
+// WithPolicyOptRoles opts for the actions of each role, in place of DefaultRoles
+func WithPolicyOptRoles(r map[string][]string) PolicySetup {
+	return func(args *Policy) {
+		if len(r) > 0 {
+			args.Roles = r
+		}
+	}
+}
+
+// WithPolicyOptOwnership opts for updates limited to the owner and managers of the resource
+func WithPolicyOptOwnership(r bool) PolicySetup {
+	return func(args *Policy) {
+		args.Ownership = r
+	}
+}
+
+// NewPolicy new instance, ErrUnknownAction when a role names an action that does not exist
+func NewPolicy(opts ...PolicySetup) (*Policy, error) {
+	p := &Policy{
+		Roles:  DefaultRoles,
+		grants: make(map[string]map[string]bool),
+	}
+	//add options if any
+	for _, setter := range opts {
+		setter(p)
+	}
+	for role, list := range p.Roles {
+		p.grants[role] = make(map[string]bool)
+		for _, action := range list {
+			if !actions[action] {
+				return nil, ErrUnknownAction
+			}
+			p.grants[role][action] = true
+		}
+	}
+	return p, nil
+}
+
+// Can true if 1 of the roles of the caller grants the action, resource aside
+func (p *Policy) Can(who *Principal, action string) bool {
+	if who == nil {
+		return false
+	}
+	for _, role := range who.Roles {
+		if granted := p.grants[role]; granted[action] || granted[ActionAll] {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize nil if the caller may do the action on the resource, res is nil for a new or unknown one.
+// Read, create and delete go by the roles only. With ownership an owned resource is updated by its
+// owner or managers whatever their roles, and only the owner changes the managers; "*" roles bypass it.
+func (p *Policy) Authorize(who *Principal, action string, res Owned) error {
+	if who == nil {
+		return ErrUnauthenticated
+	}
+	switch action {
+	case ActionUpdate, ActionManage:
+		owner, managers := "", []string(nil)
+		if res != nil {
+			owner, managers = res.Ownership()
+		}
+		if !p.Ownership || owner == "" {
+			//no owner to defer to, a plain update
+			action = ActionUpdate
+			break
+		}
+		if owner == who.Subject || p.Can(who, ActionAll) {
+			return nil
+		}
+		if action == ActionUpdate && contains(managers, who.Subject) {
+			return nil
+		}
+		return ErrForbidden
+	}
+	if !p.Can(who, action) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package auth_test
+
+import (
+	"github.com/bayugyug/building-custom-api/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// owned dummy resource
+type owned struct {
+	owner    string
+	managers []string
+}
+
+func (o owned) Ownership() (string, []string) {
+	return o.owner, o.managers
+}
+
+var _ = Describe("REST Building API Service::AUTH POLICY", func() {
+
+	caller := func(subject string, roles ...string) *auth.Principal {
+		return &auth.Principal{Subject: subject, Roles: roles}
+	}
+
+	Context("Roles", func() {
+
+		It("should give each default role its actions", func() {
+			policy, err := auth.NewPolicy()
+			Expect(err).NotTo(HaveOccurred())
+
+			viewer, editor, admin := caller("v", "viewer"), caller("e", "editor"), caller("a", "admin")
+			Expect(policy.Authorize(viewer, auth.ActionRead, nil)).To(Succeed())
+			Expect(policy.Authorize(viewer, auth.ActionCreate, nil)).To(Equal(auth.ErrForbidden))
+			Expect(policy.Authorize(viewer, auth.ActionUpdate, nil)).To(Equal(auth.ErrForbidden))
+
+			Expect(policy.Authorize(editor, auth.ActionCreate, nil)).To(Succeed())
+			Expect(policy.Authorize(editor, auth.ActionUpdate, owned{owner: "x"})).To(Succeed())
+			Expect(policy.Authorize(editor, auth.ActionManage, owned{owner: "x"})).To(Succeed())
+			Expect(policy.Authorize(editor, auth.ActionDelete, nil)).To(Equal(auth.ErrForbidden))
+
+			Expect(policy.Authorize(admin, auth.ActionDelete, owned{owner: "x"})).To(Succeed())
+			By("Roles ok")
+		})
+
+		It("should refuse the anonymous and the unknown roles", func() {
+			policy, _ := auth.NewPolicy()
+			Expect(policy.Authorize(nil, auth.ActionRead, nil)).To(Equal(auth.ErrUnauthenticated))
+			Expect(policy.Authorize(caller("n"), auth.ActionRead, nil)).To(Equal(auth.ErrForbidden))
+			Expect(policy.Authorize(caller("n", "guest"), auth.ActionRead, nil)).To(Equal(auth.ErrForbidden))
+			By("Refuse ok")
+		})
+
+		It("should take the roles of the config", func() {
+			policy, err := auth.NewPolicy(auth.WithPolicyOptRoles(map[string][]string{
+				"auditor": {auth.ActionRead},
+				"janitor": {auth.ActionRead, auth.ActionDelete},
+			}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Authorize(caller("j", "janitor"), auth.ActionDelete, nil)).To(Succeed())
+			Expect(policy.Authorize(caller("e", "editor"), auth.ActionRead, nil)).To(Equal(auth.ErrForbidden))
+
+			_, err = auth.NewPolicy(auth.WithPolicyOptRoles(map[string][]string{"x": {"destroy"}}))
+			Expect(err).To(Equal(auth.ErrUnknownAction))
+			By("Config ok")
+		})
+	})
+
+	Context("Ownership", func() {
+
+		It("should let only the owner and managers update", func() {
+			policy, _ := auth.NewPolicy(auth.WithPolicyOptOwnership(true))
+			res := owned{owner: "alice", managers: []string{"bob"}}
+
+			Expect(policy.Authorize(caller("alice", "editor"), auth.ActionUpdate, res)).To(Succeed())
+			Expect(policy.Authorize(caller("bob", "viewer"), auth.ActionUpdate, res)).To(Succeed())
+			Expect(policy.Authorize(caller("carol", "editor"), auth.ActionUpdate, res)).To(Equal(auth.ErrForbidden))
+			Expect(policy.Authorize(caller("root", "admin"), auth.ActionUpdate, res)).To(Succeed())
+			By("Update ok")
+		})
+
+		It("should let only the owner change the managers", func() {
+			policy, _ := auth.NewPolicy(auth.WithPolicyOptOwnership(true))
+			res := owned{owner: "alice", managers: []string{"bob"}}
+
+			Expect(policy.Authorize(caller("alice", "editor"), auth.ActionManage, res)).To(Succeed())
+			Expect(policy.Authorize(caller("bob", "editor"), auth.ActionManage, res)).To(Equal(auth.ErrForbidden))
+			Expect(policy.Authorize(caller("root", "admin"), auth.ActionManage, res)).To(Succeed())
+			By("Manage ok")
+		})
+
+		It("should not give delete to the owner and fall back to the roles when unowned", func() {
+			policy, _ := auth.NewPolicy(auth.WithPolicyOptOwnership(true))
+			Expect(policy.Authorize(caller("alice", "editor"), auth.ActionDelete, owned{owner: "alice"})).To(Equal(auth.ErrForbidden))
+			Expect(policy.Authorize(caller("carol", "editor"), auth.ActionUpdate, owned{})).To(Succeed())
+			Expect(policy.Authorize(caller("carol", "editor"), auth.ActionUpdate, nil)).To(Succeed())
+			Expect(policy.Authorize(caller("dave", "viewer"), auth.ActionUpdate, owned{})).To(Equal(auth.ErrForbidden))
+			By("Fallback ok")
+		})
+	})
+})
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// authentication methods
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+var (
+	// ErrUnauthenticated no credentials given
+	ErrUnauthenticated = errors.New("missing credentials")
+	// ErrInvalidCredentials credentials given but not accepted
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrTokenExpired token past its exp or before its nbf
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// Principal the authenticated caller
+type Principal struct {
+	Subject string                 `json:"subject"`
+	Method  string                 `json:"method"`
+	Roles   []string               `json:"roles,omitempty"`
+	Claims  map[string]interface{} `json:"-"`
+}
+
+// HasRole true if the caller has the role
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator identify the caller of a request.
+// No credentials of its kind gives nil, nil so the next one is tried.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain try each authenticator in turn, the 1st that identifies the caller wins
+type Chain []Authenticator
+
+// Authenticate the caller, ErrUnauthenticated when none applied
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			return p, nil
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+type principalKey struct{}
+
+// WithPrincipal context carrying the caller
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom caller of the context, nil when anonymous
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
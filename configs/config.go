@@ -1,16 +1,17 @@
 package configs
 
 import (
-	"encoding/json"
 	"flag"
-	"log"
+	"os"
 
 	"github.com/bayugyug/building-custom-api/tools"
 )
 
 const (
 	//status
-	usageConfig = "use to set the config file parameter with HTTP-port"
+	usageConfig     = "use to set the config file parameter with HTTP-port"
+	usageConfigFile = "use to set the path of a yaml or json config file, watched for changes"
+	usagePrint      = "print the effective config, secrets masked, then exit"
 )
 
 var (
@@ -20,15 +21,141 @@ var (
 
 // ParameterConfig optional parameter structure
 type ParameterConfig struct {
-	Port    string `json:"port"`
-	Verbose bool   `json:"showlog"`
+	Port         string                      `json:"port" yaml:"port"`
+	Verbose      bool                        `json:"showlog" yaml:"showlog"`
+	DrainTimeout int                         `json:"draintimeout,omitempty" yaml:"draintimeout,omitempty"`
+	Server       *ServerConfig               `json:"server,omitempty" yaml:"server,omitempty"`
+	Storage      *StorageConfig              `json:"storage,omitempty" yaml:"storage,omitempty"`
+	Validation   map[string]*FieldRuleConfig `json:"validation,omitempty" yaml:"validation,omitempty"`
+	Log          *LogConfig                  `json:"log,omitempty" yaml:"log,omitempty"`
+	Health       *HealthConfig               `json:"health,omitempty" yaml:"health,omitempty"`
+	Auth         *AuthConfig                 `json:"auth,omitempty" yaml:"auth,omitempty"`
+	RateLimit    *RateLimitConfig            `json:"ratelimit,omitempty" yaml:"ratelimit,omitempty"`
+	Idempotency  *IdempotencyConfig          `json:"idempotency,omitempty" yaml:"idempotency,omitempty"`
+	Webhooks     *WebhookConfig              `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+}
+
+// AuthConfig authentication settings, none means the api is open.
+// Roles gives the actions of each role (read, create, update, delete, manage, webhooks or "*"), none keeps viewer, editor, admin.
+// Ownership limits the updates of a building to its creator and managers.
+type AuthConfig struct {
+	APIKeys   []APIKeyConfig      `json:"apikeys,omitempty" yaml:"apikeys,omitempty"`
+	JWT       *JWTConfig          `json:"jwt,omitempty" yaml:"jwt,omitempty"`
+	Public    []string            `json:"public,omitempty" yaml:"public,omitempty"`
+	Roles     map[string][]string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Ownership bool                `json:"ownership,omitempty" yaml:"ownership,omitempty"`
+}
+
+// APIKeyConfig 1 static api key, only its "sha256:<hex>" hash
+type APIKeyConfig struct {
+	Name  string   `json:"name" yaml:"name"`
+	Hash  string   `json:"hash" yaml:"hash" secret:"true"`
+	Roles []string `json:"roles" yaml:"roles"`
+}
+
+// JWTConfig bearer token settings, HS256 secrets, RS256 pem files or a local JWKS file
+type JWTConfig struct {
+	Secrets    []string `json:"secrets,omitempty" yaml:"secrets,omitempty" secret:"true"`
+	PublicKeys []string `json:"publickeys,omitempty" yaml:"publickeys,omitempty"`
+	JWKSFile   string   `json:"jwksfile,omitempty" yaml:"jwksfile,omitempty"`
+	Issuer     string   `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+	Audience   string   `json:"audience,omitempty" yaml:"audience,omitempty"`
+	Leeway     Duration `json:"leeway,omitempty" yaml:"leeway,omitempty"`
+	RolesClaim string   `json:"rolesclaim,omitempty" yaml:"rolesclaim,omitempty"`
+}
+
+// ServerConfig http server settings, the timeouts are durations like "15s"
+type ServerConfig struct {
+	Addr           string      `json:"addr" yaml:"addr"`
+	ReadTimeout    Duration    `json:"readtimeout" yaml:"readtimeout"`
+	WriteTimeout   Duration    `json:"writetimeout" yaml:"writetimeout"`
+	IdleTimeout    Duration    `json:"idletimeout" yaml:"idletimeout"`
+	HandlerTimeout Duration    `json:"handlertimeout" yaml:"handlertimeout"`
+	CORS           *CORSConfig `json:"cors,omitempty" yaml:"cors,omitempty"`
+}
+
+// CORSConfig cross origin settings, missing keeps the default
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowedorigins" yaml:"allowedorigins"`
+	AllowedMethods   []string `json:"allowedmethods" yaml:"allowedmethods"`
+	AllowedHeaders   []string `json:"allowedheaders" yaml:"allowedheaders"`
+	ExposedHeaders   []string `json:"exposedheaders" yaml:"exposedheaders"`
+	AllowCredentials *bool    `json:"allowcredentials,omitempty" yaml:"allowcredentials,omitempty"`
+	MaxAge           int      `json:"maxage" yaml:"maxage"`
+}
+
+// HealthConfig thresholds of the readiness checks
+type HealthConfig struct {
+	SnapshotMaxAge int `json:"snapshotmaxage" yaml:"snapshotmaxage"`
+	MinFreeDiskMB  int `json:"minfreediskmb" yaml:"minfreediskmb"`
+}
+
+// RateLimitConfig per client budgets, reads are GET, HEAD and OPTIONS, the rest are writes.
+// A budget not set is not limited.
+type RateLimitConfig struct {
+	Read        *RateBudget `json:"read,omitempty" yaml:"read,omitempty"`
+	Write       *RateBudget `json:"write,omitempty" yaml:"write,omitempty"`
+	MaxClients  int         `json:"maxclients,omitempty" yaml:"maxclients,omitempty"`
+	IdleTimeout Duration    `json:"idletimeout,omitempty" yaml:"idletimeout,omitempty"`
+}
+
+// RateBudget requests allowed per period, all of them may come at once
+type RateBudget struct {
+	Requests int      `json:"requests" yaml:"requests"`
+	Per      Duration `json:"per" yaml:"per"`
+}
+
+// IdempotencyConfig replies kept for the POST retries with an Idempotency-Key
+type IdempotencyConfig struct {
+	TTL     Duration `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	MaxKeys int      `json:"maxkeys,omitempty" yaml:"maxkeys,omitempty"`
+}
+
+// WebhookConfig delivery of the building changes to the webhook subscriptions, zero keeps the default
+type WebhookConfig struct {
+	Attempts     int      `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	Backoff      Duration `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	MaxBackoff   Duration `json:"maxbackoff,omitempty" yaml:"maxbackoff,omitempty"`
+	Workers      int      `json:"workers,omitempty" yaml:"workers,omitempty"`
+	Timeout      Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	LogSize      int      `json:"logsize,omitempty" yaml:"logsize,omitempty"`
+	AllowPrivate bool     `json:"allowprivate,omitempty" yaml:"allowprivate,omitempty"`
+}
+
+// LogConfig logger settings
+type LogConfig struct {
+	Level  string   `json:"level" yaml:"level"`
+	Redact []string `json:"redact" yaml:"redact"`
+}
+
+// StorageConfig storage driver settings
+type StorageConfig struct {
+	Driver           string `json:"driver" yaml:"driver"`
+	Path             string `json:"path" yaml:"path"`
+	SnapshotInterval int    `json:"snapshotinterval" yaml:"snapshotinterval"`
+	SnapshotEntries  int    `json:"snapshotentries" yaml:"snapshotentries"`
+	ChangeLog        int    `json:"changelog" yaml:"changelog"`
+}
+
+// FieldRuleConfig override of the validation rules of 1 field, missing keeps the default
+type FieldRuleConfig struct {
+	Required  *bool    `json:"required,omitempty" yaml:"required,omitempty"`
+	Trimmed   *bool    `json:"trimmed,omitempty" yaml:"trimmed,omitempty"`
+	MinLength *int     `json:"min_length,omitempty" yaml:"min_length,omitempty"`
+	MaxLength *int     `json:"max_length,omitempty" yaml:"max_length,omitempty"`
+	Pattern   *string  `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Unique    *bool    `json:"unique,omitempty" yaml:"unique,omitempty"`
+	Min       *float64 `json:"min,omitempty" yaml:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty" yaml:"max,omitempty"`
 }
 
 // APISettings is a config mapping
 type APISettings struct {
-	Config    *ParameterConfig
-	CmdParams string
-	Address   string
+	Config      *ParameterConfig
+	CmdParams   string
+	ConfigFile  string
+	PrintConfig bool
+	Address     string
 }
 
 // Setup options settings
@@ -55,6 +182,13 @@ func WithSetupCmdParams(r string) Setup {
 	}
 }
 
+// WithSetupConfigFile for the config file path
+func WithSetupConfigFile(r string) Setup {
+	return func(args *APISettings) {
+		args.ConfigFile = r
+	}
+}
+
 // NewAppSettings main entry for config
 func NewAppSettings(setters ...Setup) *APISettings {
 	//set default
@@ -75,7 +209,7 @@ func (g *APISettings) InitRecov() {
 	defer func() {
 		recvr := recover()
 		if recvr != nil {
-			log.Println("MAIN-RECOV-INIT: ", recvr)
+			tools.Log.Error("MAIN-RECOV-INIT", tools.Fields{"panic": recvr})
 		}
 	}()
 }
@@ -84,6 +218,8 @@ func (g *APISettings) InitRecov() {
 func (g *APISettings) InitEnvParams() {
 	//get options
 	flag.StringVar(&g.CmdParams, "config", g.CmdParams, usageConfig)
+	flag.StringVar(&g.ConfigFile, "config-file", g.ConfigFile, usageConfigFile)
+	flag.BoolVar(&g.PrintConfig, "print-config", g.PrintConfig, usagePrint)
 	flag.Parse()
 }
 
@@ -93,31 +229,91 @@ func (g *APISettings) Initializer() {
 	g.InitRecov()
 	g.InitEnvParams()
 
-	//set default maybe
-	if g.CmdParams == "" {
-		g.CmdParams = `{"port":"8989"}`
+	//defaults < file < env < flags
+	cfg, err := Load(g.ConfigFile, g.CmdParams, os.Environ())
+	if err != nil {
+		tools.Log.Error("Load", tools.Fields{"path": g.ConfigFile, "error": err})
+		return
 	}
+	g.Config = cfg
 
-	//try to reconfigure if there is passed params, otherwise use show err
-	if g.CmdParams != "" {
-		g.Config = g.FormatParameterConfig(g.CmdParams)
-	}
+	//set the logger
+	tools.SetLogger(g.NewLogger())
+}
 
-	//check defaults
-	if g.Config == nil {
-		return
+//NewLogger logger of the config, showlog means debug unless a level is given
+func (g *APISettings) NewLogger() *tools.Logger {
+	level, err := g.Config.LogLevel()
+	if err != nil {
+		tools.Log.Warn("log level", tools.Fields{"level": g.Config.Log.Level, "error": err})
 	}
-	//set dump flag
-	tools.Verbose = g.Config.Verbose
-
+	var redact []string
+	if cfg := g.Config.Log; cfg != nil {
+		redact = cfg.Redact
+	}
+	return tools.NewLogger(
+		tools.WithLoggerOptLevel(level),
+		tools.WithLoggerOptRedact(redact...),
+	)
 }
 
 //FormatParameterConfig new ParameterConfig
 func (g *APISettings) FormatParameterConfig(s string) *ParameterConfig {
-	var cfg ParameterConfig
-	if err := json.Unmarshal([]byte(s), &cfg); err != nil {
-		log.Println("FormatParameterConfig", err)
+	//on top of the file if any
+	var base *ParameterConfig
+	if g.Config != nil {
+		copied := *g.Config
+		base = &copied
+	}
+	cfg, err := ParseConfig([]byte(s), ".json", base)
+	if err != nil {
+		tools.Log.Error("FormatParameterConfig", tools.Fields{"error": err})
 		return nil
 	}
-	return &cfg
+	return cfg
+}
+
+// DefaultConfig the settings before any file, env or flag
+func DefaultConfig() *ParameterConfig {
+	return &ParameterConfig{Port: "8989"}
+}
+
+// Load the effective config, each layer on top of the previous one:
+// defaults < file (yaml or json) < BUILDING_API_* env < --config json.
+func Load(path, params string, environ []string) (*ParameterConfig, error) {
+	cfg := DefaultConfig()
+	if path != "" {
+		if _, err := LoadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := ApplyEnv(cfg, EnvPrefix, environ); err != nil {
+		return nil, err
+	}
+	if params != "" {
+		if _, err := ParseConfig([]byte(params), ".json", cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// Addr listen address, server.addr wins over the port
+func (c *ParameterConfig) Addr() string {
+	if c.Server != nil && c.Server.Addr != "" {
+		return c.Server.Addr
+	}
+	return ":" + c.Port
+}
+
+// LogLevel level of the config, showlog means debug unless a level is given
+func (c *ParameterConfig) LogLevel() (tools.Level, error) {
+	level := tools.LevelInfo
+	if c.Verbose {
+		level = tools.LevelDebug
+	}
+	if c.Log != nil && c.Log.Level != "" {
+		return tools.ParseLevel(c.Log.Level)
+	}
+	return level, nil
 }
@@ -0,0 +1,243 @@
+package configs
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix of the environment variables, BUILDING_API_PORT, BUILDING_API_STORAGE_DRIVER and so on
+const EnvPrefix = "BUILDING_API_"
+
+// secretMask printed in place of a secret
+const secretMask = "******"
+
+// ApplyEnv set the fields of cfg from the environment ("KEY=value" list, like os.Environ).
+// The name is the prefix plus the json names of the path in upper case joined by "_".
+// Lists are comma separated or a json array, maps and the rest are json.
+func ApplyEnv(cfg *ParameterConfig, prefix string, environ []string) error {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		if i := strings.Index(kv, "="); i > 0 && strings.HasPrefix(kv[:i], prefix) {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	_, err := applyEnv(reflect.ValueOf(cfg).Elem(), prefix, env)
+	return err
+}
+
+// EnvNames all the variable names of the config, sorted
+func EnvNames(prefix string) []string {
+	var names []string
+	walkEnvNames(reflect.TypeOf(ParameterConfig{}), prefix, &names)
+	sort.Strings(names)
+	return names
+}
+
+func walkEnvNames(t reflect.Type, prefix string, names *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := envName(field)
+		if name == "" {
+			continue
+		}
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+			walkEnvNames(ft.Elem(), prefix+name+"_", names)
+			continue
+		}
+		*names = append(*names, prefix+name)
+	}
+}
+
+// envName the json name of the field in upper case, empty when not settable
+func envName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return strings.ToUpper(name)
+}
+
+// applyEnv set the struct fields found in env, true if any was set
+func applyEnv(v reflect.Value, prefix string, env map[string]string) (bool, error) {
+	set := false
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := envName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		key := prefix + name
+		fv := v.Field(i)
+		//nested settings
+		if fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct {
+			child := reflect.New(fv.Type().Elem())
+			if !fv.IsNil() {
+				child.Elem().Set(fv.Elem())
+			}
+			ok, err := applyEnv(child.Elem(), key+"_", env)
+			if err != nil {
+				return set, err
+			}
+			if ok {
+				fv.Set(child)
+				set = true
+			}
+			continue
+		}
+		raw, ok := env[key]
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(fv, raw); err != nil {
+			return set, fmt.Errorf("%s: %v", key, err)
+		}
+		set = true
+	}
+	return set, nil
+}
+
+// setEnvValue parse raw into the field
+func setEnvValue(fv reflect.Value, raw string) error {
+	if fv.Kind() == reflect.Ptr {
+		target := reflect.New(fv.Type().Elem())
+		if err := setEnvValue(target.Elem(), raw); err != nil {
+			return err
+		}
+		fv.Set(target)
+		return nil
+	}
+	if tu, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return tu.UnmarshalText([]byte(raw))
+	}
+	raw = strings.TrimSpace(raw)
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(raw, "[") {
+			var list []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			fv.Set(reflect.ValueOf(list))
+			return nil
+		}
+		return json.Unmarshal([]byte(raw), fv.Addr().Interface())
+	default:
+		return json.Unmarshal([]byte(raw), fv.Addr().Interface())
+	}
+	return nil
+}
+
+// Masked copy of the config as indented json, the fields tagged secret:"true" masked
+func Masked(cfg *ParameterConfig) ([]byte, error) {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var copied ParameterConfig
+	if err := json.Unmarshal(raw, &copied); err != nil {
+		return nil, err
+	}
+	maskSecrets(reflect.ValueOf(&copied).Elem())
+	return json.MarshalIndent(copied, "", "  ")
+}
+
+func maskSecrets(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			maskSecrets(v.Elem())
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			fv := v.Field(i)
+			if t.Field(i).Tag.Get("secret") == "true" {
+				maskValue(fv)
+				continue
+			}
+			maskSecrets(fv)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			maskSecrets(v.Index(i))
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			item := v.MapIndex(key)
+			if item.Kind() == reflect.Ptr && !item.IsNil() {
+				maskSecrets(item.Elem())
+			}
+		}
+	}
+}
+
+// maskValue blank out a secret, empty stays empty so a missing secret shows
+func maskValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.Len() > 0 {
+			v.SetString(secretMask)
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			maskValue(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			maskValue(v.Index(i))
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			if v.MapIndex(key).Kind() == reflect.String {
+				v.SetMapIndex(key, reflect.ValueOf(secretMask).Convert(v.Type().Elem()))
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath == "" {
+				maskValue(v.Field(i))
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package configs_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/configs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::CONFIG ENV", func() {
+
+	//init
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "building-env")
+		if err != nil {
+			Fail(err.Error())
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("Environment", func() {
+
+		It("should name a variable per field", func() {
+			names := configs.EnvNames(configs.EnvPrefix)
+			Expect(names).To(ContainElement("BUILDING_API_PORT"))
+			Expect(names).To(ContainElement("BUILDING_API_STORAGE_DRIVER"))
+			Expect(names).To(ContainElement("BUILDING_API_SERVER_CORS_ALLOWEDORIGINS"))
+			Expect(names).To(ContainElement("BUILDING_API_VALIDATION"))
+			Expect(names).To(ContainElement("BUILDING_API_AUTH_JWT_SECRETS"))
+			By("Names ok")
+		})
+
+		It("should parse each kind of field", func() {
+			cfg := configs.DefaultConfig()
+			err := configs.ApplyEnv(cfg, configs.EnvPrefix, []string{
+				"BUILDING_API_SHOWLOG=true",
+				"BUILDING_API_STORAGE_DRIVER=file",
+				"BUILDING_API_STORAGE_SNAPSHOTENTRIES=50",
+				"BUILDING_API_SERVER_READTIMEOUT=5s",
+				"BUILDING_API_SERVER_CORS_ALLOWEDORIGINS=https://a.example.com, https://b.example.com",
+				"BUILDING_API_SERVER_CORS_ALLOWCREDENTIALS=false",
+				`BUILDING_API_VALIDATION={"name":{"max_length":80}}`,
+				"OTHER_PORT=1",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Port).To(Equal("8989"))
+			Expect(cfg.Verbose).To(BeTrue())
+			Expect(cfg.Storage.Driver).To(Equal("file"))
+			Expect(cfg.Storage.SnapshotEntries).To(Equal(50))
+			Expect(cfg.Server.ReadTimeout.D()).To(Equal(5 * time.Second))
+			Expect(cfg.Server.CORS.AllowedOrigins).To(Equal([]string{"https://a.example.com", "https://b.example.com"}))
+			Expect(*cfg.Server.CORS.AllowCredentials).To(BeFalse())
+			Expect(*cfg.Validation["name"].MaxLength).To(Equal(80))
+			Expect(cfg.Log).To(BeNil())
+			By("Parse ok")
+		})
+
+		It("should name the variable at fault", func() {
+			err := configs.ApplyEnv(configs.DefaultConfig(), configs.EnvPrefix, []string{"BUILDING_API_SHOWLOG=maybe"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("BUILDING_API_SHOWLOG"))
+			By("Error ok")
+		})
+	})
+
+	Context("Precedence", func() {
+
+		It("should layer defaults < file < env < flags", func() {
+			path := filepath.Join(dir, "config.yml")
+			Expect(ioutil.WriteFile(path, []byte("port: \"7000\"\nstorage:\n  driver: file\n  path: /from/file\nlog:\n  level: warn\n"), 0644)).To(Succeed())
+			cfg, err := configs.Load(path, `{"log":{"level":"error"}}`, []string{
+				"BUILDING_API_STORAGE_PATH=/from/env",
+				"BUILDING_API_LOG_LEVEL=debug",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Port).To(Equal("7000"))
+			Expect(cfg.Storage.Driver).To(Equal("file"))
+			Expect(cfg.Storage.Path).To(Equal("/from/env"))
+			Expect(cfg.Log.Level).To(Equal("error"))
+
+			cfg, err = configs.Load("", "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Addr()).To(Equal(":8989"))
+			By("Layers ok")
+		})
+
+		It("should print the effective config", func() {
+			cfg, err := configs.Load("", "", []string{"BUILDING_API_PORT=9191"})
+			Expect(err).NotTo(HaveOccurred())
+			raw, err := configs.Masked(cfg)
+			Expect(err).NotTo(HaveOccurred())
+			var printed map[string]interface{}
+			Expect(json.Unmarshal(raw, &printed)).To(Succeed())
+			Expect(printed["port"]).To(Equal("9191"))
+			By("Print ok")
+		})
+
+		It("should mask the auth secrets when printed", func() {
+			cfg := configs.DefaultConfig()
+			cfg.Auth = &configs.AuthConfig{
+				APIKeys: []configs.APIKeyConfig{{Name: "ci", Hash: "sha256:abcd", Roles: []string{"admin"}}},
+				JWT:     &configs.JWTConfig{Secrets: []string{"s3cr3t"}, Issuer: "https://issuer.example.com"},
+			}
+			raw, err := configs.Masked(cfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(raw)).NotTo(ContainSubstring("sha256:abcd"))
+			Expect(string(raw)).NotTo(ContainSubstring("s3cr3t"))
+			Expect(string(raw)).To(ContainSubstring("https://issuer.example.com"))
+			Expect(cfg.Auth.APIKeys[0].Hash).To(Equal("sha256:abcd"))
+			By("Mask ok")
+		})
+	})
+})
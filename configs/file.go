@@ -0,0 +1,113 @@
+package configs
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ErrInvalidDuration neither a duration string nor a number of seconds
+var ErrInvalidDuration = errors.New("invalid duration")
+
+// Duration time.Duration read as "15s" or as a number of seconds
+type Duration time.Duration
+
+// D the time.Duration
+func (d Duration) D() time.Duration {
+	return time.Duration(d)
+}
+
+// String like time.Duration
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON as the duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON from "15s" or 15
+func (d *Duration) UnmarshalJSON(raw []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+// UnmarshalText from "15s" or 15, as given by the environment
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.set(string(text))
+}
+
+// MarshalYAML as the duration string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// UnmarshalYAML from "15s" or 15
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+func (d *Duration) set(v interface{}) error {
+	switch val := v.(type) {
+	case nil:
+		*d = 0
+	case float64:
+		*d = Duration(val * float64(time.Second))
+	case int:
+		*d = Duration(time.Duration(val) * time.Second)
+	case string:
+		if secs, err := strconv.ParseFloat(val, 64); err == nil {
+			*d = Duration(secs * float64(time.Second))
+			return nil
+		}
+		parsed, err := time.ParseDuration(val)
+		if err != nil {
+			return ErrInvalidDuration
+		}
+		*d = Duration(parsed)
+	default:
+		return ErrInvalidDuration
+	}
+	return nil
+}
+
+// LoadFile read a yaml (.yml, .yaml) or json config file on top of cfg, nil cfg means a new one
+func LoadFile(path string, cfg *ParameterConfig) (*ParameterConfig, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(raw, filepath.Ext(path), cfg)
+}
+
+// ParseConfig decode the raw config by its file extension, json unless yaml
+func ParseConfig(raw []byte, ext string, cfg *ParameterConfig) (*ParameterConfig, error) {
+	if cfg == nil {
+		cfg = &ParameterConfig{}
+	}
+	switch strings.ToLower(ext) {
+	case ".yml", ".yaml":
+		if err := yaml.UnmarshalStrict(raw, cfg); err != nil {
+			return nil, err
+		}
+	default:
+		if err := json.Unmarshal(raw, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,107 @@
+package configs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/configs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::CONFIG FILE", func() {
+
+	//init
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "building-config")
+		if err != nil {
+			Fail(err.Error())
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	write := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			Fail(err.Error())
+		}
+		return path
+	}
+
+	Context("Load", func() {
+
+		It("should read the yaml of the config map", func() {
+			path := write("config.yml", `
+server:
+  idletimeout: 15s
+  readtimeout: 15s
+  writetimeout: 10
+  addr: ":9090"
+  cors:
+    allowedorigins: ["https://example.com"]
+log:
+  level: warn
+storage:
+  driver: file
+  path: /tmp/building
+`)
+			cfg, err := configs.LoadFile(path, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Server.Addr).To(Equal(":9090"))
+			Expect(cfg.Addr()).To(Equal(":9090"))
+			Expect(cfg.Server.IdleTimeout.D()).To(Equal(15 * time.Second))
+			Expect(cfg.Server.WriteTimeout.D()).To(Equal(10 * time.Second))
+			Expect(cfg.Server.CORS.AllowedOrigins).To(Equal([]string{"https://example.com"}))
+			Expect(cfg.Log.Level).To(Equal("warn"))
+			Expect(cfg.Storage.Driver).To(Equal("file"))
+			By("Yaml ok")
+		})
+
+		It("should read json and reject unknown yaml keys", func() {
+			path := write("config.json", `{"port":"8181","server":{"readtimeout":"2m"}}`)
+			cfg, err := configs.LoadFile(path, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Addr()).To(Equal(":8181"))
+			Expect(cfg.Server.ReadTimeout.D()).To(Equal(2 * time.Minute))
+
+			_, err = configs.LoadFile(write("bad.yml", "server:\n  readtimout: 15s\n"), nil)
+			Expect(err).To(HaveOccurred())
+			_, err = configs.LoadFile(write("bad.json", `{"server":{"readtimeout":"soon"}}`), nil)
+			Expect(err).To(HaveOccurred())
+			By("Json ok")
+		})
+	})
+
+	Context("Watch", func() {
+
+		It("should reload on change and keep the running config on a broken file", func() {
+			path := write("config.yml", "log:\n  level: info\n")
+			changes := make(chan *configs.ParameterConfig, 4)
+			watcher, err := configs.WatchFile(path, func(cfg *configs.ParameterConfig) {
+				changes <- cfg
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer watcher.Close()
+
+			write("config.yml", "log:\n  level: [broken\n")
+			Consistently(changes, 400*time.Millisecond).ShouldNot(Receive())
+
+			//replaced by rename, like a config map
+			tmp := write("config.yml.tmp", "log:\n  level: debug\n")
+			Expect(os.Rename(tmp, path)).To(Succeed())
+			var cfg *configs.ParameterConfig
+			Eventually(changes, 2*time.Second).Should(Receive(&cfg))
+			Expect(cfg.Log.Level).To(Equal("debug"))
+			By("Watch ok")
+		})
+	})
+})
@@ -0,0 +1,110 @@
+package configs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/tools"
+
+	"gopkg.in/fsnotify/fsnotify.v1"
+)
+
+// watchSettle quiet time after the last event before the file is read, editors write in steps
+const watchSettle = 100 * time.Millisecond
+
+// Watcher reload a config file when it changes
+type Watcher struct {
+	Path     string
+	OnChange func(cfg *ParameterConfig)
+	watcher  *fsnotify.Watcher
+	last     []byte
+	quit     chan struct{}
+	done     chan struct{}
+	once     *sync.Once
+}
+
+// WatchFile call fn with the new config each time the file changes to a valid one.
+// The directory is watched, so a file replaced by rename (editors, kubernetes config maps) is seen too.
+func WatchFile(path string, fn func(cfg *ParameterConfig)) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := fsw.Add(filepath.Dir(path)); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+	w := &Watcher{
+		Path:     path,
+		OnChange: fn,
+		watcher:  fsw,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+		once:     new(sync.Once),
+	}
+	w.last, _ = ioutil.ReadFile(path)
+	go w.run()
+	return w, nil
+}
+
+// Close stop watching
+func (w *Watcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.quit)
+		err = w.watcher.Close()
+		<-w.done
+	})
+	return err
+}
+
+// run wait for the events, settle, then reload
+func (w *Watcher) run() {
+	defer close(w.done)
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-w.quit:
+			return
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+			settle = time.After(watchSettle)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			tools.Log.Warn("config watch", tools.Fields{"path": w.Path, "error": err})
+		case <-settle:
+			settle = nil
+			w.reload()
+		}
+	}
+}
+
+// reload read and parse the file, a broken file keeps the running config
+func (w *Watcher) reload() {
+	raw, err := ioutil.ReadFile(w.Path)
+	if err != nil {
+		//mid replace, the next event reloads
+		return
+	}
+	if bytes.Equal(raw, w.last) {
+		return
+	}
+	cfg, err := ParseConfig(raw, filepath.Ext(w.Path), nil)
+	if err != nil {
+		tools.Log.Error("config reload", tools.Fields{"path": w.Path, "error": err})
+		return
+	}
+	w.last = raw
+	tools.Log.Info("config reload", tools.Fields{"path": w.Path})
+	w.OnChange(cfg)
+}
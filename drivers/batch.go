@@ -0,0 +1,180 @@
+package drivers
+
+import (
+	"sort"
+)
+
+// Batch run fn against a staged view of the store, the writes land together or not at all,
+// fn must only use the given tx as the store stays locked meanwhile
+func (q *Storage) Batch(fn func(tx StorageDriver) error) error {
+	// ensure
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	tx := &batchStorage{
+		base:   q.store,
+		staged: make(map[string]*batchRow),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.entries) <= 0 {
+		return nil
+	}
+	//1 journal commit for the whole batch
+	return q.write(tx.entries...)
+}
+
+// batchRow staged value of a key, gone marks a removed key
+type batchRow struct {
+	data interface{}
+	gone bool
+}
+
+// batchStorage staged writes on top of the store, only used by 1 goroutine inside Batch
+type batchStorage struct {
+	base    map[string]interface{}
+	staged  map[string]*batchRow
+	entries []journalEntry
+}
+
+// get current value of the key
+func (q *batchStorage) get(key string) (interface{}, bool) {
+	if row, oks := q.staged[key]; oks {
+		return row.data, !row.gone
+	}
+	data, oks := q.base[key]
+	return data, oks
+}
+
+// set stage a new value
+func (q *batchStorage) set(key string, data interface{}) {
+	q.staged[key] = &batchRow{data: data}
+	q.entries = append(q.entries, journalEntry{Op: opSet, Key: key, Data: data})
+}
+
+// unset stage a removal
+func (q *batchStorage) unset(key string) {
+	q.staged[key] = &batchRow{gone: true}
+	q.entries = append(q.entries, journalEntry{Op: opUnset, Key: key})
+}
+
+// keys current keys in order
+func (q *batchStorage) keys() []string {
+	keys := make([]string, 0, len(q.base)+len(q.staged))
+	for key := range q.base {
+		if _, oks := q.staged[key]; !oks {
+			keys = append(keys, key)
+		}
+	}
+	for key, row := range q.staged {
+		if !row.gone {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Set new row
+func (q *batchStorage) Set(key string, data interface{}) string {
+	q.set(key, data)
+	return key
+}
+
+// Unset an old record
+func (q *batchStorage) Unset(key string) error {
+	if _, oks := q.get(key); !oks {
+		return ErrRecordNotFound
+	}
+	q.unset(key)
+	return nil
+}
+
+// One get 1 record
+func (q *batchStorage) One(key string) (interface{}, error) {
+	data, oks := q.get(key)
+	if !oks {
+		return nil, ErrRecordNotFound
+	}
+	return data, nil
+}
+
+// All get list of all the records
+func (q *batchStorage) All() ([]interface{}, error) {
+	var all []interface{}
+	for _, key := range q.keys() {
+		data, _ := q.get(key)
+		all = append(all, data)
+	}
+	return all, nil
+}
+
+// Exists check the record
+func (q *batchStorage) Exists(key string) (interface{}, bool) {
+	return q.get(key)
+}
+
+// Count check total len, the index rows left out
+func (q *batchStorage) Count() int {
+	total := 0
+	for _, key := range q.keys() {
+		if !IsIndexKey(key) {
+			total++
+		}
+	}
+	return total
+}
+
+// SetIfAbsent new row only if the key is not taken yet
+func (q *batchStorage) SetIfAbsent(key string, data interface{}) error {
+	if _, oks := q.get(key); oks {
+		return ErrRecordExists
+	}
+	q.set(key, data)
+	return nil
+}
+
+// DeleteIf remove a row when fn returns no error
+func (q *batchStorage) DeleteIf(key string, fn func(data interface{}) error) error {
+	row, oks := q.get(key)
+	if !oks {
+		return ErrRecordNotFound
+	}
+	if err := fn(row); err != nil {
+		return err
+	}
+	q.unset(key)
+	return nil
+}
+
+// CompareAndSwap replace the row only if it is still the old value
+func (q *batchStorage) CompareAndSwap(key string, old, data interface{}) error {
+	row, oks := q.get(key)
+	if !oks {
+		return ErrRecordNotFound
+	}
+	if !sameRow(row, old) {
+		return ErrRecordChanged
+	}
+	q.set(key, data)
+	return nil
+}
+
+// Scan visit the rows in key order starting after the given key until fn returns false
+func (q *batchStorage) Scan(after string, fn func(key string, data interface{}) bool) error {
+	for _, key := range q.keys() {
+		if key <= after {
+			continue
+		}
+		data, _ := q.get(key)
+		if !fn(key, data) {
+			break
+		}
+	}
+	return nil
+}
+
+// Batch already staged, nested batches join the outer one
+func (q *batchStorage) Batch(fn func(tx StorageDriver) error) error {
+	return fn(q)
+}
@@ -0,0 +1,204 @@
+package drivers
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultChangeLog changes kept for the subscribers resuming
+	DefaultChangeLog = 1000
+	// DefaultChangeBuffer changes queued per subscriber, a subscriber falling further behind is dropped
+	DefaultChangeBuffer = 256
+
+	// ChangeCreated a new row
+	ChangeCreated = "created"
+	// ChangeUpdated a row replaced
+	ChangeUpdated = "updated"
+	// ChangeDeleted a row removed
+	ChangeDeleted = "deleted"
+)
+
+// ErrChangesGone the changes asked for are no longer in the log, the subscriber must start over
+var ErrChangesGone = errors.New("changes no longer in the log")
+
+// Change 1 mutation of a row, Before is nil on create and After is nil on delete
+type Change struct {
+	Seq    uint64
+	Type   string
+	Key    string
+	Before interface{}
+	After  interface{}
+	Time   time.Time
+}
+
+// ChangeFeed the last changes in a ring, fanned out to the subscribers.
+// Publishing never waits on a subscriber: a full one is dropped and resumes from the log.
+type ChangeFeed struct {
+	mtx  *sync.Mutex
+	seq  uint64
+	ring []Change
+	next int
+	full bool
+	subs map[*Subscription]struct{}
+}
+
+// Subscription the live changes of 1 subscriber, C is closed when it is dropped or closed
+type Subscription struct {
+	C      <-chan Change
+	c      chan Change
+	feed   *ChangeFeed
+	lagged bool
+}
+
+// NewChangeFeed new instance keeping the last size changes
+func NewChangeFeed(size int) *ChangeFeed {
+	if size <= 0 {
+		size = DefaultChangeLog
+	}
+	return &ChangeFeed{
+		mtx:  new(sync.Mutex),
+		ring: make([]Change, size),
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Seq the sequence number of the last change, 0 before the 1st
+func (f *ChangeFeed) Seq() uint64 {
+	// ensure
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.seq
+}
+
+// Subscribe the changes after the given sequence number: the ones still in the log
+// come back at once, the later ones arrive on the subscription.
+// ErrChangesGone when some of them already left the log or the number is unknown.
+func (f *ChangeFeed) Subscribe(after uint64, buffer int) (*Subscription, []Change, error) {
+	if buffer <= 0 {
+		buffer = DefaultChangeBuffer
+	}
+	// ensure
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	backlog, err := f.since(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := make(chan Change, buffer)
+	sub := &Subscription{C: c, c: c, feed: f}
+	f.subs[sub] = struct{}{}
+	return sub, backlog, nil
+}
+
+// Since the changes after the given sequence number still in the log
+func (f *ChangeFeed) Since(after uint64) ([]Change, error) {
+	// ensure
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.since(after)
+}
+
+// CloseSubscriptions end every subscription, the log keeps recording
+func (f *ChangeFeed) CloseSubscriptions() {
+	// ensure
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for sub := range f.subs {
+		f.drop(sub)
+	}
+}
+
+// since caller must hold the lock
+func (f *ChangeFeed) since(after uint64) ([]Change, error) {
+	if after > f.seq {
+		//from before a restart, the numbers started over
+		return nil, ErrChangesGone
+	}
+	kept := f.next
+	if f.full {
+		kept = len(f.ring)
+	}
+	missing := f.seq - after
+	if missing > uint64(kept) {
+		return nil, ErrChangesGone
+	}
+	changes := make([]Change, 0, missing)
+	for i := int(missing); i > 0; i-- {
+		pos := (f.next - i + len(f.ring)) % len(f.ring)
+		changes = append(changes, f.ring[pos])
+	}
+	return changes, nil
+}
+
+// publish number and keep the changes then hand them to the subscribers, called under the store lock
+func (f *ChangeFeed) publish(changes ...Change) {
+	if f == nil || len(changes) == 0 {
+		return
+	}
+	// ensure
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	now := time.Now()
+	for _, change := range changes {
+		f.seq++
+		change.Seq, change.Time = f.seq, now
+		f.ring[f.next] = change
+		f.next++
+		if f.next == len(f.ring) {
+			f.next, f.full = 0, true
+		}
+		for sub := range f.subs {
+			select {
+			case sub.c <- change:
+			default:
+				//too slow, it resumes from the log
+				sub.lagged = true
+				f.drop(sub)
+			}
+		}
+	}
+}
+
+// drop caller must hold the lock
+func (f *ChangeFeed) drop(sub *Subscription) {
+	if _, ok := f.subs[sub]; ok {
+		delete(f.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Close end the subscription
+func (s *Subscription) Close() {
+	// ensure
+	s.feed.mtx.Lock()
+	defer s.feed.mtx.Unlock()
+	s.feed.drop(s)
+}
+
+// Lagged the subscription was dropped for falling behind, valid once C is closed
+func (s *Subscription) Lagged() bool {
+	// ensure
+	s.feed.mtx.Lock()
+	defer s.feed.mtx.Unlock()
+	return s.lagged
+}
+
+// changeSource driver keeping a change feed
+type changeSource interface {
+	Changes() *ChangeFeed
+}
+
+// Changes the change feed of the store, nil when the driver has none
+func Changes(store StorageDriver) *ChangeFeed {
+	if store == nil {
+		return nil
+	}
+	if s, ok := Unwrap(store).(changeSource); ok {
+		return s.Changes()
+	}
+	return nil
+}
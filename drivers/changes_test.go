@@ -0,0 +1,154 @@
+package drivers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/tools"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::CHANGES", func() {
+
+	var store *drivers.Storage
+
+	BeforeEach(func() {
+		store = drivers.NewStorage()
+	})
+
+	Context("Events", func() {
+
+		It("should number the writes with before and after", func() {
+			sub, backlog, err := store.Changes().Subscribe(0, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(backlog).To(BeEmpty())
+			defer sub.Close()
+
+			store.Set("a", "v1")
+			store.Set("a", "v2")
+			Expect(store.Unset("a")).To(Succeed())
+			Expect(store.Unset("a")).To(Equal(drivers.ErrRecordNotFound))
+
+			var got []drivers.Change
+			for i := 0; i < 3; i++ {
+				got = append(got, <-sub.C)
+			}
+			Expect(got[0]).To(beChange(drivers.ChangeCreated, nil, "v1"))
+			Expect(got[1]).To(beChange(drivers.ChangeUpdated, "v1", "v2"))
+			Expect(got[2]).To(beChange(drivers.ChangeDeleted, "v2", nil))
+			for i, change := range got {
+				Expect(change.Seq).To(Equal(uint64(i + 1)))
+				Expect(change.Key).To(Equal("a"))
+			}
+			Expect(store.Changes().Seq()).To(Equal(uint64(3)))
+			By("Events ok")
+		})
+
+		It("should publish a batch in order", func() {
+			err := store.Batch(func(tx drivers.StorageDriver) error {
+				tx.Set("a", 1)
+				tx.Set("b", 2)
+				return tx.Unset("a")
+			})
+			Expect(err).NotTo(HaveOccurred())
+			changes, err := store.Changes().Since(0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(HaveLen(3))
+			Expect(changes[2]).To(beChange(drivers.ChangeDeleted, 1, nil))
+			By("Batch ok")
+		})
+	})
+
+	Context("Resume", func() {
+
+		It("should give back the changes still in the log", func() {
+			store.SetChangeLog(3)
+			for _, v := range []string{"1", "2", "3", "4", "5"} {
+				store.Set("k"+v, v)
+			}
+			changes, err := store.Changes().Since(3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(HaveLen(2))
+			Expect(changes[0].Seq).To(Equal(uint64(4)))
+			Expect(changes[1].Seq).To(Equal(uint64(5)))
+
+			_, err = store.Changes().Since(1)
+			Expect(err).To(Equal(drivers.ErrChangesGone))
+			_, _, err = store.Changes().Subscribe(9, 0)
+			Expect(err).To(Equal(drivers.ErrChangesGone))
+			changes, err = store.Changes().Since(5)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(BeEmpty())
+			By("Resume ok")
+		})
+	})
+
+	Context("Slow subscribers", func() {
+
+		It("should drop them instead of blocking the writers", func() {
+			sub, _, _ := store.Changes().Subscribe(0, 1)
+			done := make(chan struct{})
+			go func() {
+				for i := 0; i < 10; i++ {
+					store.Set("a", i)
+				}
+				close(done)
+			}()
+			Eventually(done, time.Second).Should(BeClosed())
+
+			Expect((<-sub.C).Seq).To(Equal(uint64(1)))
+			_, open := <-sub.C
+			Expect(open).To(BeFalse())
+			Expect(sub.Lagged()).To(BeTrue())
+			//it catches up from the log
+			changes, err := store.Changes().Since(1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changes).To(HaveLen(9))
+			By("Slow ok")
+		})
+
+		It("should end the subscriptions on close", func() {
+			sub, _, _ := store.Changes().Subscribe(0, 0)
+			store.Changes().CloseSubscriptions()
+			_, open := <-sub.C
+			Expect(open).To(BeFalse())
+			Expect(sub.Lagged()).To(BeFalse())
+			sub.Close()
+			By("Close ok")
+		})
+	})
+
+	Context("Wrapped drivers", func() {
+
+		It("should find the feed behind the metrics and skip the replay", func() {
+			metered := drivers.NewMeteredStorage(store, tools.NewMetrics())
+			Expect(drivers.Changes(metered)).To(BeIdenticalTo(store.Changes()))
+
+			dir, err := ioutil.TempDir("", "building-changes")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			fs, err := drivers.NewFileStorage(dir)
+			Expect(err).NotTo(HaveOccurred())
+			fs.Set("a", "v1")
+			Expect(fs.Changes().Seq()).To(Equal(uint64(1)))
+			Expect(fs.Close()).To(Succeed())
+
+			fs, err = drivers.NewFileStorage(dir)
+			Expect(err).NotTo(HaveOccurred())
+			defer fs.Close()
+			Expect(fs.Count()).To(Equal(1))
+			Expect(fs.Changes().Seq()).To(BeZero())
+			By("Wrapped ok")
+		})
+	})
+})
+
+// beChange match the type, before and after of the change
+func beChange(kind string, before, after interface{}) OmegaMatcher {
+	return WithTransform(func(c drivers.Change) []interface{} {
+		return []interface{}{c.Type, c.Before, c.After}
+	}, Equal([]interface{}{kind, before, after}))
+}
@@ -0,0 +1,413 @@
+package drivers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/tools"
+)
+
+const (
+	fileWALName      = "wal.log"
+	fileSnapshotName = "snapshot.json"
+)
+
+var (
+	// ErrStorageClosed storage is not accepting writes anymore
+	ErrStorageClosed = errors.New("storage closed")
+	// ErrCorruptLog a bad record is followed by good ones, it is not a torn tail
+	ErrCorruptLog = errors.New("corrupt write-ahead log")
+	// ErrStorageFailed a failed write could not be rolled back, the log takes no more writes
+	ErrStorageFailed = errors.New("storage failed")
+)
+
+// Decoder convert a persisted row back to its in-memory value
+type Decoder func(key string, raw []byte) (interface{}, error)
+
+// FileStorage in-memory map persisted via write-ahead log and snapshots
+type FileStorage struct {
+	*Storage
+	Path             string
+	SnapshotInterval time.Duration
+	SnapshotEntries  int
+	Decoder          Decoder
+	wal              *os.File
+	failed           error
+	entries          int
+	snapshotAt       time.Time
+	snapshotErr      error
+	compact          chan struct{}
+	quit             chan struct{}
+	done             chan struct{}
+}
+
+// walRecord 1 line in the write-ahead log
+type walRecord struct {
+	Ops []journalEntry `json:"ops"`
+}
+
+// walReplay 1 line in the write-ahead log before decoding
+type walReplay struct {
+	Ops []struct {
+		Op   string          `json:"op"`
+		Key  string          `json:"key"`
+		Data json.RawMessage `json:"data"`
+	} `json:"ops"`
+}
+
+// fileSnapshot compacted state of the store
+type fileSnapshot struct {
+	Created string                 `json:"created"`
+	Records map[string]interface{} `json:"records"`
+}
+
+// fileSnapshotReplay compacted state of the store before decoding
+type fileSnapshotReplay struct {
+	Created string                     `json:"created"`
+	Records map[string]json.RawMessage `json:"records"`
+}
+
+// FileSetup options settings
+type FileSetup func(*FileStorage)
+
+// WithFileOptDecoder opts for converting persisted rows
+func WithFileOptDecoder(r Decoder) FileSetup {
+	return func(args *FileStorage) {
+		args.Decoder = r
+	}
+}
+
+// WithFileOptSnapshotInterval opts for periodic compaction
+func WithFileOptSnapshotInterval(r time.Duration) FileSetup {
+	return func(args *FileStorage) {
+		args.SnapshotInterval = r
+	}
+}
+
+// WithFileOptSnapshotEntries opts for compaction after n log entries
+func WithFileOptSnapshotEntries(r int) FileSetup {
+	return func(args *FileStorage) {
+		args.SnapshotEntries = r
+	}
+}
+
+// NewFileStorage open the storage under path, replaying snapshot and log
+func NewFileStorage(path string, opts ...FileSetup) (*FileStorage, error) {
+	q := &FileStorage{
+		Storage:          NewStorage(),
+		Path:             path,
+		SnapshotInterval: 5 * time.Minute,
+		SnapshotEntries:  10000,
+		Decoder:          defaultDecoder,
+		compact:          make(chan struct{}, 1),
+		quit:             make(chan struct{}),
+		done:             make(chan struct{}),
+	}
+
+	//add options if any
+	for _, setter := range opts {
+		setter(q)
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	if err := q.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+	wal, err := os.OpenFile(filepath.Join(path, fileWALName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	q.wal = wal
+	q.snapshotAt = time.Now()
+	q.Storage.journal = q
+	go q.compactor()
+	return q, nil
+}
+
+// Append write the entries as 1 log line and fsync, called under the store lock
+func (q *FileStorage) Append(entries ...journalEntry) error {
+	if q.wal == nil {
+		return ErrStorageClosed
+	}
+	if q.failed != nil {
+		return q.failed
+	}
+	line, err := json.Marshal(walRecord{Ops: entries})
+	if err != nil {
+		return err
+	}
+	//the end of the log, where a failed write is cut back to
+	offset, err := q.wal.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := q.wal.Write(append(line, '\n')); err != nil {
+		return q.rollback(offset, err)
+	}
+	if err := q.wal.Sync(); err != nil {
+		return q.rollback(offset, err)
+	}
+	q.entries++
+	//ask for compaction, never block the writer
+	if q.SnapshotEntries > 0 && q.entries >= q.SnapshotEntries {
+		select {
+		case q.compact <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// rollback cut the log back to the offset so a torn line never ends up in the middle of it,
+// when that fails too the storage is marked failed
+func (q *FileStorage) rollback(offset int64, cause error) error {
+	if err := q.wal.Truncate(offset); err != nil {
+		q.failed = fmt.Errorf("%v: %v (rollback of %v)", ErrStorageFailed, err, cause)
+		return q.failed
+	}
+	if _, err := q.wal.Seek(offset, io.SeekStart); err != nil {
+		q.failed = fmt.Errorf("%v: %v (rollback of %v)", ErrStorageFailed, err, cause)
+		return q.failed
+	}
+	return cause
+}
+
+// Snapshot compact the current state and truncate the log
+func (q *FileStorage) Snapshot() error {
+	// ensure
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.wal == nil {
+		return ErrStorageClosed
+	}
+	err := q.snapshot()
+	q.snapshotErr = err
+	if err == nil {
+		q.snapshotAt = time.Now()
+	}
+	return err
+}
+
+// SnapshotStatus time of the last good snapshot (the open time before the 1st) and the error of the last try
+func (q *FileStorage) SnapshotStatus() (time.Time, error) {
+	// ensure
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return q.snapshotAt, q.snapshotErr
+}
+
+// Ping check the log still takes writes
+func (q *FileStorage) Ping() error {
+	// ensure
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.wal == nil {
+		return ErrStorageClosed
+	}
+	return q.failed
+}
+
+// Close flush a final snapshot and release the log
+func (q *FileStorage) Close() error {
+	select {
+	case <-q.quit:
+		return nil
+	default:
+		close(q.quit)
+	}
+	<-q.done
+
+	// ensure
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	err := q.snapshot()
+	if cerr := q.wal.Close(); err == nil {
+		err = cerr
+	}
+	q.wal = nil
+	return err
+}
+
+// snapshot write the map without the index rows atomically then reset the log, caller must hold the lock
+func (q *FileStorage) snapshot() error {
+	snap := fileSnapshot{
+		Created: time.Now().Format(time.RFC3339),
+		Records: make(map[string]interface{}, len(q.store)),
+	}
+	for key, row := range q.store {
+		if !IsIndexKey(key) {
+			snap.Records[key] = row
+		}
+	}
+	raw, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(q.Path, fileSnapshotName+".tmp")
+	if err := writeFileSync(tmp, raw); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(q.Path, fileSnapshotName)); err != nil {
+		return err
+	}
+	if err := syncDir(q.Path); err != nil {
+		return err
+	}
+	//everything in the log is now in the snapshot
+	if err := q.wal.Truncate(0); err != nil {
+		return err
+	}
+	if err := q.wal.Sync(); err != nil {
+		return err
+	}
+	q.entries = 0
+	return nil
+}
+
+// compactor run the snapshot periodically or when the log grows
+func (q *FileStorage) compactor() {
+	defer close(q.done)
+	var tick <-chan time.Time
+	if q.SnapshotInterval > 0 {
+		ticker := time.NewTicker(q.SnapshotInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-q.quit:
+			return
+		case <-tick:
+		case <-q.compact:
+		}
+		if err := q.Snapshot(); err != nil {
+			tools.Log.Error("FileStorage.Snapshot", tools.Fields{"error": err})
+		}
+	}
+}
+
+// loadSnapshot restore the last compacted state if any
+func (q *FileStorage) loadSnapshot() error {
+	raw, err := ioutil.ReadFile(filepath.Join(q.Path, fileSnapshotName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snap fileSnapshotReplay
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return err
+	}
+	for key, row := range snap.Records {
+		data, err := q.Decoder(key, row)
+		if err != nil {
+			return err
+		}
+		q.apply(journalEntry{Op: opSet, Key: key, Data: data})
+	}
+	return nil
+}
+
+// replay re-apply the log on top of the snapshot, dropping a torn tail;
+// a bad record with more records after it stops the startup, nothing is cut off
+func (q *FileStorage) replay() error {
+	name := filepath.Join(q.Path, fileWALName)
+	fh, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var offset int64
+	reader := bufio.NewReader(fh)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			//no newline, the last write did not finish
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var rec walReplay
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			//a torn write is always the last line
+			if _, more := reader.Peek(1); more == nil {
+				return fmt.Errorf("%v: bad record at offset %d of %s", ErrCorruptLog, offset, name)
+			}
+			break
+		}
+		entries := make([]journalEntry, 0, len(rec.Ops))
+		for _, op := range rec.Ops {
+			entry := journalEntry{Op: op.Op, Key: op.Key}
+			if op.Op == opSet {
+				if entry.Data, err = q.Decoder(op.Key, op.Data); err != nil {
+					return err
+				}
+			}
+			entries = append(entries, entry)
+		}
+		q.apply(entries...)
+		q.entries++
+		offset += int64(len(line))
+	}
+	//incomplete write from a crash, cut it off
+	if info, err := fh.Stat(); err == nil && info.Size() > offset {
+		tools.Log.Warn("FileStorage.replay: truncating torn log tail", tools.Fields{"offset": offset})
+		return os.Truncate(name, offset)
+	}
+	return nil
+}
+
+// defaultDecoder generic json value
+func defaultDecoder(key string, raw []byte) (interface{}, error) {
+	var data interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// writeFileSync write and fsync before returning
+func writeFileSync(name string, raw []byte) error {
+	fh, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fh.Write(raw); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Sync(); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+// syncDir persist the directory entry after a rename
+func syncDir(path string) error {
+	dh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dh.Close()
+	return dh.Sync()
+}
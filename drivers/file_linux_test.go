@@ -0,0 +1,55 @@
+// +build linux
+
+package drivers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::FILE-STORAGE-ROLLBACK", func() {
+
+	It("should cut a failed write out of the log", func() {
+		dir, err := ioutil.TempDir("", "building-storage")
+		Expect(err).To(BeZero())
+		defer os.RemoveAll(dir)
+		store, err := drivers.NewFileStorage(dir,
+			drivers.WithFileOptDecoder(models.DecodeRecord), drivers.WithFileOptSnapshotInterval(0))
+		Expect(err).To(BeZero())
+		Expect(store.Set("b1", &models.BuildingData{ID: "b1", Name: "first"})).To(Equal("b1"))
+		name := filepath.Join(dir, "wal.log")
+		info, err := os.Stat(name)
+		Expect(err).To(BeZero())
+
+		//the file size limit lets only the start of the next line in
+		var limit syscall.Rlimit
+		Expect(syscall.Getrlimit(syscall.RLIMIT_FSIZE, &limit)).To(Succeed())
+		short := limit
+		short.Cur = uint64(info.Size()) + 10
+		Expect(syscall.Setrlimit(syscall.RLIMIT_FSIZE, &short)).To(Succeed())
+		key := store.Set("b2", &models.BuildingData{ID: "b2", Name: strings.Repeat("x", 100)})
+		Expect(syscall.Setrlimit(syscall.RLIMIT_FSIZE, &limit)).To(Succeed())
+		Expect(key).To(BeEmpty())
+		after, err := os.Stat(name)
+		Expect(err).To(BeZero())
+		Expect(after.Size()).To(Equal(info.Size()))
+		By("Failed write rolled back")
+
+		Expect(store.Set("b3", &models.BuildingData{ID: "b3", Name: "third"})).To(Equal("b3"))
+		Expect(store.Ping()).To(Succeed())
+		defer store.Close()
+		reopened, err := drivers.NewFileStorage(dir, drivers.WithFileOptDecoder(models.DecodeRecord))
+		Expect(err).To(BeZero())
+		defer reopened.Close()
+		Expect(reopened.Count()).To(Equal(2))
+		By("Next write replayed ok")
+	})
+})
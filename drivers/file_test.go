@@ -0,0 +1,214 @@
+package drivers_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/models"
+	"github.com/icrowley/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::FILE-STORAGE", func() {
+
+	//init
+	var dir string
+	var building models.BuildingData
+
+	open := func(opts ...drivers.FileSetup) *drivers.FileStorage {
+		opts = append([]drivers.FileSetup{drivers.WithFileOptDecoder(models.DecodeRecord)}, opts...)
+		store, err := drivers.NewFileStorage(dir, opts...)
+		if err != nil {
+			Fail(err.Error())
+		}
+		return store
+	}
+
+	newRecord := func() *models.BuildingData {
+		name := fmt.Sprintf("building::%s", fake.DigitsN(15))
+		return &models.BuildingData{
+			ID:      building.HashKey(name),
+			Name:    name,
+			Address: fmt.Sprintf("address::%s", fake.DigitsN(15)),
+			Created: time.Now().Format(time.RFC3339),
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "building-storage")
+		if err != nil {
+			Fail(err.Error())
+		}
+		building = models.BuildingData{}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("Persistence across restarts", func() {
+
+		It("should replay the log", func() {
+			store := open(drivers.WithFileOptSnapshotInterval(0))
+			record := newRecord()
+			Expect(store.Set(record.ID, record)).To(Equal(record.ID))
+			removed := newRecord()
+			Expect(store.Set(removed.ID, removed)).To(Equal(removed.ID))
+			Expect(store.Unset(removed.ID)).To(BeZero())
+
+			//simulate a crash, no final snapshot
+			_, err := os.Stat(filepath.Join(dir, "snapshot.json"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+
+			reopened := open()
+			defer reopened.Close()
+			data, err := reopened.One(record.ID)
+			Expect(err).To(BeZero())
+			rec, ok := data.(*models.BuildingData)
+			Expect(ok).To(BeTrue())
+			Expect(rec.Address).To(Equal(record.Address))
+			_, oks := reopened.Exists(removed.ID)
+			Expect(oks).To(BeFalse())
+			By("Replay ok")
+		})
+
+		It("should replay a batch as 1 commit", func() {
+			store := open(drivers.WithFileOptSnapshotInterval(0))
+			first, second := newRecord(), newRecord()
+			err := store.Batch(func(tx drivers.StorageDriver) error {
+				tx.Set(first.ID, first)
+				tx.Set(second.ID, second)
+				return nil
+			})
+			Expect(err).To(BeZero())
+			raw, err := ioutil.ReadFile(filepath.Join(dir, "wal.log"))
+			Expect(err).To(BeZero())
+			Expect(strings.Count(string(raw), "\n")).To(Equal(1))
+
+			reopened := open()
+			defer reopened.Close()
+			Expect(reopened.Count()).To(Equal(2))
+			By("Batch replay ok")
+		})
+
+		It("should restore from snapshot after close", func() {
+			store := open()
+			for i := 0; i < 5; i++ {
+				record := newRecord()
+				store.Set(record.ID, record)
+			}
+			Expect(store.Close()).To(BeZero())
+
+			raw, err := ioutil.ReadFile(filepath.Join(dir, "wal.log"))
+			Expect(err).To(BeZero())
+			Expect(len(raw)).To(Equal(0))
+
+			reopened := open()
+			defer reopened.Close()
+			Expect(reopened.Count()).To(Equal(5))
+			By("Snapshot ok")
+		})
+
+		It("should leave the index rows out of the snapshot", func() {
+			store := open()
+			record := newRecord()
+			store.Set(record.ID, record)
+			store.Set(drivers.IndexPrefix+"name::"+record.ID, &models.BuildingIndex{ID: record.ID, Name: record.Name})
+			Expect(store.Count()).To(Equal(1))
+			Expect(store.Close()).To(BeZero())
+
+			reopened := open()
+			defer reopened.Close()
+			Expect(reopened.Count()).To(Equal(1))
+			_, oks := reopened.Exists(drivers.IndexPrefix + "name::" + record.ID)
+			Expect(oks).To(BeFalse())
+			By("Index rows not snapshotted")
+		})
+
+		It("should compact after too many log entries", func() {
+			store := open(drivers.WithFileOptSnapshotEntries(3))
+			defer store.Close()
+			for i := 0; i < 3; i++ {
+				record := newRecord()
+				store.Set(record.ID, record)
+			}
+			Eventually(func() bool {
+				_, err := os.Stat(filepath.Join(dir, "snapshot.json"))
+				return err == nil
+			}).Should(BeTrue())
+			By("Compaction ok")
+		})
+
+		It("should drop a torn log tail", func() {
+			store := open(drivers.WithFileOptSnapshotInterval(0))
+			record := newRecord()
+			store.Set(record.ID, record)
+
+			fh, err := os.OpenFile(filepath.Join(dir, "wal.log"), os.O_WRONLY|os.O_APPEND, 0644)
+			Expect(err).To(BeZero())
+			fh.WriteString(`{"ops":[{"op":"set","key":"half`)
+			fh.Close()
+
+			reopened := open()
+			defer reopened.Close()
+			Expect(reopened.Count()).To(Equal(1))
+			By("Torn tail ignored")
+		})
+
+		It("should drop a bad last line", func() {
+			store := open(drivers.WithFileOptSnapshotInterval(0))
+			record := newRecord()
+			store.Set(record.ID, record)
+			name := filepath.Join(dir, "wal.log")
+			info, err := os.Stat(name)
+			Expect(err).To(BeZero())
+
+			fh, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+			Expect(err).To(BeZero())
+			fh.WriteString("{\"ops\":[{\"op\":\n")
+			fh.Close()
+
+			reopened := open()
+			defer reopened.Close()
+			Expect(reopened.Count()).To(Equal(1))
+			after, err := os.Stat(name)
+			Expect(err).To(BeZero())
+			Expect(after.Size()).To(Equal(info.Size()))
+			By("Bad last line cut off")
+		})
+
+		It("should refuse a bad line in the middle of the log", func() {
+			store := open(drivers.WithFileOptSnapshotInterval(0))
+			first := newRecord()
+			store.Set(first.ID, first)
+			name := filepath.Join(dir, "wal.log")
+			info, err := os.Stat(name)
+			Expect(err).To(BeZero())
+
+			fh, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+			Expect(err).To(BeZero())
+			fh.WriteString("not json\n")
+			fh.Close()
+			second := newRecord()
+			store.Set(second.ID, second)
+			raw, err := ioutil.ReadFile(name)
+			Expect(err).To(BeZero())
+
+			_, err = drivers.NewFileStorage(dir, drivers.WithFileOptDecoder(models.DecodeRecord))
+			Expect(err).NotTo(BeZero())
+			Expect(err.Error()).To(HavePrefix(drivers.ErrCorruptLog.Error()))
+			Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("offset %d", info.Size())))
+			kept, err := ioutil.ReadFile(name)
+			Expect(err).To(BeZero())
+			Expect(kept).To(Equal(raw))
+			By("Corrupt log kept")
+		})
+	})
+})
@@ -0,0 +1,107 @@
+package drivers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultMinFreeDisk free bytes the file storage needs to stay ready
+const DefaultMinFreeDisk = 64 << 20
+
+var (
+	// ErrSnapshotStale no good snapshot for longer than allowed
+	ErrSnapshotStale = errors.New("snapshot stale")
+	// ErrDiskLow free disk space below the minimum
+	ErrDiskLow = errors.New("disk space low")
+)
+
+// HealthCheck 1 named dependency check, nil means healthy
+type HealthCheck struct {
+	Name  string
+	Check func() error
+}
+
+// HealthSettings thresholds of the storage checks, zero means the default
+type HealthSettings struct {
+	SnapshotMaxAge time.Duration
+	MinFreeDisk    uint64
+}
+
+// pinger driver able to tell it is reachable
+type pinger interface {
+	Ping() error
+}
+
+// unwrapper driver wrapping another one
+type unwrapper interface {
+	Unwrap() StorageDriver
+}
+
+// Unwrap the innermost driver of the wrappers
+func Unwrap(store StorageDriver) StorageDriver {
+	for {
+		w, ok := store.(unwrapper)
+		if !ok {
+			return store
+		}
+		store = w.Unwrap()
+	}
+}
+
+// Ping check the store is reachable and loaded
+func Ping(store StorageDriver) error {
+	if store == nil {
+		return ErrStorageClosed
+	}
+	if p, ok := Unwrap(store).(pinger); ok {
+		return p.Ping()
+	}
+	return nil
+}
+
+// Ping the memory store is always reachable
+func (q *Storage) Ping() error {
+	return nil
+}
+
+// HealthChecks the readiness checks of the store, file storage adds snapshot age and disk space
+func HealthChecks(store StorageDriver, opts HealthSettings) []HealthCheck {
+	checks := []HealthCheck{{Name: "storage", Check: func() error { return Ping(store) }}}
+	fs, ok := Unwrap(store).(*FileStorage)
+	if !ok {
+		return checks
+	}
+	maxAge := opts.SnapshotMaxAge
+	if maxAge <= 0 && fs.SnapshotInterval > 0 {
+		//a few missed runs before it counts
+		maxAge = 3 * fs.SnapshotInterval
+	}
+	if maxAge > 0 {
+		checks = append(checks, HealthCheck{Name: "snapshot", Check: func() error {
+			at, err := fs.SnapshotStatus()
+			if age := time.Since(at); age > maxAge {
+				if err != nil {
+					return fmt.Errorf("%v: last good %s ago: %v", ErrSnapshotStale, age.Round(time.Second), err)
+				}
+				return fmt.Errorf("%v: last good %s ago", ErrSnapshotStale, age.Round(time.Second))
+			}
+			return nil
+		}})
+	}
+	minFree := opts.MinFreeDisk
+	if minFree == 0 {
+		minFree = DefaultMinFreeDisk
+	}
+	checks = append(checks, HealthCheck{Name: "disk", Check: func() error {
+		free, err := FreeDisk(fs.Path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%v: %d bytes free, %d needed", ErrDiskLow, free, minFree)
+		}
+		return nil
+	}})
+	return checks
+}
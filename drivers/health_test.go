@@ -0,0 +1,87 @@
+package drivers_test
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/tools"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::STORAGE HEALTH", func() {
+
+	//init
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "building-health")
+		if err != nil {
+			Fail(err.Error())
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	run := func(checks []drivers.HealthCheck) map[string]error {
+		res := make(map[string]error)
+		for _, check := range checks {
+			res[check.Name] = check.Check()
+		}
+		return res
+	}
+
+	Context("Health checks", func() {
+
+		It("should only ping the memory storage", func() {
+			res := run(drivers.HealthChecks(drivers.NewStorage(), drivers.HealthSettings{}))
+			Expect(res).To(HaveLen(1))
+			Expect(res["storage"]).NotTo(HaveOccurred())
+			By("Memory ok")
+		})
+
+		It("should check the file storage through a wrapper", func() {
+			store, err := drivers.NewFileStorage(dir)
+			Expect(err).NotTo(HaveOccurred())
+			metered := drivers.NewMeteredStorage(store, tools.NewMetrics())
+			res := run(drivers.HealthChecks(metered, drivers.HealthSettings{}))
+			Expect(res).To(HaveLen(3))
+			Expect(res["storage"]).NotTo(HaveOccurred())
+			Expect(res["snapshot"]).NotTo(HaveOccurred())
+			Expect(res["disk"]).NotTo(HaveOccurred())
+
+			Expect(store.Close()).To(Succeed())
+			res = run(drivers.HealthChecks(metered, drivers.HealthSettings{}))
+			Expect(res["storage"]).To(Equal(drivers.ErrStorageClosed))
+			By("File ok")
+		})
+
+		It("should fail on a stale snapshot and low disk", func() {
+			store, err := drivers.NewFileStorage(dir)
+			Expect(err).NotTo(HaveOccurred())
+			defer store.Close()
+			res := run(drivers.HealthChecks(store, drivers.HealthSettings{
+				SnapshotMaxAge: time.Nanosecond,
+				MinFreeDisk:    math.MaxUint64,
+			}))
+			Expect(res["snapshot"]).To(HaveOccurred())
+			Expect(strings.HasPrefix(res["snapshot"].Error(), drivers.ErrSnapshotStale.Error())).To(BeTrue())
+			Expect(res["disk"]).To(HaveOccurred())
+			Expect(strings.HasPrefix(res["disk"].Error(), drivers.ErrDiskLow.Error())).To(BeTrue())
+
+			//a good snapshot resets the age
+			Expect(store.Snapshot()).To(Succeed())
+			at, err := store.SnapshotStatus()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Since(at)).To(BeNumerically("<", time.Minute))
+			By("Thresholds ok")
+		})
+	})
+})
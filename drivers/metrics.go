@@ -0,0 +1,130 @@
+package drivers
+
+import (
+	"time"
+
+	"github.com/bayugyug/building-custom-api/tools"
+)
+
+// StorageBuckets latency buckets in seconds, sized for map and journal writes
+var StorageBuckets = []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1}
+
+// MeteredStorage wraps a driver counting and timing each operation
+type MeteredStorage struct {
+	StorageDriver
+	ops     *tools.CounterVec
+	latency *tools.HistogramVec
+}
+
+// NewMeteredStorage register the storage metrics and wrap the driver
+func NewMeteredStorage(store StorageDriver, metrics *tools.Metrics) *MeteredStorage {
+	metrics.Gauge("storage_records", "Number of records in the storage.", func() float64 {
+		return float64(store.Count())
+	})
+	return &MeteredStorage{
+		StorageDriver: store,
+		ops: metrics.Counter("storage_operations_total",
+			"Storage operations by operation and result.", "op", "result"),
+		latency: metrics.Histogram("storage_operation_duration_seconds",
+			"Storage operation latencies in seconds.", StorageBuckets, "op"),
+	}
+}
+
+// Unwrap the metered driver
+func (q *MeteredStorage) Unwrap() StorageDriver {
+	return q.StorageDriver
+}
+
+// observe count and time 1 operation
+func (q *MeteredStorage) observe(op string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	q.ops.Inc(op, result)
+	q.latency.Observe(time.Since(start).Seconds(), op)
+}
+
+// Set new row
+func (q *MeteredStorage) Set(key string, data interface{}) string {
+	start := time.Now()
+	res := q.StorageDriver.Set(key, data)
+	var err error
+	if res == "" {
+		err = ErrRecordChanged
+	}
+	q.observe("set", start, err)
+	return res
+}
+
+// Unset an old record
+func (q *MeteredStorage) Unset(key string) error {
+	start := time.Now()
+	err := q.StorageDriver.Unset(key)
+	q.observe("unset", start, err)
+	return err
+}
+
+// One get 1 row
+func (q *MeteredStorage) One(key string) (interface{}, error) {
+	start := time.Now()
+	data, err := q.StorageDriver.One(key)
+	q.observe("one", start, err)
+	return data, err
+}
+
+// All get all rows
+func (q *MeteredStorage) All() ([]interface{}, error) {
+	start := time.Now()
+	rows, err := q.StorageDriver.All()
+	q.observe("all", start, err)
+	return rows, err
+}
+
+// Exists check if key is present
+func (q *MeteredStorage) Exists(key string) (interface{}, bool) {
+	start := time.Now()
+	data, ok := q.StorageDriver.Exists(key)
+	q.observe("exists", start, nil)
+	return data, ok
+}
+
+// SetIfAbsent new row only if the key is free
+func (q *MeteredStorage) SetIfAbsent(key string, data interface{}) error {
+	start := time.Now()
+	err := q.StorageDriver.SetIfAbsent(key, data)
+	q.observe("set_if_absent", start, err)
+	return err
+}
+
+// DeleteIf remove a row when fn allows it
+func (q *MeteredStorage) DeleteIf(key string, fn func(data interface{}) error) error {
+	start := time.Now()
+	err := q.StorageDriver.DeleteIf(key, fn)
+	q.observe("delete_if", start, err)
+	return err
+}
+
+// CompareAndSwap replace a row only if it was not changed
+func (q *MeteredStorage) CompareAndSwap(key string, old, data interface{}) error {
+	start := time.Now()
+	err := q.StorageDriver.CompareAndSwap(key, old, data)
+	q.observe("compare_and_swap", start, err)
+	return err
+}
+
+// Scan walk the rows in key order
+func (q *MeteredStorage) Scan(after string, fn func(key string, data interface{}) bool) error {
+	start := time.Now()
+	err := q.StorageDriver.Scan(after, fn)
+	q.observe("scan", start, err)
+	return err
+}
+
+// Batch all or nothing, timed as 1 operation
+func (q *MeteredStorage) Batch(fn func(tx StorageDriver) error) error {
+	start := time.Now()
+	err := q.StorageDriver.Batch(fn)
+	q.observe("batch", start, err)
+	return err
+}
@@ -0,0 +1,64 @@
+package drivers_test
+
+import (
+	"bytes"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/tools"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::STORAGE METRICS", func() {
+
+	//init
+	var registry *tools.Metrics
+	var store *drivers.MeteredStorage
+
+	BeforeEach(func() {
+		registry = tools.NewMetrics()
+		store = drivers.NewMeteredStorage(drivers.NewStorage(), registry)
+	})
+
+	scrape := func() string {
+		var out bytes.Buffer
+		_, err := registry.WriteTo(&out)
+		Expect(err).NotTo(HaveOccurred())
+		return out.String()
+	}
+
+	Context("Metered storage", func() {
+
+		It("should count each operation by result", func() {
+			Expect(store.SetIfAbsent("k1", "v1")).To(Succeed())
+			Expect(store.SetIfAbsent("k1", "v1")).To(Equal(drivers.ErrRecordExists))
+			_, err := store.One("k1")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = store.One("k2")
+			Expect(err).To(Equal(drivers.ErrRecordNotFound))
+			Expect(store.Batch(func(tx drivers.StorageDriver) error {
+				tx.Set("k2", "v2")
+				return nil
+			})).To(Succeed())
+
+			out := scrape()
+			Expect(out).To(ContainSubstring(`storage_operations_total{op="set_if_absent",result="ok"} 1`))
+			Expect(out).To(ContainSubstring(`storage_operations_total{op="set_if_absent",result="error"} 1`))
+			Expect(out).To(ContainSubstring(`storage_operations_total{op="one",result="error"} 1`))
+			Expect(out).To(ContainSubstring(`storage_operations_total{op="batch",result="ok"} 1`))
+			Expect(out).To(ContainSubstring(`storage_operation_duration_seconds_count{op="one"} 2`))
+			Expect(out).To(ContainSubstring(`storage_operation_duration_seconds_bucket{op="one",le="+Inf"} 2`))
+			Expect(out).To(ContainSubstring("# TYPE storage_operation_duration_seconds histogram"))
+			By("Count ok")
+		})
+
+		It("should give the record count as a gauge", func() {
+			store.Set("k1", "v1")
+			store.Set("k2", "v2")
+			Expect(scrape()).To(ContainSubstring("storage_records 2\n"))
+			Expect(store.Unset("k1")).To(Succeed())
+			Expect(scrape()).To(ContainSubstring("storage_records 1\n"))
+			By("Gauge ok")
+		})
+	})
+})
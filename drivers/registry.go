@@ -0,0 +1,91 @@
+package drivers
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownDriver no driver registered with the name
+	ErrUnknownDriver = errors.New("unknown storage driver")
+
+	registry    = make(map[string]Factory)
+	registryMtx = new(sync.Mutex)
+)
+
+// Options settings passed to a driver factory
+type Options struct {
+	Path             string
+	SnapshotInterval time.Duration
+	SnapshotEntries  int
+	ChangeLog        int
+	Decoder          Decoder
+}
+
+// Factory create a new driver instance
+type Factory func(opts Options) (StorageDriver, error)
+
+func init() {
+	Register("memory", func(opts Options) (StorageDriver, error) {
+		store := NewStorage()
+		if opts.ChangeLog > 0 {
+			store.SetChangeLog(opts.ChangeLog)
+		}
+		return store, nil
+	})
+	Register("file", func(opts Options) (StorageDriver, error) {
+		setters := []FileSetup{}
+		if opts.Decoder != nil {
+			setters = append(setters, WithFileOptDecoder(opts.Decoder))
+		}
+		if opts.SnapshotInterval > 0 {
+			setters = append(setters, WithFileOptSnapshotInterval(opts.SnapshotInterval))
+		}
+		if opts.SnapshotEntries > 0 {
+			setters = append(setters, WithFileOptSnapshotEntries(opts.SnapshotEntries))
+		}
+		store, err := NewFileStorage(opts.Path, setters...)
+		if err == nil && opts.ChangeLog > 0 {
+			store.SetChangeLog(opts.ChangeLog)
+		}
+		return store, err
+	})
+}
+
+// Register make a driver available by name, replacing any previous one
+func Register(name string, factory Factory) {
+	// ensure
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+	registry[name] = factory
+}
+
+// Open create the driver registered by name, empty means memory
+func Open(name string, opts Options) (StorageDriver, error) {
+	if name == "" {
+		name = "memory"
+	}
+	// ensure
+	registryMtx.Lock()
+	factory, oks := registry[name]
+	registryMtx.Unlock()
+	if !oks {
+		return nil, ErrUnknownDriver
+	}
+	return factory(opts)
+}
+
+// Drivers list of registered driver names
+func Drivers() []string {
+	// ensure
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,42 +2,101 @@ package drivers
 
 import (
 	"errors"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
 )
 
+// IndexPrefix keys of the secondary indexes kept by the models next to their rows:
+// they are journaled with the rows but not counted, published as changes or snapshotted,
+// the models rebuild them on start
+const IndexPrefix = "index::"
+
 var (
 	// ErrRecordNotFound not found record
 	ErrRecordNotFound = errors.New("record not found")
+	// ErrRecordExists key already taken
+	ErrRecordExists = errors.New("record exists")
+	// ErrRecordChanged row was replaced since it was read
+	ErrRecordChanged = errors.New("record changed")
 )
 
-// StorageDriver in-memory map
+// StorageDriver the store used by the models
 type StorageDriver interface {
 	Set(key string, data interface{}) string
 	Unset(key string) error
 	One(key string) (interface{}, error)
 	All() ([]interface{}, error)
+	Exists(key string) (interface{}, bool)
+	Count() int
+	SetIfAbsent(key string, data interface{}) error
+	DeleteIf(key string, fn func(data interface{}) error) error
+	CompareAndSwap(key string, old, data interface{}) error
+	Scan(after string, fn func(key string, data interface{}) bool) error
+	Batch(fn func(tx StorageDriver) error) error
+}
+
+const (
+	opSet   = "set"
+	opUnset = "unset"
+)
+
+// journal persist the mutations before they reach the map
+type journal interface {
+	Append(entries ...journalEntry) error
+}
+
+// journalEntry 1 mutation of the store
+type journalEntry struct {
+	Op   string      `json:"op"`
+	Key  string      `json:"key"`
+	Data interface{} `json:"data,omitempty"`
 }
 
 // Storage in-memory map
 type Storage struct {
-	store map[string]interface{}
-	mtx   *sync.Mutex
+	store   map[string]interface{}
+	indexed int
+	mtx     *sync.Mutex
+	journal journal
+	changes *ChangeFeed
 }
 
 // NewStorage new storage object
 func NewStorage() *Storage {
 	return &Storage{
-		store: make(map[string]interface{}),
-		mtx:   new(sync.Mutex),
+		store:   make(map[string]interface{}),
+		mtx:     new(sync.Mutex),
+		changes: NewChangeFeed(DefaultChangeLog),
 	}
 }
 
+// Changes the feed of the writes
+func (q *Storage) Changes() *ChangeFeed {
+	// ensure
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return q.changes
+}
+
+// SetChangeLog keep the last size changes, the current log and subscriptions are dropped
+func (q *Storage) SetChangeLog(size int) {
+	// ensure
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.changes.CloseSubscriptions()
+	q.changes = NewChangeFeed(size)
+}
+
 // Set new row
 func (q *Storage) Set(key string, data interface{}) string {
 	// ensure
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
-	q.store[key] = data
+	if err := q.write(journalEntry{Op: opSet, Key: key, Data: data}); err != nil {
+		return ""
+	}
 	return key
 }
 
@@ -48,8 +107,7 @@ func (q *Storage) Unset(key string) error {
 	defer q.mtx.Unlock()
 	if _, oks := q.store[key]; oks {
 		//delete
-		delete(q.store, key)
-		return nil
+		return q.write(journalEntry{Op: opUnset, Key: key})
 	}
 	//give it back ;-)
 	return ErrRecordNotFound
@@ -93,11 +151,141 @@ func (q *Storage) Exists(key string) (interface{}, bool) {
 	return row, oks
 }
 
-// Count check total len
+// Count check total len, the index rows left out
 func (q *Storage) Count() int {
 	// ensure
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
 	//give it back ;-)
-	return len(q.store)
+	return len(q.store) - q.indexed
+}
+
+// SetIfAbsent new row only if the key is not taken yet
+func (q *Storage) SetIfAbsent(key string, data interface{}) error {
+	// ensure
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if _, oks := q.store[key]; oks {
+		return ErrRecordExists
+	}
+	//give it back ;-)
+	return q.write(journalEntry{Op: opSet, Key: key, Data: data})
+}
+
+// DeleteIf remove a row when fn returns no error
+func (q *Storage) DeleteIf(key string, fn func(data interface{}) error) error {
+	// ensure
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	row, oks := q.store[key]
+	if !oks {
+		return ErrRecordNotFound
+	}
+	if err := fn(row); err != nil {
+		return err
+	}
+	//give it back ;-)
+	return q.write(journalEntry{Op: opUnset, Key: key})
+}
+
+// CompareAndSwap replace the row only if it is still the old value: the same pointer or an equal value
+func (q *Storage) CompareAndSwap(key string, old, data interface{}) error {
+	// ensure
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	row, oks := q.store[key]
+	if !oks {
+		return ErrRecordNotFound
+	}
+	if !sameRow(row, old) {
+		return ErrRecordChanged
+	}
+	//give it back ;-)
+	return q.write(journalEntry{Op: opSet, Key: key, Data: data})
+}
+
+// sameRow pointers match by identity, other values by content as maps and slices cannot be compared with ==
+func sameRow(row, old interface{}) bool {
+	vrow, vold := reflect.ValueOf(row), reflect.ValueOf(old)
+	if vrow.Kind() == reflect.Ptr && vold.Kind() == reflect.Ptr {
+		return vrow.Type() == vold.Type() && vrow.Pointer() == vold.Pointer()
+	}
+	return reflect.DeepEqual(row, old)
+}
+
+// Scan visit the rows in key order starting after the given key until fn returns false
+func (q *Storage) Scan(after string, fn func(key string, data interface{}) bool) error {
+	// ensure
+	q.mtx.Lock()
+	keys := make([]string, 0, len(q.store))
+	for key := range q.store {
+		if key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	rows := make([]interface{}, len(keys))
+	for i, key := range keys {
+		rows[i] = q.store[key]
+	}
+	q.mtx.Unlock()
+
+	//visit outside the lock, fn may call back into the store
+	for i, key := range keys {
+		if !fn(key, rows[i]) {
+			break
+		}
+	}
+	//give it back ;-)
+	return nil
+}
+
+// write journal then apply the entries and publish the changes, caller must hold the lock
+func (q *Storage) write(entries ...journalEntry) error {
+	if q.journal != nil {
+		if err := q.journal.Append(entries...); err != nil {
+			return err
+		}
+	}
+	changes := make([]Change, 0, len(entries))
+	for _, entry := range entries {
+		before, existed := q.store[entry.Key]
+		q.apply(entry)
+		switch {
+		case IsIndexKey(entry.Key):
+			//bookkeeping of the models, not a change of the data
+		case entry.Op == opUnset && existed:
+			changes = append(changes, Change{Type: ChangeDeleted, Key: entry.Key, Before: before})
+		case entry.Op == opSet && existed:
+			changes = append(changes, Change{Type: ChangeUpdated, Key: entry.Key, Before: before, After: entry.Data})
+		case entry.Op == opSet:
+			changes = append(changes, Change{Type: ChangeCreated, Key: entry.Key, After: entry.Data})
+		}
+	}
+	q.changes.publish(changes...)
+	return nil
+}
+
+// apply the entries to the map, caller must hold the lock
+func (q *Storage) apply(entries ...journalEntry) {
+	for _, entry := range entries {
+		_, existed := q.store[entry.Key]
+		switch entry.Op {
+		case opSet:
+			q.store[entry.Key] = entry.Data
+			if !existed && IsIndexKey(entry.Key) {
+				q.indexed++
+			}
+		case opUnset:
+			delete(q.store, entry.Key)
+			if existed && IsIndexKey(entry.Key) {
+				q.indexed--
+			}
+		}
+	}
+}
+
+// IsIndexKey check if the key belongs to a secondary index
+func IsIndexKey(key string) bool {
+	return strings.HasPrefix(key, IndexPrefix)
 }
@@ -2,6 +2,8 @@ package drivers_test
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bayugyug/building-custom-api/drivers"
@@ -33,7 +35,7 @@ var _ = Describe("REST Building API Service::STORAGE", func() {
 					ID:      pid,
 					Name:    name,
 					Address: fmt.Sprintf("address::%s", fake.DigitsN(15)),
-					Floors:  tools.Seeder{}.CreateFloors(),
+					Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 					Created: time.Now().Format(time.RFC3339),
 				}
 				gid := store.Set(pid, record)
@@ -53,7 +55,7 @@ var _ = Describe("REST Building API Service::STORAGE", func() {
 					ID:      pid,
 					Name:    name,
 					Address: fmt.Sprintf("address::%s", fake.DigitsN(15)),
-					Floors:  tools.Seeder{}.CreateFloors(),
+					Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 					Created: time.Now().Format(time.RFC3339),
 				}
 				gid := store.Set(pid, record)
@@ -68,7 +70,7 @@ var _ = Describe("REST Building API Service::STORAGE", func() {
 					ID:       pid,
 					Name:     name,
 					Address:  fmt.Sprintf("updated::address::%s", fake.DigitsN(15)),
-					Floors:   tools.Seeder{}.CreateFloors(),
+					Floors:   models.NewFloorList(tools.Seeder{}.CreateFloors()),
 					Modified: time.Now().Format(time.RFC3339),
 				}
 				gid = store.Set(pid, record)
@@ -98,7 +100,7 @@ var _ = Describe("REST Building API Service::STORAGE", func() {
 					ID:      pid,
 					Name:    name,
 					Address: fmt.Sprintf("address::%s", fake.DigitsN(15)),
-					Floors:  tools.Seeder{}.CreateFloors(),
+					Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 					Created: time.Now().Format(time.RFC3339),
 				}
 				gid := store.Set(pid, record)
@@ -131,7 +133,7 @@ var _ = Describe("REST Building API Service::STORAGE", func() {
 					ID:      pid,
 					Name:    name,
 					Address: fmt.Sprintf("address::%s", fake.DigitsN(15)),
-					Floors:  tools.Seeder{}.CreateFloors(),
+					Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 					Created: time.Now().Format(time.RFC3339),
 				}
 				gid := store.Set(pid, record)
@@ -165,7 +167,7 @@ var _ = Describe("REST Building API Service::STORAGE", func() {
 						ID:      pid,
 						Name:    name,
 						Address: fmt.Sprintf("address::%s", fake.DigitsN(15)),
-						Floors:  tools.Seeder{}.CreateFloors(),
+						Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 						Created: time.Now().Format(time.RFC3339),
 					}
 					gid := store.Set(pid, record)
@@ -195,4 +197,175 @@ var _ = Describe("REST Building API Service::STORAGE", func() {
 		})
 
 	})
+
+	Context("Atomic operations", func() {
+
+		It("should set only if absent", func() {
+			var wg sync.WaitGroup
+			var created int32
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					defer GinkgoRecover()
+					if err := store.SetIfAbsent("same-key", i); err == nil {
+						atomic.AddInt32(&created, 1)
+					} else {
+						Expect(err).To(Equal(drivers.ErrRecordExists))
+					}
+				}(i)
+			}
+			wg.Wait()
+			Expect(created).To(Equal(int32(1)))
+			By("SetIfAbsent ok")
+		})
+
+		It("should delete only when allowed", func() {
+			store.Set("row", 1)
+			err := store.DeleteIf("row", func(data interface{}) error {
+				return drivers.ErrRecordExists
+			})
+			Expect(err).To(Equal(drivers.ErrRecordExists))
+			Expect(store.Count()).To(Equal(1))
+			Expect(store.DeleteIf("row", func(data interface{}) error { return nil })).To(BeZero())
+			Expect(store.Count()).To(Equal(0))
+			Expect(store.DeleteIf("row", nil)).To(Equal(drivers.ErrRecordNotFound))
+			By("DeleteIf ok")
+		})
+	})
+
+	Context("Compare and swap", func() {
+
+		It("should swap only the expected row", func() {
+			first := &models.BuildingData{ID: "row", Version: 1}
+			store.Set("row", first)
+			second := &models.BuildingData{ID: "row", Version: 2}
+			Expect(store.CompareAndSwap("row", first, second)).To(BeZero())
+			third := &models.BuildingData{ID: "row", Version: 3}
+			Expect(store.CompareAndSwap("row", first, third)).To(Equal(drivers.ErrRecordChanged))
+			data, _ := store.One("row")
+			Expect(data).To(Equal(second))
+			Expect(store.CompareAndSwap("not-exists", first, third)).To(Equal(drivers.ErrRecordNotFound))
+			By("CompareAndSwap ok")
+		})
+
+		It("should compare the decoded values by content", func() {
+			store.Set("map", map[string]interface{}{"floors": []interface{}{"lobby"}})
+			Expect(store.CompareAndSwap("map", map[string]interface{}{"floors": []interface{}{"roof"}}, 1)).
+				To(Equal(drivers.ErrRecordChanged))
+			Expect(store.CompareAndSwap("map", map[string]interface{}{"floors": []interface{}{"lobby"}}, 2)).To(BeZero())
+			store.Set("list", []interface{}{"a"})
+			Expect(store.CompareAndSwap("list", "a", 3)).To(Equal(drivers.ErrRecordChanged))
+			Expect(store.CompareAndSwap("list", []interface{}{"a"}, 4)).To(BeZero())
+			err := store.Batch(func(tx drivers.StorageDriver) error {
+				return tx.CompareAndSwap("map", 2, map[string]interface{}{})
+			})
+			Expect(err).To(BeZero())
+			data, _ := store.One("map")
+			Expect(data).To(Equal(map[string]interface{}{}))
+			By("CompareAndSwap values ok")
+		})
+	})
+
+	Context("Index rows", func() {
+
+		It("should keep them out of the count and the changes", func() {
+			store.Set("row", 1)
+			Expect(store.SetIfAbsent(drivers.IndexPrefix+"name::row", "row")).To(BeZero())
+			Expect(store.Count()).To(Equal(1))
+			err := store.Batch(func(tx drivers.StorageDriver) error {
+				tx.Set(drivers.IndexPrefix+"name::other", "other")
+				Expect(tx.Count()).To(Equal(1))
+				return nil
+			})
+			Expect(err).To(BeZero())
+			Expect(store.Unset(drivers.IndexPrefix + "name::row")).To(BeZero())
+			Expect(store.Count()).To(Equal(1))
+			_, oks := store.Exists(drivers.IndexPrefix + "name::other")
+			Expect(oks).To(BeTrue())
+
+			changes, err := store.Changes().Since(0)
+			Expect(err).To(BeZero())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Key).To(Equal("row"))
+			By("Index rows ok")
+		})
+	})
+
+	Context("Ordered scan", func() {
+
+		It("should visit keys in order after the given key", func() {
+			for _, key := range []string{"c", "a", "d", "b"} {
+				store.Set(key, key)
+			}
+			var keys []string
+			store.Scan("a", func(key string, data interface{}) bool {
+				keys = append(keys, key)
+				return len(keys) < 2
+			})
+			Expect(keys).To(Equal([]string{"b", "c"}))
+			By("Scan ok")
+		})
+	})
+
+	Context("Batch", func() {
+
+		It("should keep all the writes or none", func() {
+			store.Set("a", "a")
+			err := store.Batch(func(tx drivers.StorageDriver) error {
+				Expect(tx.SetIfAbsent("b", "b")).To(BeZero())
+				Expect(tx.Unset("a")).To(BeZero())
+				_, oks := tx.Exists("a")
+				Expect(oks).To(BeFalse())
+				Expect(tx.Count()).To(Equal(1))
+				return nil
+			})
+			Expect(err).To(BeZero())
+			Expect(store.Count()).To(Equal(1))
+			_, oks := store.Exists("b")
+			Expect(oks).To(BeTrue())
+			By("Batch commit ok")
+
+			failed := fmt.Errorf("abort")
+			err = store.Batch(func(tx drivers.StorageDriver) error {
+				tx.Set("c", "c")
+				tx.Unset("b")
+				return failed
+			})
+			Expect(err).To(Equal(failed))
+			_, oks = store.Exists("c")
+			Expect(oks).To(BeFalse())
+			_, oks = store.Exists("b")
+			Expect(oks).To(BeTrue())
+			By("Batch rollback ok")
+		})
+	})
+
+	Context("Driver registry", func() {
+
+		It("should open the in-memory driver by default", func() {
+			driver, err := drivers.Open("", drivers.Options{})
+			Expect(err).To(BeZero())
+			_, ok := driver.(*drivers.Storage)
+			Expect(ok).To(BeTrue())
+			Expect(drivers.Drivers()).To(ContainElement("file"))
+			By("Default driver ok")
+		})
+
+		It("should open a registered driver", func() {
+			drivers.Register("fake", func(opts drivers.Options) (drivers.StorageDriver, error) {
+				return drivers.NewStorage(), nil
+			})
+			driver, err := drivers.Open("fake", drivers.Options{})
+			Expect(err).To(BeZero())
+			Expect(driver.Count()).To(Equal(0))
+			By("Registered driver ok")
+		})
+
+		It("should fail on unknown driver", func() {
+			_, err := drivers.Open("not-exists", drivers.Options{})
+			Expect(err).To(Equal(drivers.ErrUnknownDriver))
+			By("Unknown driver as expected")
+		})
+	})
 })
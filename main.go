@@ -1,38 +1,152 @@
 package main
 
 import (
-	"log"
+	"context"
+	"io"
 	"math/rand"
+	"os"
 	"time"
 
 	"github.com/bayugyug/building-custom-api/api/routes"
+	"github.com/bayugyug/building-custom-api/auth"
 	"github.com/bayugyug/building-custom-api/configs"
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/models"
+	"github.com/bayugyug/building-custom-api/tools"
 )
 
 //init internal system initialize
 func init() {
 	//uniqueness
 	rand.Seed(time.Now().UnixNano())
+	//json lines from the start, the standard log included
+	tools.SetLogger(tools.Log)
 }
 
 func main() {
 	start := time.Now()
-	log.Println(configs.APIVersion)
+	tools.Log.Info(configs.APIVersion)
 	//init
 	appcfg := configs.NewAppSettings()
 	//check
 	if appcfg.Config == nil {
-		log.Fatal("Oops! Config missing")
+		tools.Log.Fatal("Oops! Config missing")
+	}
+	//effective config, then out
+	if appcfg.PrintConfig {
+		raw, err := configs.Masked(appcfg.Config)
+		if err != nil {
+			tools.Log.Fatal("Oops! config print failed", tools.Fields{"error": err})
+		}
+		os.Stdout.Write(append(raw, '\n'))
+		return
+	}
+	//tighten or relax the payload rules
+	if len(appcfg.Config.Validation) > 0 {
+		overrides := make(map[string]*models.RuleOverride)
+		for field, cfg := range appcfg.Config.Validation {
+			if cfg == nil {
+				continue
+			}
+			rule := models.RuleOverride(*cfg)
+			overrides[field] = &rule
+		}
+		if err := models.OverrideRules(overrides); err != nil {
+			tools.Log.Fatal("Oops! validation rules failed", tools.Fields{"error": err})
+		}
+	}
+	//init storage
+	opts := drivers.Options{Decoder: models.DecodeRecord}
+	driver := ""
+	if cfg := appcfg.Config.Storage; cfg != nil {
+		driver = cfg.Driver
+		opts.Path = cfg.Path
+		opts.SnapshotInterval = time.Duration(cfg.SnapshotInterval) * time.Second
+		opts.SnapshotEntries = cfg.SnapshotEntries
+		opts.ChangeLog = cfg.ChangeLog
+	}
+	store, err := drivers.Open(driver, opts)
+	if err != nil {
+		tools.Log.Fatal("Oops! storage failed", tools.Fields{"error": err})
+	}
+	if err := models.ReindexNames(store); err != nil {
+		tools.Log.Fatal("Oops! storage index failed", tools.Fields{"error": err})
+	}
+	//readiness thresholds
+	checks := drivers.HealthSettings{}
+	if cfg := appcfg.Config.Health; cfg != nil {
+		checks.SnapshotMaxAge = time.Duration(cfg.SnapshotMaxAge) * time.Second
+		checks.MinFreeDisk = uint64(cfg.MinFreeDiskMB) << 20
 	}
 	//init service
-	service, err := routes.NewAPIService(
-		routes.WithSvcOptAddress(":" + appcfg.Config.Port),
-	)
+	setters := []routes.Setup{
+		routes.WithSvcOptAddress(appcfg.Config.Addr()),
+		routes.WithSvcOptStorage(store),
+		routes.WithSvcOptHealthSettings(checks),
+		routes.WithSvcOptDrainTimeout(time.Duration(appcfg.Config.DrainTimeout) * time.Second),
+		routes.WithSvcOptRateLimit(appcfg.Config.RateLimit),
+		routes.WithSvcOptWebhooks(appcfg.Config.Webhooks),
+	}
+	if cfg := appcfg.Config.Idempotency; cfg != nil {
+		setters = append(setters, routes.WithSvcOptIdempotency(cfg.TTL.D(), cfg.MaxKeys))
+	}
+	if cfg := appcfg.Config.Server; cfg != nil {
+		setters = append(setters,
+			routes.WithSvcOptServerTimeouts(cfg.ReadTimeout.D(), cfg.WriteTimeout.D(), cfg.IdleTimeout.D()),
+			routes.WithSvcOptHandlerTimeout(cfg.HandlerTimeout.D()),
+			routes.WithSvcOptCORS(routes.CORSOptions(cfg.CORS)),
+		)
+	}
+	//caller identity, open api when none is set
+	authn, err := auth.NewFromConfig(appcfg.Config.Auth)
+	if err != nil {
+		tools.Log.Fatal("Oops! auth config failed", tools.Fields{"error": err})
+	}
+	if authn != nil {
+		policy, err := auth.NewPolicyFromConfig(appcfg.Config.Auth)
+		if err != nil {
+			tools.Log.Fatal("Oops! auth roles failed", tools.Fields{"error": err})
+		}
+		setters = append(setters, routes.WithSvcOptAuth(authn), routes.WithSvcOptPolicy(policy))
+		tools.Log.Info("authentication enabled", tools.Fields{"ownership": policy.Ownership})
+	} else {
+		tools.Log.Warn("authentication disabled, the api is open")
+	}
+	if cfg := appcfg.Config.Auth; cfg != nil && len(cfg.Public) > 0 {
+		setters = append(setters, routes.WithSvcOptPublic(cfg.Public...))
+	}
+	service, err := routes.NewAPIService(setters...)
 	if err != nil {
-		log.Fatal("Oops! config might be missing", err)
+		tools.Log.Fatal("Oops! config might be missing", tools.Fields{"error": err})
+	}
+	//flush the storage once the requests drained
+	if closer, ok := store.(io.Closer); ok {
+		service.OnShutdown("storage", func(ctx context.Context) error {
+			return closer.Close()
+		})
+	}
+	//hot reload of the safe settings
+	if appcfg.ConfigFile != "" {
+		watcher, err := configs.WatchFile(appcfg.ConfigFile, func(*configs.ParameterConfig) {
+			//env and flags still win over the changed file
+			cfg, err := configs.Load(appcfg.ConfigFile, appcfg.CmdParams, os.Environ())
+			if err != nil {
+				tools.Log.Error("config reload", tools.Fields{"error": err})
+				return
+			}
+			service.Reload(cfg)
+		})
+		if err != nil {
+			tools.Log.Error("config watch", tools.Fields{"path": appcfg.ConfigFile, "error": err})
+		} else {
+			service.OnShutdown("config watcher", func(ctx context.Context) error {
+				return watcher.Close()
+			})
+		}
 	}
 	//run service
-	service.Run()
-	log.Println("Since", time.Since(start))
-	log.Println("Done")
+	if err := service.Run(); err != nil {
+		tools.Log.Fatal("Oops! service failed", tools.Fields{"error": err, "since": time.Since(start).String()})
+	}
+	tools.Log.Info("done", tools.Fields{"since": time.Since(start).String()})
 }
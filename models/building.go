@@ -2,8 +2,12 @@ package models
 
 import (
 	"crypto/md5"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/drivers"
 )
 
 var (
@@ -13,22 +17,36 @@ var (
 	ErrRecordsNotFound = errors.New("record(s) not found")
 	// ErrRecordNotFound data not exiss
 	ErrRecordNotFound = errors.New("record not found")
-	// ErrRecordMismatch generated hashkey by name is a mismatch
+	// ErrRecordMismatch record id/name does not match the stored one
 	ErrRecordMismatch = errors.New("record id/name mismatch")
 	// ErrRecordExists data already exiss
 	ErrRecordExists = errors.New("record exists")
 	// ErrDBTransaction internal storage error
 	ErrDBTransaction = errors.New("db storage failed")
+	// ErrPreconditionFailed record version is not the expected one
+	ErrPreconditionFailed = errors.New("record version mismatch")
+	// ErrRecordInUse record still has dependent records
+	ErrRecordInUse = errors.New("record has dependent records")
 )
 
 // BuildingData data row in the storage
 type BuildingData struct {
-	ID       string   `json:"id"`
-	Name     string   `json:"name"`
-	Address  string   `json:"address,omitempty"`
-	Floors   []string `json:"floors,omitempty"`
-	Created  string   `json:"created,omitempty"`
-	Modified string   `json:"modified,omitempty"`
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Address  string    `json:"address,omitempty"`
+	Floors   FloorList `json:"floors,omitempty"`
+	Owner    string    `json:"owner,omitempty"`
+	Managers []string  `json:"managers,omitempty"`
+	Version  int64     `json:"version"`
+	Created  string    `json:"created,omitempty"`
+	Modified string    `json:"modified,omitempty"`
+	LegacyID string    `json:"legacy_id,omitempty"`
+}
+
+// BuildingSummary building row with the roll-up figures
+type BuildingSummary struct {
+	*BuildingData
+	Occupancy Occupancy `json:"occupancy"`
 }
 
 // NewBuildingData new instance
@@ -36,7 +54,61 @@ func NewBuildingData() *BuildingData {
 	return &BuildingData{}
 }
 
-// HashKey convert to md5 hash
+// Summary building with the roll-up figures
+func (q *BuildingData) Summary() *BuildingSummary {
+	return &BuildingSummary{
+		BuildingData: q,
+		Occupancy:    q.Floors.Occupancy(),
+	}
+}
+
+// Clone copy of the row safe to modify
+func (q *BuildingData) Clone() *BuildingData {
+	row := *q
+	row.Floors = q.Floors.Clone()
+	row.Managers = append([]string(nil), q.Managers...)
+	return &row
+}
+
+// Ownership creator and managers of the row, the creator is empty for the rows of anonymous callers
+func (q *BuildingData) Ownership() (string, []string) {
+	return q.Owner, q.Managers
+}
+
+// HashKey convert to md5 hash, the legacy id and name index key
 func (q BuildingData) HashKey(s string) string {
 	return fmt.Sprintf("%x", md5.Sum([]byte(s)))
 }
+
+// ETag entity tag of the current version
+func (q BuildingData) ETag() string {
+	return fmt.Sprintf(`"%d"`, q.Version)
+}
+
+// MatchETag check the If-Match/If-None-Match header value against the version
+func (q BuildingData) MatchETag(header string) bool {
+	etag := q.ETag()
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeRecord convert a persisted row back to BuildingData or BuildingIndex
+func DecodeRecord(key string, raw []byte) (interface{}, error) {
+	if drivers.IsIndexKey(key) {
+		idx := &BuildingIndex{}
+		if err := json.Unmarshal(raw, idx); err != nil {
+			return nil, err
+		}
+		return idx, nil
+	}
+	record := NewBuildingData()
+	if err := json.Unmarshal(raw, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
@@ -6,13 +6,16 @@ import (
 	"time"
 
 	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/tools"
 )
 
 // BuildingCreateParams create parameter
 type BuildingCreateParams struct {
-	Name    *string  `json:"name"`
-	Address string   `json:"address"`
-	Floors  []string `json:"floors"`
+	Name     *string   `json:"name"`
+	Address  string    `json:"address"`
+	Floors   FloorList `json:"floors"`
+	Managers []string  `json:"managers"`
+	Owner    string    `json:"-"`
 }
 
 // NewBuildingCreate new creator
@@ -27,7 +30,12 @@ func (p *BuildingCreateParams) Bind(r *http.Request) error {
 		return ErrMissingRequiredParameters
 	}
 	p.Address = strings.TrimSpace(p.Address)
-	//check
+	p.Managers = normalizeManagers(p.Managers)
+	//rules first, they name every field at fault
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	//chk
 	return p.SanityCheck()
 }
 
@@ -36,29 +44,65 @@ func (p *BuildingCreateParams) SanityCheck() error {
 	if p.Name == nil || *p.Name == "" {
 		return ErrMissingRequiredParameters
 	}
-	return nil
+	return p.Floors.SanityCheck()
 }
 
 // Create add a row from the store
-func (p *BuildingCreateParams) Create(store *drivers.Storage) (string, error) {
+func (p *BuildingCreateParams) Create(store drivers.StorageDriver) (string, error) {
 	//should not happen
 	if err := p.SanityCheck(); err != nil {
 		return "", err
 	}
 	record := NewBuildingData()
-	pid := record.HashKey(*p.Name)
-	if _, oks := store.Exists(pid); oks {
-		return "", ErrRecordExists
-	}
 	//set row
-	record.ID = pid
+	record.ID = tools.Helper{}.UUID()
+	record.Version = 1
 	record.Created = time.Now().Format(time.RFC3339)
 	record.Name = *p.Name
 	record.Address = p.Address
-	record.Floors = p.Floors
-	gid := store.Set(pid, record)
-	if gid == "" {
+	record.Floors = p.Floors.Clone()
+	record.Floors.assignIDs()
+	record.Floors.Sort()
+	record.Owner = p.Owner
+	record.Managers = normalizeManagers(p.Managers)
+	//the row and its name index land in 1 batch, a crash never leaves 1 without the other
+	staged := false
+	err := store.Batch(func(tx drivers.StorageDriver) error {
+		//reserve the name first, it is the uniqueness check
+		if err := claimName(tx, record.Name, record.ID); err != nil {
+			return err
+		}
+		if err := tx.SetIfAbsent(record.ID, record); err != nil {
+			return ErrDBTransaction
+		}
+		staged = true
+		return nil
+	})
+	switch {
+	case err == nil:
+		return record.ID, nil
+	case staged:
+		//the journal refused the batch
 		return "", ErrDBTransaction
+	default:
+		return "", err
+	}
+}
+
+// normalizeManagers trimmed, without blanks and repeats, nil stays nil so "not given" is kept apart from "none"
+func normalizeManagers(list []string) []string {
+	if list == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	managers := []string{}
+	for _, m := range list {
+		m = strings.TrimSpace(m)
+		if m == "" || seen[m] {
+			continue
+		}
+		seen[m] = true
+		managers = append(managers, m)
 	}
-	return gid, nil
+	return managers
 }
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+)
+
+const (
+	// BulkOpCreate bulk item adding a row
+	BulkOpCreate = "create"
+	// BulkOpUpdate bulk item replacing a row
+	BulkOpUpdate = "update"
+	// BulkOpDelete bulk item removing a row
+	BulkOpDelete = "delete"
+	// MaxBulkItems max items per bulk request
+	MaxBulkItems = 10000
+)
+
+var (
+	// ErrBulkAborted item not applied since the atomic bulk failed
+	ErrBulkAborted = errors.New("bulk aborted")
+)
+
+// BulkItem 1 operation of the bulk request
+type BulkItem struct {
+	Op      string `json:"op"`
+	ID      string `json:"id,omitempty"`
+	IfMatch string `json:"if_match,omitempty"`
+	BuildingCreateParams
+}
+
+// BulkResult outcome of 1 bulk item
+type BulkResult struct {
+	Index int
+	Op    string
+	ID    string
+	Err   error
+}
+
+// BuildingBulkParams bulk parameter
+type BuildingBulkParams struct {
+	Items  []*BulkItem
+	Atomic bool
+}
+
+// NewBuildingBulk new instance
+func NewBuildingBulk() *BuildingBulkParams {
+	return &BuildingBulkParams{}
+}
+
+// Decode parse the items as a json array or as newline delimited json
+func (p *BuildingBulkParams) Decode(body []byte) error {
+	raw := bytes.TrimSpace(body)
+	if len(raw) == 0 {
+		return ErrMissingRequiredParameters
+	}
+	p.Items = nil
+	if raw[0] == '[' {
+		if err := json.Unmarshal(raw, &p.Items); err != nil {
+			return ErrInvalidParameters
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		for {
+			item := &BulkItem{}
+			if err := decoder.Decode(item); err == io.EOF {
+				break
+			} else if err != nil {
+				return ErrInvalidParameters
+			}
+			p.Items = append(p.Items, item)
+		}
+	}
+	return p.SanityCheck()
+}
+
+// SanityCheck filter required parameter
+func (p *BuildingBulkParams) SanityCheck() error {
+	if len(p.Items) <= 0 {
+		return ErrMissingRequiredParameters
+	}
+	if len(p.Items) > MaxBulkItems {
+		return ErrInvalidParameters
+	}
+	for _, item := range p.Items {
+		if item == nil {
+			return ErrInvalidParameters
+		}
+	}
+	return nil
+}
+
+// Apply run the items in order, atomic stops at the 1st failure and keeps nothing
+func (p *BuildingBulkParams) Apply(store drivers.StorageDriver) ([]*BulkResult, error) {
+	//should not happen :-)
+	if err := p.SanityCheck(); err != nil {
+		return nil, err
+	}
+	results := make([]*BulkResult, len(p.Items))
+	if !p.Atomic {
+		for i, item := range p.Items {
+			results[i] = item.apply(store, i)
+		}
+		return results, nil
+	}
+	err := store.Batch(func(tx drivers.StorageDriver) error {
+		for i, item := range p.Items {
+			if results[i] = item.apply(tx, i); results[i].Err != nil {
+				return ErrBulkAborted
+			}
+		}
+		return nil
+	})
+	switch err {
+	case nil:
+		return results, nil
+	case ErrBulkAborted:
+		//nothing was kept, tell which items did not make it
+		for i, item := range p.Items {
+			if results[i] == nil {
+				results[i] = &BulkResult{Index: i, Op: item.Op, ID: item.ID, Err: ErrBulkAborted}
+			} else if results[i].Err == nil {
+				results[i].Err = ErrBulkAborted
+			}
+		}
+		return results, ErrBulkAborted
+	default:
+		return nil, ErrDBTransaction
+	}
+}
+
+// apply run the item against the store
+func (item *BulkItem) apply(store drivers.StorageDriver, index int) *BulkResult {
+	result := &BulkResult{Index: index, Op: item.Op, ID: item.ID}
+	item.Address = strings.TrimSpace(item.Address)
+	switch item.Op {
+	case BulkOpCreate:
+		if result.Err = item.BuildingCreateParams.Validate(); result.Err == nil {
+			result.ID, result.Err = item.BuildingCreateParams.Create(store)
+		}
+	case BulkOpUpdate:
+		params := &BuildingUpdateParams{
+			ID:                   &item.ID,
+			IfMatch:              item.IfMatch,
+			BuildingCreateParams: item.BuildingCreateParams,
+		}
+		if result.Err = params.Validate(); result.Err == nil {
+			result.Err = params.Update(store)
+		}
+	case BulkOpDelete:
+		if item.ID == "" {
+			result.Err = ErrMissingRequiredParameters
+			break
+		}
+		params := NewBuildingDelete(item.ID)
+		params.IfMatch = item.IfMatch
+		result.Err = params.Delete(store)
+	default:
+		result.Err = ErrInvalidParameters
+	}
+	return result
+}
@@ -6,7 +6,8 @@ import (
 
 // BuildingDeleteParams delete parameter
 type BuildingDeleteParams struct {
-	ID string `json:"id"`
+	ID      string `json:"id"`
+	IfMatch string `json:"-"`
 }
 
 // NewBuildingDelete new instance
@@ -14,10 +15,40 @@ func NewBuildingDelete(pid string) *BuildingDeleteParams {
 	return &BuildingDeleteParams{ID: pid}
 }
 
-// Delete remove a row from the store base on id
-func (p *BuildingDeleteParams) Delete(store *drivers.Storage) error {
-	if _, oks := store.Exists(p.ID); !oks {
+// Delete remove a row from the store base on id, the row and its name index go in 1 batch
+func (p *BuildingDeleteParams) Delete(store drivers.StorageDriver) error {
+	staged := false
+	err := store.Batch(func(tx drivers.StorageDriver) error {
+		//accept the legacy id as well
+		vrow, err := resolve(tx, p.ID)
+		if err != nil {
+			return err
+		}
+		//check the version
+		if p.IfMatch != "" && !vrow.MatchETag(p.IfMatch) {
+			return ErrPreconditionFailed
+		}
+		if err := tx.Unset(vrow.ID); err != nil {
+			return err
+		}
+		releaseName(tx, vrow.Name, vrow.ID)
+		if vrow.LegacyID != "" {
+			tx.Unset(legacyKey(vrow.LegacyID))
+		}
+		staged = true
+		return nil
+	})
+	switch {
+	case err == nil:
+		return nil
+	case staged:
+		//the journal refused the batch
+		return ErrDBTransaction
+	case err == ErrRecordNotFound, err == ErrPreconditionFailed:
+		return err
+	case err == drivers.ErrRecordNotFound:
 		return ErrRecordNotFound
+	default:
+		return ErrDBTransaction
 	}
-	return store.Unset(p.ID)
 }
@@ -14,23 +14,13 @@ func NewBuildingGetOne(id string) *BuildingGetParams {
 	return &BuildingGetParams{ID: id}
 }
 
-// Get query from the store base on id
-func (p *BuildingGetParams) Get(store *drivers.Storage) (*BuildingData, error) {
-	data, err := store.One(p.ID)
-	if err != nil {
-		return nil, err
-	}
-	var rec *BuildingData
-	var valid bool
-	if rec, valid = data.(*BuildingData); valid {
-		return rec, nil
-	}
-	//not found
-	return nil, ErrRecordsNotFound
+// Get query from the store base on id or legacy id
+func (p *BuildingGetParams) Get(store drivers.StorageDriver) (*BuildingData, error) {
+	return resolve(store, p.ID)
 }
 
 // GetAll query from the store base on id
-func (p *BuildingGetParams) GetAll(store *drivers.Storage) ([]*BuildingData, error) {
+func (p *BuildingGetParams) GetAll(store drivers.StorageDriver) ([]*BuildingData, error) {
 	data, err := store.All()
 	if err != nil {
 		return nil, err
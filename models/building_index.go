@@ -0,0 +1,179 @@
+package models
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/tools"
+)
+
+const (
+	// nameIndexPrefix storage key prefix of the name index, in the index namespace of the drivers
+	nameIndexPrefix = drivers.IndexPrefix + "name::"
+	// legacyIndexPrefix storage key prefix of the legacy md5 id aliases
+	legacyIndexPrefix = drivers.IndexPrefix + "legacy::"
+)
+
+// BuildingIndex index row pointing to the building id, the name is only kept by the name index
+type BuildingIndex struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// nameKey storage key of the name index
+func nameKey(name string) string {
+	return nameIndexPrefix + BuildingData{}.HashKey(name)
+}
+
+// claimName reserve the name for the building id
+func claimName(store drivers.StorageDriver, name, id string) error {
+	switch err := store.SetIfAbsent(nameKey(name), &BuildingIndex{ID: id, Name: name}); err {
+	case nil:
+		return nil
+	case drivers.ErrRecordExists:
+		return ErrRecordExists
+	default:
+		return ErrDBTransaction
+	}
+}
+
+// releaseName drop the name reservation if it still belongs to the building id
+func releaseName(store drivers.StorageDriver, name, id string) {
+	store.DeleteIf(nameKey(name), func(data interface{}) error {
+		if idx, ok := data.(*BuildingIndex); !ok || idx.ID != id {
+			return ErrRecordMismatch
+		}
+		return nil
+	})
+}
+
+// resolve find the building by id, or by the legacy md5 id it had before it was moved
+func resolve(store drivers.StorageDriver, id string) (*BuildingData, error) {
+	if data, err := store.One(id); err == nil {
+		if rec, ok := data.(*BuildingData); ok {
+			return rec, nil
+		}
+		return nil, ErrRecordNotFound
+	}
+	if !isLegacyID(id) {
+		return nil, ErrRecordNotFound
+	}
+	//alias lookup via the fixed legacy id mapping
+	data, err := store.One(legacyKey(id))
+	if err != nil {
+		return nil, ErrRecordNotFound
+	}
+	idx, ok := data.(*BuildingIndex)
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	if data, err = store.One(idx.ID); err == nil {
+		if rec, ok := data.(*BuildingData); ok && rec.LegacyID == id {
+			return rec, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+// legacyKey storage key of the legacy id alias
+func legacyKey(id string) string {
+	return legacyIndexPrefix + id
+}
+
+// isLegacyID check if the id has the md5-of-name format of the old keys
+func isLegacyID(id string) bool {
+	if len(id) != md5.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
+
+// migrateLegacy move the rows still keyed by their md5 id to a server-generated id,
+// the md5 id is kept on the row as the fixed alias
+func migrateLegacy(store drivers.StorageDriver) error {
+	data, err := store.All()
+	if err != nil {
+		return err
+	}
+	for _, row := range data {
+		rec, ok := row.(*BuildingData)
+		if !ok || !isLegacyID(rec.ID) {
+			continue
+		}
+		moved := rec.Clone()
+		moved.ID = tools.Helper{}.UUID()
+		moved.LegacyID = rec.ID
+		err := store.Batch(func(tx drivers.StorageDriver) error {
+			if err := tx.Unset(rec.ID); err != nil {
+				return err
+			}
+			tx.Set(moved.ID, moved)
+			tx.Set(legacyKey(moved.LegacyID), &BuildingIndex{ID: moved.ID})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReindexNames move the legacy md5 rows to server-generated ids, then rebuild the name and legacy id
+// indexes, adding the missing entries and dropping the stale ones
+func ReindexNames(store drivers.StorageDriver) error {
+	if err := migrateLegacy(store); err != nil {
+		return err
+	}
+	data, err := store.All()
+	if err != nil {
+		return err
+	}
+	names := make(map[string]*BuildingData)
+	legacy := make(map[string]*BuildingData)
+	for _, row := range data {
+		if rec, ok := row.(*BuildingData); ok {
+			names[rec.Name] = rec
+			if rec.LegacyID != "" {
+				legacy[rec.LegacyID] = rec
+			}
+		}
+	}
+	//stale entries left behind by an older version or a rename
+	var stale []string
+	store.Scan(drivers.IndexPrefix, func(key string, row interface{}) bool {
+		if !drivers.IsIndexKey(key) {
+			return false
+		}
+		idx, ok := row.(*BuildingIndex)
+		switch {
+		case !ok:
+			stale = append(stale, key)
+		case strings.HasPrefix(key, legacyIndexPrefix):
+			if rec, ok := legacy[strings.TrimPrefix(key, legacyIndexPrefix)]; !ok || rec.ID != idx.ID {
+				stale = append(stale, key)
+			}
+		case strings.HasPrefix(key, nameIndexPrefix):
+			if rec, ok := names[idx.Name]; !ok || rec.ID != idx.ID || nameKey(rec.Name) != key {
+				stale = append(stale, key)
+			}
+		}
+		return true
+	})
+	for _, key := range stale {
+		store.Unset(key)
+	}
+	for name, rec := range names {
+		if err := claimName(store, name, rec.ID); err != nil && err != ErrRecordExists {
+			return err
+		}
+	}
+	for id, rec := range legacy {
+		if _, ok := store.Exists(legacyKey(id)); !ok {
+			store.Set(legacyKey(id), &BuildingIndex{ID: rec.ID})
+		}
+	}
+	return nil
+}
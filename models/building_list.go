@@ -0,0 +1,268 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+)
+
+const (
+	// DefaultListLimit rows per page if not given
+	DefaultListLimit = 100
+	// MaxListLimit max rows per page
+	MaxListLimit = 1000
+
+	sortTimeLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+var (
+	// ErrInvalidParameters parameter given but not usable
+	ErrInvalidParameters = errors.New("invalid parameter")
+
+	sortFields = map[string]bool{"id": true, "name": true, "created": true, "modified": true}
+)
+
+// BuildingListParams list parameter
+type BuildingListParams struct {
+	Limit           int
+	Page            int
+	Cursor          string
+	Sort            string
+	NamePrefix      string
+	AddressContains string
+	MinFloors       *int
+	MaxFloors       *int
+	CreatedAfter    *time.Time
+	CreatedBefore   *time.Time
+}
+
+// listCursor position of the last row of the previous page
+type listCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// NewBuildingList new instance with defaults
+func NewBuildingList() *BuildingListParams {
+	return &BuildingListParams{
+		Limit: DefaultListLimit,
+		Sort:  "created",
+	}
+}
+
+// ParseQuery filter the query string parameter
+func (p *BuildingListParams) ParseQuery(q url.Values) error {
+	var err error
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		if p.Limit, err = strconv.Atoi(v); err != nil || p.Limit <= 0 || p.Limit > MaxListLimit {
+			return ErrInvalidParameters
+		}
+	}
+	if v := strings.TrimSpace(q.Get("page")); v != "" {
+		if p.Page, err = strconv.Atoi(v); err != nil || p.Page <= 0 {
+			return ErrInvalidParameters
+		}
+	}
+	if v := strings.TrimSpace(q.Get("sort")); v != "" {
+		if !sortFields[strings.TrimPrefix(v, "-")] {
+			return ErrInvalidParameters
+		}
+		p.Sort = v
+	}
+	p.Cursor = strings.TrimSpace(q.Get("cursor"))
+	if p.Cursor != "" && p.Page > 0 {
+		return ErrInvalidParameters
+	}
+	p.NamePrefix = strings.ToLower(strings.TrimSpace(q.Get("name_prefix")))
+	p.AddressContains = strings.ToLower(strings.TrimSpace(q.Get("address_contains")))
+	if p.MinFloors, err = queryInt(q, "min_floors"); err != nil {
+		return err
+	}
+	if p.MaxFloors, err = queryInt(q, "max_floors"); err != nil {
+		return err
+	}
+	if p.CreatedAfter, err = queryTime(q, "created_after"); err != nil {
+		return err
+	}
+	if p.CreatedBefore, err = queryTime(q, "created_before"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// List query a page of rows, giving back the cursor of the next page and the total matches
+func (p *BuildingListParams) List(store drivers.StorageDriver) ([]*BuildingData, string, int, error) {
+	field, desc := strings.TrimPrefix(p.Sort, "-"), strings.HasPrefix(p.Sort, "-")
+	var after *listCursor
+	if p.Cursor != "" {
+		var err error
+		if after, err = decodeCursor(p.Cursor); err != nil || after.Sort != p.Sort {
+			return nil, "", 0, ErrInvalidParameters
+		}
+	}
+
+	//the total needs every match, the ordered scan gives them by id
+	all := []*BuildingData{}
+	if err := store.Scan("", func(key string, data interface{}) bool {
+		if row, valid := data.(*BuildingData); valid && p.match(row) {
+			all = append(all, row)
+		}
+		return true
+	}); err != nil {
+		return nil, "", 0, ErrDBTransaction
+	}
+	total := len(all)
+
+	//rows ordered by the sort value, then id to break ties
+	before := func(va, ia, vb, ib string) bool {
+		if va == vb {
+			va, vb = ia, ib
+		}
+		if desc {
+			return va > vb
+		}
+		return va < vb
+	}
+	switch {
+	case field != "id":
+		sort.Slice(all, func(i, j int) bool {
+			return before(sortValue(all[i], field), all[i].ID, sortValue(all[j], field), all[j].ID)
+		})
+	case desc:
+		//already by id from the scan, only flip it
+		for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+			all[i], all[j] = all[j], all[i]
+		}
+	}
+
+	//skip to the requested page, the cursor is the sort value and id of the last row sent
+	//so the pages stay stable while rows come and go
+	start := 0
+	if after != nil {
+		start = sort.Search(len(all), func(i int) bool {
+			return before(after.Value, after.ID, sortValue(all[i], field), all[i].ID)
+		})
+	} else if p.Page > 0 {
+		//compare by division first, a huge page would overflow the multiply
+		if p.Limit <= 0 || p.Page-1 > len(all)/p.Limit {
+			return []*BuildingData{}, "", total, nil
+		}
+		start = (p.Page - 1) * p.Limit
+	}
+	if start >= len(all) {
+		return []*BuildingData{}, "", total, nil
+	}
+	end := start + p.Limit
+	var next string
+	if end < len(all) {
+		last := all[end-1]
+		next = encodeCursor(&listCursor{Sort: p.Sort, Value: sortValue(last, field), ID: last.ID})
+	} else {
+		end = len(all)
+	}
+	return all[start:end], next, total, nil
+}
+
+// match check the row against the filters
+func (p *BuildingListParams) match(row *BuildingData) bool {
+	if p.NamePrefix != "" && !strings.HasPrefix(strings.ToLower(row.Name), p.NamePrefix) {
+		return false
+	}
+	if p.AddressContains != "" && !strings.Contains(strings.ToLower(row.Address), p.AddressContains) {
+		return false
+	}
+	if p.MinFloors != nil && len(row.Floors) < *p.MinFloors {
+		return false
+	}
+	if p.MaxFloors != nil && len(row.Floors) > *p.MaxFloors {
+		return false
+	}
+	if p.CreatedAfter != nil || p.CreatedBefore != nil {
+		created, err := time.Parse(time.RFC3339, row.Created)
+		if err != nil {
+			return false
+		}
+		if p.CreatedAfter != nil && !created.After(*p.CreatedAfter) {
+			return false
+		}
+		if p.CreatedBefore != nil && !created.Before(*p.CreatedBefore) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortValue comparable string of the sort field
+func sortValue(row *BuildingData, field string) string {
+	switch field {
+	case "name":
+		return row.Name
+	case "created":
+		return sortTime(row.Created)
+	case "modified":
+		return sortTime(row.Modified)
+	}
+	return row.ID
+}
+
+// sortTime normalize the timestamp so it sorts as a string
+func sortTime(s string) string {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(sortTimeLayout)
+}
+
+// encodeCursor opaque string of the cursor
+func encodeCursor(c *listCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor parse the opaque cursor string
+func decodeCursor(s string) (*listCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	c := &listCursor{}
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// queryInt optional non-negative int from the query string
+func queryInt(q url.Values, name string) (*int, error) {
+	v := strings.TrimSpace(q.Get(name))
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return nil, ErrInvalidParameters
+	}
+	return &n, nil
+}
+
+// queryTime optional RFC3339 timestamp from the query string
+func queryTime(q url.Values, name string) (*time.Time, error) {
+	v := strings.TrimSpace(q.Get(name))
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, ErrInvalidParameters
+	}
+	return &t, nil
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/tools"
+)
+
+const (
+	// ContentTypeMergePatch JSON Merge Patch (RFC 7396)
+	ContentTypeMergePatch = "application/merge-patch+json"
+	// ContentTypeJSONPatch JSON Patch (RFC 6902)
+	ContentTypeJSONPatch = "application/json-patch+json"
+)
+
+var (
+	// ErrUnsupportedPatch patch content type not known
+	ErrUnsupportedPatch = errors.New("unsupported patch content type")
+	// ErrPatchTestFailed JSON Patch test operation did not match
+	ErrPatchTestFailed = errors.New("patch test failed")
+)
+
+// BuildingPatchParams patch parameter
+type BuildingPatchParams struct {
+	ID          string
+	IfMatch     string
+	ContentType string
+	Body        []byte
+}
+
+// NewBuildingPatch new instance
+func NewBuildingPatch(id, contentType string, body []byte) *BuildingPatchParams {
+	return &BuildingPatchParams{
+		ID:          id,
+		ContentType: contentType,
+		Body:        body,
+	}
+}
+
+// SanityCheck filter required parameter
+func (p *BuildingPatchParams) SanityCheck() error {
+	if p.ID == "" || len(bytes.TrimSpace(p.Body)) == 0 {
+		return ErrMissingRequiredParameters
+	}
+	switch p.mediaType() {
+	case ContentTypeMergePatch, ContentTypeJSONPatch, "application/json":
+		return nil
+	}
+	return ErrUnsupportedPatch
+}
+
+// Patch apply the patch document to the stored row
+func (p *BuildingPatchParams) Patch(store drivers.StorageDriver) (*BuildingData, error) {
+	//should not happen :-)
+	if err := p.SanityCheck(); err != nil {
+		return nil, err
+	}
+	return modifyRecord(store, p.ID, p.IfMatch, func(record *BuildingData) error {
+		doc, err := json.Marshal(record)
+		if err != nil {
+			return ErrDBTransaction
+		}
+		var patched []byte
+		if p.mediaType() == ContentTypeJSONPatch {
+			patched, err = tools.JSONPatch(doc, p.Body)
+		} else {
+			patched, err = tools.MergePatch(doc, p.Body)
+		}
+		switch err {
+		case nil:
+		case tools.ErrPatchTestFailed:
+			return ErrPatchTestFailed
+		default:
+			return ErrInvalidParameters
+		}
+		//result must still be a building
+		result := NewBuildingData()
+		decoder := json.NewDecoder(bytes.NewReader(patched))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(result); err != nil {
+			return ErrInvalidParameters
+		}
+		//read-only fields
+		if result.ID != record.ID {
+			return ErrRecordMismatch
+		}
+		if result.Version != record.Version || result.Created != record.Created || result.Modified != record.Modified ||
+			result.Owner != record.Owner {
+			return ErrInvalidParameters
+		}
+		result.Address = strings.TrimSpace(result.Address)
+		result.Managers = normalizeManagers(result.Managers)
+		if len(result.Managers) == 0 {
+			result.Managers = nil
+		}
+		//same rules as a create or update
+		if err := result.Validate(); err != nil {
+			return err
+		}
+		if err := result.Floors.SanityCheck(); err != nil {
+			return err
+		}
+		result.Floors.assignIDs()
+		result.Floors.Sort()
+		*record = *result
+		return nil
+	})
+}
+
+// mediaType content type without parameters
+func (p *BuildingPatchParams) mediaType() string {
+	mediaType, _, err := mime.ParseMediaType(p.ContentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
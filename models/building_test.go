@@ -2,6 +2,13 @@ package models_test
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/bayugyug/building-custom-api/drivers"
 	"github.com/bayugyug/building-custom-api/models"
@@ -28,7 +35,7 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 				params := &models.BuildingCreateParams{
 					Name:    &name,
 					Address: fmt.Sprintf("Marina Boulevard::%s", fake.DigitsN(15)),
-					Floors:  tools.Seeder{}.CreateFloors(),
+					Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 				}
 				pid, err := params.Create(store)
 				if err != nil {
@@ -46,7 +53,7 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 				params := &models.BuildingCreateParams{
 					Name:    &name,
 					Address: fmt.Sprintf("Marina Boulevard::%s", fake.DigitsN(15)),
-					Floors:  tools.Seeder{}.CreateFloors(),
+					Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 				}
 				pid, err := params.Create(store)
 				if err != nil {
@@ -60,7 +67,7 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 					BuildingCreateParams: models.BuildingCreateParams{
 						Name:    &name,
 						Address: fmt.Sprintf("Marina Boulevard::%s", fake.DigitsN(15)),
-						Floors:  tools.Seeder{}.CreateFloors(),
+						Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 					},
 				}
 
@@ -78,7 +85,7 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 				params := &models.BuildingCreateParams{
 					Name:    &name,
 					Address: fmt.Sprintf("Marina Boulevard::%s", fake.DigitsN(15)),
-					Floors:  tools.Seeder{}.CreateFloors(),
+					Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 				}
 				pid, err := params.Create(store)
 				if err != nil {
@@ -94,6 +101,37 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 				}
 				By("Delete data ok")
 			})
+
+			It("should change the row and its name in 1 log line", func() {
+				dir, err := ioutil.TempDir("", "building-models")
+				Expect(err).To(BeZero())
+				defer os.RemoveAll(dir)
+				fstore, err := drivers.NewFileStorage(dir,
+					drivers.WithFileOptDecoder(models.DecodeRecord), drivers.WithFileOptSnapshotInterval(0))
+				Expect(err).To(BeZero())
+				defer fstore.Close()
+				lines := func() []string {
+					raw, err := ioutil.ReadFile(filepath.Join(dir, "wal.log"))
+					Expect(err).To(BeZero())
+					return strings.Split(strings.TrimSpace(string(raw)), "\n")
+				}
+
+				name := fmt.Sprintf("marina-bay-sands::%s", fake.DigitsN(15))
+				pid, err := (&models.BuildingCreateParams{Name: &name}).Create(fstore)
+				Expect(err).To(BeZero())
+				Expect(lines()).To(HaveLen(1))
+				Expect(lines()[0]).To(ContainSubstring(`"key":"` + pid + `"`))
+				Expect(lines()[0]).To(ContainSubstring(`"key":"index::name::`))
+				By("Create in 1 line ok")
+
+				Expect(models.NewBuildingDelete(pid).Delete(fstore)).To(BeZero())
+				Expect(lines()).To(HaveLen(2))
+				Expect(lines()[1]).To(ContainSubstring(`"op":"unset","key":"` + pid + `"`))
+				Expect(lines()[1]).To(ContainSubstring(`"op":"unset","key":"index::name::`))
+				_, err = (&models.BuildingCreateParams{Name: &name}).Create(fstore)
+				Expect(err).To(BeZero())
+				By("Delete in 1 line ok")
+			})
 		})
 
 		Context("Get 1 record", func() {
@@ -102,7 +140,7 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 				params := &models.BuildingCreateParams{
 					Name:    &name,
 					Address: fmt.Sprintf("Marina Boulevard::%s", fake.DigitsN(15)),
-					Floors:  tools.Seeder{}.CreateFloors(),
+					Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 				}
 				pid, err := params.Create(store)
 				if err != nil {
@@ -129,7 +167,7 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 					params := &models.BuildingCreateParams{
 						Name:    &name,
 						Address: fmt.Sprintf("Marina Boulevard::%s", fake.DigitsN(15)),
-						Floors:  tools.Seeder{}.CreateFloors(),
+						Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 					}
 					pid, err := params.Create(store)
 					if err != nil {
@@ -164,6 +202,264 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 			})
 		})
 
+		Context("List records page by page", func() {
+			It("should filter, sort and paginate", func() {
+				prefix := fmt.Sprintf("tower-%s", fake.DigitsN(5))
+				for i := 1; i <= 7; i++ {
+					name := fmt.Sprintf("%s-%02d", prefix, i)
+					params := &models.BuildingCreateParams{
+						Name:    &name,
+						Address: fmt.Sprintf("Marina Boulevard %d", i),
+						Floors:  models.NewFloorList(make([]string, i)),
+					}
+					if _, err := params.Create(store); err != nil {
+						Fail(err.Error())
+					}
+				}
+				other := "other building"
+				(&models.BuildingCreateParams{Name: &other}).Create(store)
+
+				list := models.NewBuildingList()
+				Expect(list.ParseQuery(url.Values{
+					"name_prefix": {strings.ToUpper(prefix)},
+					"min_floors":  {"2"},
+					"sort":        {"-name"},
+					"limit":       {"4"},
+				})).To(BeZero())
+				rows, next, total, err := list.List(store)
+				Expect(err).To(BeZero())
+				Expect(total).To(Equal(6))
+				Expect(len(rows)).To(Equal(4))
+				Expect(rows[0].Name).To(Equal(prefix + "-07"))
+				Expect(next).NotTo(BeEmpty())
+				By("First page ok")
+
+				//a row sorting before the cursor must not shift the next page
+				early := prefix + "-99"
+				(&models.BuildingCreateParams{Name: &early, Floors: models.NewFloorList(make([]string, 3))}).Create(store)
+				list.Cursor = next
+				rows, next, _, err = list.List(store)
+				Expect(err).To(BeZero())
+				Expect(len(rows)).To(Equal(2))
+				Expect(rows[0].Name).To(Equal(prefix + "-03"))
+				Expect(rows[1].Name).To(Equal(prefix + "-02"))
+				Expect(next).To(BeEmpty())
+				By("Next page ok")
+
+				list = models.NewBuildingList()
+				list.NamePrefix = prefix + "-none"
+				rows, next, total, err = list.List(store)
+				Expect(err).To(BeZero())
+				Expect(rows).NotTo(BeNil())
+				Expect(rows).To(BeEmpty())
+				Expect(total).To(BeZero())
+				Expect(next).To(BeEmpty())
+				By("No match ok")
+
+				//a page far past the end is empty, not an overflow
+				list = models.NewBuildingList()
+				Expect(list.ParseQuery(url.Values{
+					"name_prefix": {prefix},
+					"limit":       {"1000"},
+					"page":        {"9223372036854775807"},
+				})).To(BeZero())
+				rows, next, total, err = list.List(store)
+				Expect(err).To(BeZero())
+				Expect(rows).To(BeEmpty())
+				Expect(total).To(Equal(8))
+				Expect(next).To(BeEmpty())
+				By("Huge page ok")
+
+				//by id straight from the ordered scan, both ways
+				for _, order := range []string{"id", "-id"} {
+					list = models.NewBuildingList()
+					Expect(list.ParseQuery(url.Values{"name_prefix": {prefix}, "sort": {order}, "limit": {"5"}})).To(BeZero())
+					var ids []string
+					for {
+						rows, next, _, err = list.List(store)
+						Expect(err).To(BeZero())
+						for _, row := range rows {
+							ids = append(ids, row.ID)
+						}
+						if next == "" {
+							break
+						}
+						list.Cursor = next
+					}
+					Expect(len(ids)).To(Equal(8))
+					Expect(sort.SliceIsSorted(ids, func(i, j int) bool {
+						if order == "-id" {
+							return ids[i] > ids[j]
+						}
+						return ids[i] < ids[j]
+					})).To(BeTrue())
+				}
+				By("Sort by id ok")
+			})
+
+			It("should reject bad parameters", func() {
+				for _, q := range []url.Values{
+					{"limit": {"0"}},
+					{"sort": {"floors"}},
+					{"min_floors": {"x"}},
+					{"created_after": {"yesterday"}},
+					{"page": {"2"}, "cursor": {"abc"}},
+				} {
+					Expect(models.NewBuildingList().ParseQuery(q)).To(Equal(models.ErrInvalidParameters))
+				}
+				list := models.NewBuildingList()
+				list.Cursor = "not-a-cursor"
+				name := "some building"
+				(&models.BuildingCreateParams{Name: &name}).Create(store)
+				_, _, _, err := list.List(store)
+				Expect(err).To(Equal(models.ErrInvalidParameters))
+				By("Bad parameters as expected")
+			})
+		})
+
+		Context("Patch record", func() {
+			It("should apply json patch operations in order", func() {
+				name := fmt.Sprintf("marina-bay-sands::%s", fake.DigitsN(15))
+				params := &models.BuildingCreateParams{
+					Name:   &name,
+					Floors: models.NewFloorList([]string{"floor-1", "floor-2"}),
+				}
+				pid, err := params.Create(store)
+				if err != nil {
+					Fail(err.Error())
+				}
+				patch := `[
+					{"op":"add","path":"/floors/-","value":{"level":0,"label":"lobby"}},
+					{"op":"replace","path":"/floors/0/label","value":"ground"},
+					{"op":"copy","from":"/floors/1/label","path":"/address"},
+					{"op":"replace","path":"/name","value":"` + name + `::patched"}
+				]`
+				row, err := models.NewBuildingPatch(pid, models.ContentTypeJSONPatch, []byte(patch)).Patch(store)
+				Expect(err).To(BeZero())
+				var labels []string
+				for _, floor := range row.Floors {
+					labels = append(labels, floor.Label)
+				}
+				Expect(labels).To(Equal([]string{"lobby", "ground", "floor-2"}))
+				Expect(row.Floors[0].ID).NotTo(BeEmpty())
+				Expect(row.Address).To(Equal("floor-2"))
+				Expect(row.Name).To(Equal(name + "::patched"))
+				Expect(row.Version).To(Equal(int64(2)))
+				By("Patch ok")
+
+				_, err = models.NewBuildingPatch(pid, models.ContentTypeJSONPatch,
+					[]byte(`[{"op":"replace","path":"/id","value":"other"}]`)).Patch(store)
+				Expect(err).To(Equal(models.ErrRecordMismatch))
+				_, err = models.NewBuildingPatch(pid, models.ContentTypeJSONPatch,
+					[]byte(`[{"op":"remove","path":"/floors/9"}]`)).Patch(store)
+				Expect(err).To(Equal(models.ErrInvalidParameters))
+				_, err = models.NewBuildingPatch(pid, models.ContentTypeMergePatch,
+					[]byte(`{"color":"red"}`)).Patch(store)
+				Expect(err).To(Equal(models.ErrInvalidParameters))
+				By("Invalid patch rejected")
+			})
+		})
+
+		Context("Bulk records", func() {
+			It("should report each item and keep the good ones", func() {
+				params := models.NewBuildingBulk()
+				err := params.Decode([]byte(`{"op":"create","name":"bulk-a","floors":["lobby"]}
+{"op":"create","name":"bulk-a"}
+{"op":"delete","id":"not-exists-id"}
+{"op":"explode"}`))
+				Expect(err).To(BeZero())
+				results, err := params.Apply(store)
+				Expect(err).To(BeZero())
+				Expect(len(results)).To(Equal(4))
+				Expect(results[0].Err).To(BeZero())
+				Expect(results[1].Err).To(Equal(models.ErrRecordExists))
+				Expect(results[2].Err).To(Equal(models.ErrRecordNotFound))
+				Expect(results[3].Err).To(Equal(models.ErrInvalidParameters))
+				By("Bulk per item ok")
+
+				params = models.NewBuildingBulk()
+				Expect(params.Decode([]byte(`[{"op":"update","id":"` + results[0].ID + `","name":"bulk-b"},{"op":"delete","id":"` + results[0].ID + `"}]`))).To(BeZero())
+				results, err = params.Apply(store)
+				Expect(err).To(BeZero())
+				Expect(results[0].Err).To(BeZero())
+				Expect(results[1].Err).To(BeZero())
+				Expect(store.Count()).To(Equal(0))
+				By("Bulk array ok")
+			})
+
+			It("should keep nothing if an atomic item fails", func() {
+				params := models.NewBuildingBulk()
+				params.Atomic = true
+				Expect(params.Decode([]byte(`[{"op":"create","name":"bulk-a"},{"op":"create","name":"bulk-b"},{"op":"update","id":"not-exists-id","name":"bulk-c"},{"op":"create","name":"bulk-d"}]`))).To(BeZero())
+				results, err := params.Apply(store)
+				Expect(err).To(Equal(models.ErrBulkAborted))
+				Expect(results[0].Err).To(Equal(models.ErrBulkAborted))
+				Expect(results[2].Err).To(Equal(models.ErrRecordNotFound))
+				Expect(results[3].Err).To(Equal(models.ErrBulkAborted))
+				Expect(store.Count()).To(Equal(0))
+				By("Bulk rollback ok")
+
+				params.Items = params.Items[:2]
+				results, err = params.Apply(store)
+				Expect(err).To(BeZero())
+				Expect(len(results)).To(Equal(2))
+				Expect(store.Count()).To(Equal(2))
+				By("Bulk commit ok")
+			})
+		})
+
+		Context("Legacy md5 records", func() {
+			It("should keep resolving and enforce the name", func() {
+				name := fmt.Sprintf("marina-bay-sands::%s", fake.DigitsN(15))
+				legacy := &models.BuildingData{Name: name}
+				legacy.ID = legacy.HashKey(name)
+				store.Set(legacy.ID, legacy)
+				Expect(models.ReindexNames(store)).To(BeZero())
+				By("Reindex ok")
+
+				row, err := models.NewBuildingGetOne(legacy.ID).Get(store)
+				Expect(err).To(BeZero())
+				Expect(row.Name).To(Equal(name))
+				Expect(row.ID).NotTo(Equal(legacy.ID))
+				Expect(row.LegacyID).To(Equal(legacy.ID))
+				Expect(store.Count()).To(Equal(1))
+				Expect(models.ReindexNames(store)).To(BeZero())
+				again, err := models.NewBuildingGetOne(legacy.ID).Get(store)
+				Expect(err).To(BeZero())
+				Expect(again.ID).To(Equal(row.ID))
+				By("Legacy row moved ok")
+
+				params := &models.BuildingCreateParams{Name: &name}
+				_, err = params.Create(store)
+				Expect(err).To(Equal(models.ErrRecordExists))
+				By("Legacy name taken")
+
+				renamed := name + "::renamed"
+				uparams := &models.BuildingUpdateParams{
+					ID:                   &legacy.ID,
+					BuildingCreateParams: models.BuildingCreateParams{Name: &renamed},
+				}
+				Expect(uparams.Update(store)).To(BeZero())
+				row, err = models.NewBuildingGetOne(legacy.ID).Get(store)
+				Expect(err).To(BeZero())
+				Expect(row.Name).To(Equal(renamed))
+				_, err = models.NewBuildingGetOne(legacy.HashKey(renamed)).Get(store)
+				Expect(err).To(Equal(models.ErrRecordNotFound))
+				pid, err := params.Create(store)
+				Expect(err).To(BeZero())
+				Expect(pid).NotTo(Equal(legacy.ID))
+				row, err = models.NewBuildingGetOne(legacy.ID).Get(store)
+				Expect(err).To(BeZero())
+				Expect(row.Name).To(Equal(renamed))
+				By("Rename legacy ok, the alias stays with it")
+
+				Expect(models.NewBuildingDelete(legacy.ID).Delete(store)).To(BeZero())
+				_, err = models.NewBuildingGetOne(legacy.ID).Get(store)
+				Expect(err).To(Equal(models.ErrRecordNotFound))
+				By("Delete legacy ok")
+			})
+		})
+
 	}) // valid
 
 	Context("Invalid parameters", func() {
@@ -182,7 +478,7 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 			It("should error", func() {
 				params := &models.BuildingCreateParams{
 					Address: fmt.Sprintf("Marina Boulevard::%s", fake.DigitsN(15)),
-					Floors:  tools.Seeder{}.CreateFloors(),
+					Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 				}
 				_, err := params.Create(store)
 				Expect(err).To(HaveOccurred())
@@ -196,7 +492,7 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 				params := &models.BuildingCreateParams{
 					Name:    &name,
 					Address: fmt.Sprintf("Marina Boulevard::%s", fake.DigitsN(15)),
-					Floors:  tools.Seeder{}.CreateFloors(),
+					Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 				}
 
 				pid, err := params.Create(store)
@@ -211,7 +507,7 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 					BuildingCreateParams: models.BuildingCreateParams{
 						Name:    &name,
 						Address: fmt.Sprintf("Marina Boulevard::%s", fake.DigitsN(15)),
-						Floors:  tools.Seeder{}.CreateFloors(),
+						Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 					},
 				}
 
@@ -227,7 +523,7 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 				params := &models.BuildingCreateParams{
 					Name:    &name,
 					Address: "Marina Boulevard-1a",
-					Floors:  tools.Seeder{}.CreateFloors(),
+					Floors:  models.NewFloorList(tools.Seeder{}.CreateFloors()),
 				}
 				pid, err := params.Create(store)
 				if err != nil {
@@ -243,6 +539,39 @@ var _ = Describe("REST Building API Service::MODELS", func() {
 			})
 		})
 
+		Context("Create same record concurrently", func() {
+			It("should create only once", func() {
+				name := fmt.Sprintf("marina-bay-sands::%s", fake.DigitsN(15))
+				var wg sync.WaitGroup
+				errs := make(chan error, 10)
+				for i := 0; i < 10; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						defer GinkgoRecover()
+						params := &models.BuildingCreateParams{
+							Name:    &name,
+							Address: fmt.Sprintf("Marina Boulevard::%s", fake.DigitsN(15)),
+						}
+						_, err := params.Create(store)
+						errs <- err
+					}()
+				}
+				wg.Wait()
+				close(errs)
+				created := 0
+				for err := range errs {
+					if err == nil {
+						created++
+						continue
+					}
+					Expect(err).To(Equal(models.ErrRecordExists))
+				}
+				Expect(created).To(Equal(1))
+				By("Duplicate data not allowed")
+			})
+		})
+
 		Context("Get a record not exists", func() {
 			It("should error", func() {
 				uparams := &models.BuildingGetParams{ID: "not-exists-id"}
@@ -10,7 +10,8 @@ import (
 
 // BuildingUpdateParams update parameter
 type BuildingUpdateParams struct {
-	ID *string `json:"id"`
+	ID      *string `json:"id"`
+	IfMatch string  `json:"-"`
 	BuildingCreateParams
 }
 
@@ -27,6 +28,11 @@ func (p *BuildingUpdateParams) Bind(r *http.Request) error {
 	}
 	//fmt
 	p.Address = strings.TrimSpace(p.Address)
+	p.Managers = normalizeManagers(p.Managers)
+	//rules first, they name every field at fault
+	if err := p.Validate(); err != nil {
+		return err
+	}
 	//chk
 	return p.SanityCheck()
 }
@@ -37,38 +43,82 @@ func (p *BuildingUpdateParams) SanityCheck() error {
 		*p.ID == "" || *p.Name == "" {
 		return ErrMissingRequiredParameters
 	}
-	return nil
+	return p.Floors.SanityCheck()
 }
 
 // Update a row from the store
-func (p *BuildingUpdateParams) Update(store *drivers.Storage) error {
+func (p *BuildingUpdateParams) Update(store drivers.StorageDriver) error {
 	//should not happen :-)
 	if err := p.SanityCheck(); err != nil {
 		return err
 	}
-	//db check
-	row, oks := store.Exists(*p.ID)
-	if !oks {
-		return ErrRecordNotFound
-	}
-	//check the hashkey
-	record := NewBuildingData()
-	pid := record.HashKey(*p.Name)
-	if pid != *p.ID {
-		return ErrRecordMismatch
-	}
-	//convert db data
-	vrow, ok := row.(*BuildingData)
-	if !ok {
-		return ErrDBTransaction
-	}
-	//set old row with new value
-	record = vrow
-	record.Address = p.Address
-	record.Floors = p.Floors
-	record.Modified = time.Now().Format(time.RFC3339)
-	if gid := store.Set(pid, record); gid == "" {
-		return ErrDBTransaction
+	_, err := modifyRecord(store, *p.ID, p.IfMatch, func(record *BuildingData) error {
+		//the floors are replaced as a whole, refused if rooms would go along
+		floors := p.Floors.Clone()
+		if record.Floors.dropsRooms(floors) {
+			return ErrRecordInUse
+		}
+		record.Name = *p.Name
+		record.Address = p.Address
+		record.Floors = floors
+		record.Floors.assignIDs()
+		record.Floors.Sort()
+		//the managers are kept unless given, the owner never changes
+		if p.Managers != nil {
+			record.Managers = normalizeManagers(p.Managers)
+		}
+		return nil
+	})
+	return err
+}
+
+// modifyRecord read-modify-write of a copy of the row, the row and its name index change in 1 batch
+func modifyRecord(store drivers.StorageDriver, id, ifMatch string, fn func(record *BuildingData) error) (*BuildingData, error) {
+	var record *BuildingData
+	staged := false
+	err := store.Batch(func(tx drivers.StorageDriver) error {
+		//accept the legacy id as well
+		vrow, err := resolve(tx, id)
+		if err != nil {
+			return err
+		}
+		//check the version
+		if ifMatch != "" && !vrow.MatchETag(ifMatch) {
+			return ErrPreconditionFailed
+		}
+		//set a copy of the old row with new value
+		record = vrow.Clone()
+		if err := fn(record); err != nil {
+			return err
+		}
+		record.ID = vrow.ID
+		record.Created = vrow.Created
+		record.LegacyID = vrow.LegacyID
+		record.Version = vrow.Version + 1
+		record.Modified = time.Now().Format(time.RFC3339)
+		//rename needs the new name reserved first
+		if vrow.Name != record.Name {
+			if err := claimName(tx, record.Name, vrow.ID); err != nil {
+				return err
+			}
+			releaseName(tx, vrow.Name, vrow.ID)
+		}
+		//swap only the row the version was checked against
+		if err := tx.CompareAndSwap(vrow.ID, vrow, record); err != nil {
+			return err
+		}
+		staged = true
+		return nil
+	})
+	switch {
+	case err == nil:
+		return record, nil
+	case err == drivers.ErrRecordChanged:
+		return nil, ErrPreconditionFailed
+	case staged:
+		//the journal refused the batch
+		return nil, ErrDBTransaction
+	default:
+		return nil, err
 	}
-	return nil
 }
@@ -0,0 +1,55 @@
+package models
+
+// FieldError rule broken by 1 field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Validate check the create parameter against the rules
+func (p *BuildingCreateParams) Validate() error {
+	v := NewValidator()
+	v.String("name", "name", p.Name)
+	v.String("address", "address", &p.Address)
+	v.Floors(p.Floors)
+	return v.Err()
+}
+
+// Validate check the update parameter against the rules
+func (p *BuildingUpdateParams) Validate() error {
+	v := NewValidator()
+	if p.ID == nil || *p.ID == "" {
+		v.add("id", RuleRequired, "is required")
+	}
+	v.String("name", "name", p.Name)
+	v.String("address", "address", &p.Address)
+	v.Floors(p.Floors)
+	return v.Err()
+}
+
+// Validate check the patched building against the rules
+func (q *BuildingData) Validate() error {
+	v := NewValidator()
+	v.String("name", "name", &q.Name)
+	v.String("address", "address", &q.Address)
+	v.Floors(q.Floors)
+	return v.Err()
+}
+
+// Validate check the floor parameter against the rules
+func (p *FloorCreateParams) Validate() error {
+	v := NewValidator()
+	v.Present("floors.level", "level", p.Level != nil)
+	v.String("floors.label", "label", &p.Label)
+	v.String("floors.usage_type", "usage_type", &p.UsageType)
+	v.Number("floors.gross_area", "gross_area", p.GrossArea)
+	return v.Err()
+}
+
+// Validate check the room parameter against the rules
+func (p *RoomCreateParams) Validate() error {
+	v := NewValidator()
+	v.Room("", p.Code, p.Type, p.Capacity, p.Area)
+	return v.Err()
+}
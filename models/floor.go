@@ -0,0 +1,200 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/tools"
+)
+
+// FloorData floor row under a building
+type FloorData struct {
+	ID        string   `json:"id"`
+	Level     int      `json:"level"`
+	Label     string   `json:"label,omitempty"`
+	GrossArea float64  `json:"gross_area,omitempty"`
+	UsageType string   `json:"usage_type,omitempty"`
+	Rooms     RoomList `json:"rooms,omitempty"`
+}
+
+// FloorSummary floor row with the roll-up figures
+type FloorSummary struct {
+	*FloorData
+	Occupancy Occupancy `json:"occupancy"`
+}
+
+// FloorList floors of a building, accepts the legacy list of labels too
+type FloorList []*FloorData
+
+// NewFloorList convert the legacy list of labels, levels follow the order
+func NewFloorList(labels []string) FloorList {
+	var floors FloorList
+	for i, label := range labels {
+		floors = append(floors, &FloorData{
+			ID:    legacyFloorID(i + 1),
+			Level: i + 1,
+			Label: strings.TrimSpace(label),
+		})
+	}
+	return floors
+}
+
+// Summary floor with the roll-up figures
+func (q *FloorData) Summary() *FloorSummary {
+	return &FloorSummary{
+		FloorData: q,
+		Occupancy: q.Rooms.Occupancy(),
+	}
+}
+
+// assignIDs give new floors and rooms their id
+func (q FloorList) assignIDs() {
+	for _, floor := range q {
+		if floor.ID == "" {
+			floor.ID = tools.Helper{}.UUID()
+		}
+		for _, room := range floor.Rooms {
+			if room.ID == "" {
+				room.ID = tools.Helper{}.UUID()
+			}
+		}
+	}
+}
+
+// UnmarshalJSON accept either floor objects or plain labels
+func (q *FloorList) UnmarshalJSON(raw []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return err
+	}
+	if items == nil {
+		*q = nil
+		return nil
+	}
+	floors := make(FloorList, 0, len(items))
+	for i, item := range items {
+		var label string
+		if err := json.Unmarshal(item, &label); err == nil {
+			floors = append(floors, &FloorData{
+				ID:    legacyFloorID(i + 1),
+				Level: i + 1,
+				Label: strings.TrimSpace(label),
+			})
+			continue
+		}
+		floor := &FloorData{}
+		if err := json.Unmarshal(item, floor); err != nil {
+			return err
+		}
+		floors = append(floors, floor)
+	}
+	*q = floors
+	return nil
+}
+
+// Clone deep copy of the list
+func (q FloorList) Clone() FloorList {
+	if q == nil {
+		return nil
+	}
+	floors := make(FloorList, len(q))
+	for i, floor := range q {
+		row := *floor
+		row.Rooms = floor.Rooms.Clone()
+		floors[i] = &row
+	}
+	return floors
+}
+
+// Find the floor by id
+func (q FloorList) Find(id string) (int, *FloorData) {
+	for i, floor := range q {
+		if floor.ID == id {
+			return i, floor
+		}
+	}
+	return -1, nil
+}
+
+// LevelTaken check if another floor already has the level
+func (q FloorList) LevelTaken(level int, exceptID string) bool {
+	for _, floor := range q {
+		if floor.Level == level && floor.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// LabelTaken check if another floor already has the label, case and spaces ignored
+func (q FloorList) LabelTaken(label, exceptID string) bool {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return false
+	}
+	for _, floor := range q {
+		if strings.EqualFold(strings.TrimSpace(floor.Label), label) && floor.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// Sort order by level
+func (q FloorList) Sort() {
+	sort.SliceStable(q, func(i, j int) bool { return q[i].Level < q[j].Level })
+}
+
+// SanityCheck level and id must be unique per building
+func (q FloorList) SanityCheck() error {
+	levels := make(map[int]bool)
+	ids := make(map[string]bool)
+	for _, floor := range q {
+		if floor == nil || levels[floor.Level] || floor.GrossArea < 0 {
+			return ErrInvalidParameters
+		}
+		if floor.ID != "" && ids[floor.ID] {
+			return ErrInvalidParameters
+		}
+		if err := floor.Rooms.SanityCheck(); err != nil {
+			return err
+		}
+		levels[floor.Level] = true
+		ids[floor.ID] = true
+	}
+	return nil
+}
+
+// dropsRooms check if some room of the list is missing from the next floors
+func (q FloorList) dropsRooms(next FloorList) bool {
+	kept := make(map[string]bool)
+	for _, floor := range next {
+		for _, room := range floor.Rooms {
+			kept[room.ID] = true
+		}
+	}
+	for _, floor := range q {
+		for _, room := range floor.Rooms {
+			if !kept[room.ID] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Occupancy roll-up of the rooms of all floors
+func (q FloorList) Occupancy() Occupancy {
+	var sum Occupancy
+	for _, floor := range q {
+		sum.merge(floor.Rooms.Occupancy())
+	}
+	return sum.rate()
+}
+
+// legacyFloorID stable id of a floor converted from a label
+func legacyFloorID(level int) string {
+	return fmt.Sprintf("floor-%d", level)
+}
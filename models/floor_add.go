@@ -0,0 +1,81 @@
+package models
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/tools"
+)
+
+// FloorCreateParams create parameter
+type FloorCreateParams struct {
+	BuildingID string  `json:"-"`
+	IfMatch    string  `json:"-"`
+	Level      *int    `json:"level"`
+	Label      string  `json:"label"`
+	GrossArea  float64 `json:"gross_area"`
+	UsageType  string  `json:"usage_type"`
+}
+
+// NewFloorCreate new creator under the building
+func NewFloorCreate(buildingID string) *FloorCreateParams {
+	return &FloorCreateParams{BuildingID: buildingID}
+}
+
+// Bind filter parameter
+func (p *FloorCreateParams) Bind(r *http.Request) error {
+	//sanity check
+	if p == nil {
+		return ErrMissingRequiredParameters
+	}
+	p.Label = strings.TrimSpace(p.Label)
+	p.UsageType = strings.TrimSpace(p.UsageType)
+	//rules first, they name every field at fault
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	//chk
+	return p.SanityCheck()
+}
+
+// SanityCheck filter required parameter
+func (p *FloorCreateParams) SanityCheck() error {
+	if p.BuildingID == "" || p.Level == nil {
+		return ErrMissingRequiredParameters
+	}
+	if p.GrossArea < 0 {
+		return ErrInvalidParameters
+	}
+	return nil
+}
+
+// Create add a floor to the building
+func (p *FloorCreateParams) Create(store drivers.StorageDriver) (string, error) {
+	//should not happen
+	if err := p.SanityCheck(); err != nil {
+		return "", err
+	}
+	floor := &FloorData{
+		ID:        tools.Helper{}.UUID(),
+		Level:     *p.Level,
+		Label:     p.Label,
+		GrossArea: p.GrossArea,
+		UsageType: p.UsageType,
+	}
+	_, err := modifyRecord(store, p.BuildingID, p.IfMatch, func(record *BuildingData) error {
+		if record.Floors.LevelTaken(floor.Level, "") {
+			return ErrRecordExists
+		}
+		if Rules()["floors.label"].Unique && record.Floors.LabelTaken(floor.Label, "") {
+			return ErrRecordExists
+		}
+		record.Floors = append(record.Floors, floor)
+		record.Floors.Sort()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return floor.ID, nil
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"github.com/bayugyug/building-custom-api/drivers"
+)
+
+// FloorDeleteParams delete parameter
+type FloorDeleteParams struct {
+	BuildingID string `json:"-"`
+	ID         string `json:"id"`
+	IfMatch    string `json:"-"`
+	Cascade    bool   `json:"-"`
+}
+
+// NewFloorDelete new instance for the floor under the building
+func NewFloorDelete(buildingID, id string) *FloorDeleteParams {
+	return &FloorDeleteParams{BuildingID: buildingID, ID: id}
+}
+
+// Delete remove the floor from the building, refused if it has rooms unless cascading
+func (p *FloorDeleteParams) Delete(store drivers.StorageDriver) error {
+	_, err := modifyRecord(store, p.BuildingID, p.IfMatch, func(record *BuildingData) error {
+		idx, floor := record.Floors.Find(p.ID)
+		if floor == nil {
+			return ErrRecordNotFound
+		}
+		//rooms go along only if asked
+		if len(floor.Rooms) > 0 && !p.Cascade {
+			return ErrRecordInUse
+		}
+		record.Floors = append(record.Floors[:idx:idx], record.Floors[idx+1:]...)
+		return nil
+	})
+	return err
+}
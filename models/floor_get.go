@@ -0,0 +1,41 @@
+package models
+
+import (
+	"github.com/bayugyug/building-custom-api/drivers"
+)
+
+// FloorGetParams get parameter
+type FloorGetParams struct {
+	BuildingID string `json:"-"`
+	ID         string `json:"id"`
+}
+
+// NewFloorGet new instance for the floor under the building
+func NewFloorGet(buildingID, id string) *FloorGetParams {
+	return &FloorGetParams{BuildingID: buildingID, ID: id}
+}
+
+// Get query 1 floor of the building
+func (p *FloorGetParams) Get(store drivers.StorageDriver) (*FloorData, error) {
+	record, err := resolve(store, p.BuildingID)
+	if err != nil {
+		return nil, err
+	}
+	if _, floor := record.Floors.Find(p.ID); floor != nil {
+		return floor, nil
+	}
+	//not found
+	return nil, ErrRecordNotFound
+}
+
+// GetAll query the floors of the building ordered by level
+func (p *FloorGetParams) GetAll(store drivers.StorageDriver) (FloorList, error) {
+	record, err := resolve(store, p.BuildingID)
+	if err != nil {
+		return nil, err
+	}
+	if len(record.Floors) <= 0 {
+		return FloorList{}, nil
+	}
+	return record.Floors, nil
+}
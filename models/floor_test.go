@@ -0,0 +1,136 @@
+package models_test
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/models"
+	"github.com/icrowley/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::FLOORS", func() {
+
+	//init
+	var store *drivers.Storage
+	var pid string
+
+	BeforeEach(func() {
+		store = drivers.NewStorage()
+		name := fmt.Sprintf("marina-bay-sands::%s", fake.DigitsN(15))
+		params := &models.BuildingCreateParams{Name: &name}
+		if err := json.Unmarshal([]byte(`{"floors":["lobby","office"]}`), params); err != nil {
+			Fail(err.Error())
+		}
+		var err error
+		if pid, err = params.Create(store); err != nil {
+			Fail(err.Error())
+		}
+	})
+
+	level := func(n int) *int {
+		return &n
+	}
+
+	Context("Valid parameters", func() {
+
+		It("should convert the legacy floor labels", func() {
+			rows, err := models.NewFloorGet(pid, "").GetAll(store)
+			Expect(err).To(BeZero())
+			Expect(len(rows)).To(Equal(2))
+			Expect(rows[0].Level).To(Equal(1))
+			Expect(rows[0].Label).To(Equal("lobby"))
+			Expect(rows[1].ID).To(Equal("floor-2"))
+			By("Legacy floors ok")
+		})
+
+		It("should add, update and remove a floor", func() {
+			params := models.NewFloorCreate(pid)
+			params.Level = level(-1)
+			params.Label = "parking"
+			params.GrossArea = 1200.5
+			fid, err := params.Create(store)
+			Expect(err).To(BeZero())
+			rows, _ := models.NewFloorGet(pid, "").GetAll(store)
+			Expect(rows[0].ID).To(Equal(fid))
+			By("Create floor ok")
+
+			uparams := models.NewFloorUpdate(pid, fid)
+			uparams.Level = level(0)
+			uparams.Label = "basement"
+			row, err := uparams.Update(store)
+			Expect(err).To(BeZero())
+			Expect(row.Label).To(Equal("basement"))
+			Expect(row.GrossArea).To(BeZero())
+			By("Update floor ok")
+
+			Expect(models.NewFloorDelete(pid, fid).Delete(store)).To(BeZero())
+			_, err = models.NewFloorGet(pid, fid).Get(store)
+			Expect(err).To(Equal(models.ErrRecordNotFound))
+			building, _ := models.NewBuildingGetOne(pid).Get(store)
+			Expect(building.Version).To(Equal(int64(4)))
+			By("Delete floor ok")
+		})
+	})
+
+	Context("Invalid parameters", func() {
+
+		It("should not allow the same level twice", func() {
+			params := models.NewFloorCreate(pid)
+			params.Level = level(2)
+			_, err := params.Create(store)
+			Expect(err).To(Equal(models.ErrRecordExists))
+
+			uparams := models.NewFloorUpdate(pid, "floor-1")
+			uparams.Level = level(2)
+			_, err = uparams.Update(store)
+			Expect(err).To(Equal(models.ErrRecordExists))
+			By("Duplicate level rejected")
+		})
+
+		It("should not allow the same label twice", func() {
+			params := models.NewFloorCreate(pid)
+			params.Level = level(3)
+			params.Label = "LOBBY"
+			_, err := params.Create(store)
+			Expect(err).To(Equal(models.ErrRecordExists))
+
+			uparams := models.NewFloorUpdate(pid, "floor-2")
+			uparams.Level = level(2)
+			uparams.Label = "Lobby"
+			_, err = uparams.Update(store)
+			Expect(err).To(Equal(models.ErrRecordExists))
+			uparams.Label = "office"
+			_, err = uparams.Update(store)
+			Expect(err).To(BeZero())
+			By("Duplicate label rejected")
+
+			unique := false
+			Expect(models.OverrideRules(map[string]*models.RuleOverride{"floors.label": {Unique: &unique}})).To(BeZero())
+			defer models.SetRules(models.DefaultRules())
+			_, err = params.Create(store)
+			Expect(err).To(BeZero())
+			By("Duplicate label allowed by the rules")
+		})
+
+		It("should not find a missing floor or building", func() {
+			_, err := models.NewFloorGet(pid, "not-exists").Get(store)
+			Expect(err).To(Equal(models.ErrRecordNotFound))
+			Expect(models.NewFloorDelete(pid, "not-exists").Delete(store)).To(Equal(models.ErrRecordNotFound))
+			_, err = models.NewFloorGet("not-exists", "").GetAll(store)
+			Expect(err).To(Equal(models.ErrRecordNotFound))
+			By("Missing floor as expected")
+		})
+
+		It("should reject duplicate levels on building create", func() {
+			name := fmt.Sprintf("marina-bay-sands::%s", fake.DigitsN(15))
+			params := &models.BuildingCreateParams{Name: &name}
+			json.Unmarshal([]byte(`{"floors":[{"level":1},{"level":1}]}`), params)
+			_, err := params.Create(store)
+			Expect(err).To(Equal(models.ErrInvalidParameters))
+			By("Duplicate level rejected")
+		})
+	})
+})
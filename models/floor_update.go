@@ -0,0 +1,78 @@
+package models
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+)
+
+// FloorUpdateParams update parameter
+type FloorUpdateParams struct {
+	ID string `json:"-"`
+	FloorCreateParams
+}
+
+// NewFloorUpdate new instance for the floor under the building
+func NewFloorUpdate(buildingID, id string) *FloorUpdateParams {
+	return &FloorUpdateParams{
+		ID:                id,
+		FloorCreateParams: FloorCreateParams{BuildingID: buildingID},
+	}
+}
+
+// Bind filter parameter
+func (p *FloorUpdateParams) Bind(r *http.Request) error {
+	//sanity check
+	if p == nil {
+		return ErrMissingRequiredParameters
+	}
+	//fmt
+	p.Label = strings.TrimSpace(p.Label)
+	p.UsageType = strings.TrimSpace(p.UsageType)
+	//rules first, they name every field at fault
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	//chk
+	return p.SanityCheck()
+}
+
+// SanityCheck filter required parameter
+func (p *FloorUpdateParams) SanityCheck() error {
+	if p.ID == "" {
+		return ErrMissingRequiredParameters
+	}
+	return p.FloorCreateParams.SanityCheck()
+}
+
+// Update replace the floor fields
+func (p *FloorUpdateParams) Update(store drivers.StorageDriver) (*FloorData, error) {
+	//should not happen :-)
+	if err := p.SanityCheck(); err != nil {
+		return nil, err
+	}
+	var floor *FloorData
+	_, err := modifyRecord(store, p.BuildingID, p.IfMatch, func(record *BuildingData) error {
+		_, floor = record.Floors.Find(p.ID)
+		if floor == nil {
+			return ErrRecordNotFound
+		}
+		if record.Floors.LevelTaken(*p.Level, p.ID) {
+			return ErrRecordExists
+		}
+		if Rules()["floors.label"].Unique && record.Floors.LabelTaken(p.Label, p.ID) {
+			return ErrRecordExists
+		}
+		floor.Level = *p.Level
+		floor.Label = p.Label
+		floor.GrossArea = p.GrossArea
+		floor.UsageType = p.UsageType
+		record.Floors.Sort()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return floor, nil
+}
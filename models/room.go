@@ -0,0 +1,112 @@
+package models
+
+import (
+	"strings"
+)
+
+// RoomData room or unit row under a floor
+type RoomData struct {
+	ID       string  `json:"id"`
+	Code     string  `json:"code"`
+	Type     string  `json:"type,omitempty"`
+	Capacity int     `json:"capacity,omitempty"`
+	Area     float64 `json:"area,omitempty"`
+	Occupied bool    `json:"occupied"`
+}
+
+// RoomList rooms of a floor
+type RoomList []*RoomData
+
+// Occupancy roll-up figures of the rooms, rate is occupied over total rooms
+type Occupancy struct {
+	Rooms            int     `json:"rooms"`
+	OccupiedRooms    int     `json:"occupied_rooms"`
+	Capacity         int     `json:"capacity"`
+	OccupiedCapacity int     `json:"occupied_capacity"`
+	Rate             float64 `json:"occupancy_rate"`
+}
+
+// Clone deep copy of the list
+func (q RoomList) Clone() RoomList {
+	if q == nil {
+		return nil
+	}
+	rooms := make(RoomList, len(q))
+	for i, room := range q {
+		row := *room
+		rooms[i] = &row
+	}
+	return rooms
+}
+
+// Find the room by id
+func (q RoomList) Find(id string) (int, *RoomData) {
+	for i, room := range q {
+		if room.ID == id {
+			return i, room
+		}
+	}
+	return -1, nil
+}
+
+// CodeTaken check if another room already has the code
+func (q RoomList) CodeTaken(code, exceptID string) bool {
+	for _, room := range q {
+		if strings.EqualFold(room.Code, code) && room.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// SanityCheck code must be unique per floor
+func (q RoomList) SanityCheck() error {
+	codes := make(map[string]bool)
+	for _, room := range q {
+		if room == nil || room.Code == "" || room.Capacity < 0 || room.Area < 0 {
+			return ErrInvalidParameters
+		}
+		code := strings.ToLower(room.Code)
+		if codes[code] {
+			return ErrInvalidParameters
+		}
+		codes[code] = true
+	}
+	return nil
+}
+
+// Occupancy roll-up of the rooms
+func (q RoomList) Occupancy() Occupancy {
+	var sum Occupancy
+	for _, room := range q {
+		sum.add(room)
+	}
+	return sum.rate()
+}
+
+// add count the room
+func (o *Occupancy) add(room *RoomData) {
+	o.Rooms++
+	o.Capacity += room.Capacity
+	if room.Occupied {
+		o.OccupiedRooms++
+		o.OccupiedCapacity += room.Capacity
+	}
+}
+
+// merge sum with another roll-up
+func (o *Occupancy) merge(other Occupancy) {
+	o.Rooms += other.Rooms
+	o.OccupiedRooms += other.OccupiedRooms
+	o.Capacity += other.Capacity
+	o.OccupiedCapacity += other.OccupiedCapacity
+}
+
+// rate compute the occupancy rate
+func (o Occupancy) rate() Occupancy {
+	o.Rate = 0
+	if o.Rooms > 0 {
+		o.Rate = float64(o.OccupiedRooms) / float64(o.Rooms)
+	}
+	return o
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/tools"
+)
+
+// RoomCreateParams create parameter
+type RoomCreateParams struct {
+	BuildingID string  `json:"-"`
+	FloorID    string  `json:"-"`
+	IfMatch    string  `json:"-"`
+	Code       string  `json:"code"`
+	Type       string  `json:"type"`
+	Capacity   int     `json:"capacity"`
+	Area       float64 `json:"area"`
+	Occupied   bool    `json:"occupied"`
+}
+
+// NewRoomCreate new creator under the floor
+func NewRoomCreate(buildingID, floorID string) *RoomCreateParams {
+	return &RoomCreateParams{BuildingID: buildingID, FloorID: floorID}
+}
+
+// Bind filter parameter
+func (p *RoomCreateParams) Bind(r *http.Request) error {
+	//sanity check
+	if p == nil {
+		return ErrMissingRequiredParameters
+	}
+	p.Code = strings.TrimSpace(p.Code)
+	p.Type = strings.TrimSpace(p.Type)
+	//rules first, they name every field at fault
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	//chk
+	return p.SanityCheck()
+}
+
+// SanityCheck filter required parameter
+func (p *RoomCreateParams) SanityCheck() error {
+	if p.BuildingID == "" || p.FloorID == "" || p.Code == "" {
+		return ErrMissingRequiredParameters
+	}
+	if p.Capacity < 0 || p.Area < 0 {
+		return ErrInvalidParameters
+	}
+	return nil
+}
+
+// Create add a room to the floor
+func (p *RoomCreateParams) Create(store drivers.StorageDriver) (string, error) {
+	//should not happen
+	if err := p.SanityCheck(); err != nil {
+		return "", err
+	}
+	room := &RoomData{
+		ID:       tools.Helper{}.UUID(),
+		Code:     p.Code,
+		Type:     p.Type,
+		Capacity: p.Capacity,
+		Area:     p.Area,
+		Occupied: p.Occupied,
+	}
+	_, err := modifyRecord(store, p.BuildingID, p.IfMatch, func(record *BuildingData) error {
+		_, floor := record.Floors.Find(p.FloorID)
+		if floor == nil {
+			return ErrRecordNotFound
+		}
+		if floor.Rooms.CodeTaken(room.Code, "") {
+			return ErrRecordExists
+		}
+		floor.Rooms = append(floor.Rooms, room)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return room.ID, nil
+}
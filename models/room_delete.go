@@ -0,0 +1,35 @@
+package models
+
+import (
+	"github.com/bayugyug/building-custom-api/drivers"
+)
+
+// RoomDeleteParams delete parameter
+type RoomDeleteParams struct {
+	BuildingID string `json:"-"`
+	FloorID    string `json:"-"`
+	ID         string `json:"id"`
+	IfMatch    string `json:"-"`
+}
+
+// NewRoomDelete new instance for the room under the floor
+func NewRoomDelete(buildingID, floorID, id string) *RoomDeleteParams {
+	return &RoomDeleteParams{BuildingID: buildingID, FloorID: floorID, ID: id}
+}
+
+// Delete remove the room from the floor
+func (p *RoomDeleteParams) Delete(store drivers.StorageDriver) error {
+	_, err := modifyRecord(store, p.BuildingID, p.IfMatch, func(record *BuildingData) error {
+		_, floor := record.Floors.Find(p.FloorID)
+		if floor == nil {
+			return ErrRecordNotFound
+		}
+		idx, room := floor.Rooms.Find(p.ID)
+		if room == nil {
+			return ErrRecordNotFound
+		}
+		floor.Rooms = append(floor.Rooms[:idx:idx], floor.Rooms[idx+1:]...)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"github.com/bayugyug/building-custom-api/drivers"
+)
+
+// RoomGetParams get parameter
+type RoomGetParams struct {
+	BuildingID string `json:"-"`
+	FloorID    string `json:"-"`
+	ID         string `json:"id"`
+}
+
+// NewRoomGet new instance for the room under the floor
+func NewRoomGet(buildingID, floorID, id string) *RoomGetParams {
+	return &RoomGetParams{BuildingID: buildingID, FloorID: floorID, ID: id}
+}
+
+// Get query 1 room of the floor
+func (p *RoomGetParams) Get(store drivers.StorageDriver) (*RoomData, error) {
+	rows, err := p.GetAll(store)
+	if err != nil {
+		return nil, err
+	}
+	if _, room := rows.Find(p.ID); room != nil {
+		return room, nil
+	}
+	//not found
+	return nil, ErrRecordNotFound
+}
+
+// GetAll query the rooms of the floor
+func (p *RoomGetParams) GetAll(store drivers.StorageDriver) (RoomList, error) {
+	floor, err := NewFloorGet(p.BuildingID, p.FloorID).Get(store)
+	if err != nil {
+		return nil, err
+	}
+	if len(floor.Rooms) <= 0 {
+		return RoomList{}, nil
+	}
+	return floor.Rooms, nil
+}
@@ -0,0 +1,151 @@
+package models_test
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/models"
+	"github.com/icrowley/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::ROOMS", func() {
+
+	//init
+	var store *drivers.Storage
+	var pid string
+
+	BeforeEach(func() {
+		store = drivers.NewStorage()
+		name := fmt.Sprintf("marina-bay-sands::%s", fake.DigitsN(15))
+		params := &models.BuildingCreateParams{Name: &name}
+		if err := json.Unmarshal([]byte(`{"floors":["lobby","office"]}`), params); err != nil {
+			Fail(err.Error())
+		}
+		var err error
+		if pid, err = params.Create(store); err != nil {
+			Fail(err.Error())
+		}
+	})
+
+	addRoom := func(floorID, code string, capacity int, occupied bool) string {
+		params := models.NewRoomCreate(pid, floorID)
+		params.Code = code
+		params.Capacity = capacity
+		params.Occupied = occupied
+		rid, err := params.Create(store)
+		Expect(err).To(BeZero())
+		return rid
+	}
+
+	Context("Valid parameters", func() {
+
+		It("should add, update and remove a room", func() {
+			rid := addRoom("floor-2", "2-01", 4, false)
+			row, err := models.NewRoomGet(pid, "floor-2", rid).Get(store)
+			Expect(err).To(BeZero())
+			Expect(row.Code).To(Equal("2-01"))
+			By("Create room ok")
+
+			uparams := models.NewRoomUpdate(pid, "floor-2", rid)
+			uparams.Code = "2-01A"
+			uparams.Capacity = 6
+			uparams.Occupied = true
+			row, err = uparams.Update(store)
+			Expect(err).To(BeZero())
+			Expect(row.Capacity).To(Equal(6))
+			Expect(row.Occupied).To(BeTrue())
+			By("Update room ok")
+
+			Expect(models.NewRoomDelete(pid, "floor-2", rid).Delete(store)).To(BeZero())
+			_, err = models.NewRoomGet(pid, "floor-2", rid).Get(store)
+			Expect(err).To(Equal(models.ErrRecordNotFound))
+			By("Delete room ok")
+		})
+
+		It("should roll up the occupancy", func() {
+			addRoom("floor-1", "1-01", 2, true)
+			addRoom("floor-2", "2-01", 4, true)
+			addRoom("floor-2", "2-02", 6, false)
+			addRoom("floor-2", "2-03", 8, false)
+
+			floor, _ := models.NewFloorGet(pid, "floor-2").Get(store)
+			sum := floor.Summary().Occupancy
+			Expect(sum.Rooms).To(Equal(3))
+			Expect(sum.OccupiedCapacity).To(Equal(4))
+			By("Floor roll-up ok")
+
+			building, _ := models.NewBuildingGetOne(pid).Get(store)
+			total := building.Summary().Occupancy
+			Expect(total.Rooms).To(Equal(4))
+			Expect(total.OccupiedRooms).To(Equal(2))
+			Expect(total.Capacity).To(Equal(20))
+			Expect(total.Rate).To(Equal(0.5))
+			By("Building roll-up ok")
+		})
+
+		It("should cascade the floor delete only if asked", func() {
+			addRoom("floor-1", "1-01", 2, false)
+			params := models.NewFloorDelete(pid, "floor-1")
+			Expect(params.Delete(store)).To(Equal(models.ErrRecordInUse))
+			params.Cascade = true
+			Expect(params.Delete(store)).To(BeZero())
+			By("Cascade delete ok")
+		})
+
+		It("should replace the floors on update only if no room is lost", func() {
+			rid := addRoom("floor-2", "2-01", 4, false)
+			building, _ := models.NewBuildingGetOne(pid).Get(store)
+			name := building.Name
+			update := &models.BuildingUpdateParams{ID: &pid}
+			update.Name = &name
+			update.Floors = models.NewFloorList([]string{"lobby", "office"})
+			Expect(update.Update(store)).To(Equal(models.ErrRecordInUse))
+			update.Floors = nil
+			Expect(update.Update(store)).To(Equal(models.ErrRecordInUse))
+			By("Rooms kept")
+
+			update.Floors = building.Floors.Clone()
+			update.Floors[0].Label = "ground"
+			Expect(update.Update(store)).To(BeZero())
+			room, err := models.NewRoomGet(pid, "floor-2", rid).Get(store)
+			Expect(err).To(BeZero())
+			Expect(room.Code).To(Equal("2-01"))
+			By("Floors with their rooms replaced")
+
+			Expect(models.NewRoomDelete(pid, "floor-2", rid).Delete(store)).To(BeZero())
+			update.Floors = nil
+			Expect(update.Update(store)).To(BeZero())
+			floors, err := models.NewFloorGet(pid, "").GetAll(store)
+			Expect(err).To(BeZero())
+			Expect(floors).To(BeEmpty())
+			By("Floors replaced as a whole")
+		})
+	})
+
+	Context("Invalid parameters", func() {
+
+		It("should not allow the same code twice on a floor", func() {
+			addRoom("floor-1", "A1", 2, false)
+			params := models.NewRoomCreate(pid, "floor-1")
+			params.Code = "a1"
+			_, err := params.Create(store)
+			Expect(err).To(Equal(models.ErrRecordExists))
+			addRoom("floor-2", "A1", 2, false)
+			By("Duplicate code rejected")
+
+			params = models.NewRoomCreate(pid, "floor-9")
+			params.Code = "Z9"
+			_, err = params.Create(store)
+			Expect(err).To(Equal(models.ErrRecordNotFound))
+			params = models.NewRoomCreate(pid, "floor-1")
+			params.Code = "B1"
+			params.Capacity = -1
+			_, err = params.Create(store)
+			Expect(err).To(Equal(models.ErrInvalidParameters))
+			By("Invalid room rejected")
+		})
+	})
+})
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+)
+
+// RoomUpdateParams update parameter
+type RoomUpdateParams struct {
+	ID string `json:"-"`
+	RoomCreateParams
+}
+
+// NewRoomUpdate new instance for the room under the floor
+func NewRoomUpdate(buildingID, floorID, id string) *RoomUpdateParams {
+	return &RoomUpdateParams{
+		ID:               id,
+		RoomCreateParams: RoomCreateParams{BuildingID: buildingID, FloorID: floorID},
+	}
+}
+
+// Bind filter parameter
+func (p *RoomUpdateParams) Bind(r *http.Request) error {
+	//sanity check
+	if p == nil {
+		return ErrMissingRequiredParameters
+	}
+	//fmt
+	p.Code = strings.TrimSpace(p.Code)
+	p.Type = strings.TrimSpace(p.Type)
+	//rules first, they name every field at fault
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	//chk
+	return p.SanityCheck()
+}
+
+// SanityCheck filter required parameter
+func (p *RoomUpdateParams) SanityCheck() error {
+	if p.ID == "" {
+		return ErrMissingRequiredParameters
+	}
+	return p.RoomCreateParams.SanityCheck()
+}
+
+// Update replace the room fields
+func (p *RoomUpdateParams) Update(store drivers.StorageDriver) (*RoomData, error) {
+	//should not happen :-)
+	if err := p.SanityCheck(); err != nil {
+		return nil, err
+	}
+	var room *RoomData
+	_, err := modifyRecord(store, p.BuildingID, p.IfMatch, func(record *BuildingData) error {
+		_, floor := record.Floors.Find(p.FloorID)
+		if floor == nil {
+			return ErrRecordNotFound
+		}
+		if _, room = floor.Rooms.Find(p.ID); room == nil {
+			return ErrRecordNotFound
+		}
+		if floor.Rooms.CodeTaken(p.Code, p.ID) {
+			return ErrRecordExists
+		}
+		room.Code = p.Code
+		room.Type = p.Type
+		room.Capacity = p.Capacity
+		room.Area = p.Area
+		room.Occupied = p.Occupied
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
@@ -0,0 +1,289 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// validation rule names given back in the field errors
+const (
+	RuleRequired  = "required"
+	RuleTrimmed   = "trimmed"
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RulePattern   = "pattern"
+	RuleUnique    = "unique"
+	RuleMin       = "min"
+	RuleMax       = "max"
+)
+
+var (
+	// ErrUnknownRuleField rule override for a field that has no rules
+	ErrUnknownRuleField = errors.New("unknown validation field")
+
+	rulesMtx sync.RWMutex
+	rules    = DefaultRules()
+)
+
+// FieldRules constraints of 1 payload field, lengths of lists are the item count
+type FieldRules struct {
+	Required  bool
+	Trimmed   bool
+	MinLength int
+	MaxLength int
+	Pattern   *regexp.Regexp
+	Unique    bool
+	Min       *float64
+	Max       *float64
+}
+
+// ValidationRules field rules by payload field, list items as "floors.label"
+type ValidationRules map[string]FieldRules
+
+// RuleOverride config change of the rules of 1 field, nil keeps the default
+type RuleOverride struct {
+	Required  *bool
+	Trimmed   *bool
+	MinLength *int
+	MaxLength *int
+	Pattern   *string
+	Unique    *bool
+	Min       *float64
+	Max       *float64
+}
+
+// ValidationError all the fields that broke their rules
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error message of the validation
+func (e *ValidationError) Error() string {
+	return "validation failed"
+}
+
+// DefaultRules rules of the building payloads
+func DefaultRules() ValidationRules {
+	zero := 0.0
+	return ValidationRules{
+		"name":                  {Required: true, Trimmed: true, MaxLength: 200},
+		"address":               {MaxLength: 500},
+		"floors":                {MaxLength: 500},
+		"floors.level":          {Required: true, Unique: true},
+		"floors.label":          {Required: true, Trimmed: true, Unique: true, MaxLength: 100},
+		"floors.usage_type":     {MaxLength: 50},
+		"floors.gross_area":     {Min: &zero},
+		"floors.rooms":          {MaxLength: 1000},
+		"floors.rooms.code":     {Required: true, Trimmed: true, Unique: true, MaxLength: 50},
+		"floors.rooms.type":     {MaxLength: 50},
+		"floors.rooms.capacity": {Min: &zero},
+		"floors.rooms.area":     {Min: &zero},
+	}
+}
+
+// Rules the rules in use, read only
+func Rules() ValidationRules {
+	rulesMtx.RLock()
+	defer rulesMtx.RUnlock()
+	return rules
+}
+
+// SetRules replace the rules in use
+func SetRules(r ValidationRules) {
+	rulesMtx.Lock()
+	defer rulesMtx.Unlock()
+	rules = r
+}
+
+// OverrideRules apply the overrides on top of the defaults and use the result
+func OverrideRules(overrides map[string]*RuleOverride) error {
+	merged := DefaultRules()
+	for field, o := range overrides {
+		r, ok := merged[field]
+		if !ok {
+			return fmt.Errorf("%v: %s", ErrUnknownRuleField, field)
+		}
+		if o == nil {
+			continue
+		}
+		if o.Required != nil {
+			r.Required = *o.Required
+		}
+		if o.Trimmed != nil {
+			r.Trimmed = *o.Trimmed
+		}
+		if o.MinLength != nil {
+			r.MinLength = *o.MinLength
+		}
+		if o.MaxLength != nil {
+			r.MaxLength = *o.MaxLength
+		}
+		if o.Pattern != nil {
+			r.Pattern = nil
+			if *o.Pattern != "" {
+				re, err := regexp.Compile(*o.Pattern)
+				if err != nil {
+					return fmt.Errorf("%s: %v", field, err)
+				}
+				r.Pattern = re
+			}
+		}
+		if o.Unique != nil {
+			r.Unique = *o.Unique
+		}
+		if o.Min != nil {
+			r.Min = o.Min
+		}
+		if o.Max != nil {
+			r.Max = o.Max
+		}
+		merged[field] = r
+	}
+	SetRules(merged)
+	return nil
+}
+
+// Validator collect the rule violations of a payload
+type Validator struct {
+	rules ValidationRules
+	errs  []FieldError
+}
+
+// NewValidator new instance with the rules in use
+func NewValidator() *Validator {
+	return &Validator{rules: Rules()}
+}
+
+// Present check a required field that is not a string
+func (v *Validator) Present(key, field string, present bool) {
+	if !present && v.rules[key].Required {
+		v.add(field, RuleRequired, "is required")
+	}
+}
+
+// String check a string field, nil is absent
+func (v *Validator) String(key, field string, value *string) {
+	r := v.rules[key]
+	if value == nil || *value == "" {
+		v.Present(key, field, false)
+		return
+	}
+	s := *value
+	if r.Trimmed && strings.TrimSpace(s) == "" {
+		v.add(field, RuleTrimmed, "must not be blank")
+		return
+	}
+	size := utf8.RuneCountInString(s)
+	if r.MinLength > 0 && size < r.MinLength {
+		v.add(field, RuleMinLength, fmt.Sprintf("must be at least %d characters", r.MinLength))
+	}
+	if r.MaxLength > 0 && size > r.MaxLength {
+		v.add(field, RuleMaxLength, fmt.Sprintf("must be at most %d characters", r.MaxLength))
+	}
+	if r.Pattern != nil && !r.Pattern.MatchString(s) {
+		v.add(field, RulePattern, fmt.Sprintf("must match %s", r.Pattern.String()))
+	}
+}
+
+// Number check a numeric field
+func (v *Validator) Number(key, field string, value float64) {
+	r := v.rules[key]
+	if r.Min != nil && value < *r.Min {
+		v.add(field, RuleMin, fmt.Sprintf("must be at least %v", *r.Min))
+	}
+	if r.Max != nil && value > *r.Max {
+		v.add(field, RuleMax, fmt.Sprintf("must be at most %v", *r.Max))
+	}
+}
+
+// Count check the item count of a list field
+func (v *Validator) Count(key, field string, n int) {
+	r := v.rules[key]
+	if r.MinLength > 0 && n < r.MinLength {
+		v.add(field, RuleMinLength, fmt.Sprintf("must have at least %d items", r.MinLength))
+	}
+	if r.MaxLength > 0 && n > r.MaxLength {
+		v.add(field, RuleMaxLength, fmt.Sprintf("must have at most %d items", r.MaxLength))
+	}
+}
+
+// Unique check the values of a list item field, case and spaces ignored, field has a %d for the index
+func (v *Validator) Unique(key, field string, values []string) {
+	if !v.rules[key].Unique {
+		return
+	}
+	seen := make(map[string]bool)
+	for i, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		if seen[value] {
+			v.add(fmt.Sprintf(field, i), RuleUnique, "must be unique")
+		}
+		seen[value] = true
+	}
+}
+
+// Floors check the floors and their rooms
+func (v *Validator) Floors(floors FloorList) {
+	v.Count("floors", "floors", len(floors))
+	levels := make([]string, len(floors))
+	labels := make([]string, len(floors))
+	for i, floor := range floors {
+		if floor == nil {
+			v.add(fmt.Sprintf("floors[%d]", i), RuleRequired, "is required")
+			continue
+		}
+		prefix := fmt.Sprintf("floors[%d].", i)
+		v.String("floors.label", prefix+"label", &floor.Label)
+		v.String("floors.usage_type", prefix+"usage_type", &floor.UsageType)
+		v.Number("floors.gross_area", prefix+"gross_area", floor.GrossArea)
+		v.Rooms(prefix, floor.Rooms)
+		levels[i] = fmt.Sprint(floor.Level)
+		labels[i] = floor.Label
+	}
+	v.Unique("floors.level", "floors[%d].level", levels)
+	v.Unique("floors.label", "floors[%d].label", labels)
+}
+
+// Rooms check the rooms of a floor, prefix is the path of the floor
+func (v *Validator) Rooms(prefix string, rooms RoomList) {
+	v.Count("floors.rooms", prefix+"rooms", len(rooms))
+	codes := make([]string, len(rooms))
+	for i, room := range rooms {
+		field := fmt.Sprintf("%srooms[%d].", prefix, i)
+		if room == nil {
+			v.add(strings.TrimSuffix(field, "."), RuleRequired, "is required")
+			continue
+		}
+		v.Room(field, room.Code, room.Type, room.Capacity, room.Area)
+		codes[i] = room.Code
+	}
+	v.Unique("floors.rooms.code", prefix+"rooms[%d].code", codes)
+}
+
+// Room check the fields of 1 room, prefix is the path of the room
+func (v *Validator) Room(prefix, code, kind string, capacity int, area float64) {
+	v.String("floors.rooms.code", prefix+"code", &code)
+	v.String("floors.rooms.type", prefix+"type", &kind)
+	v.Number("floors.rooms.capacity", prefix+"capacity", float64(capacity))
+	v.Number("floors.rooms.area", prefix+"area", area)
+}
+
+// Err the violations found, nil if none
+func (v *Validator) Err() error {
+	if len(v.errs) <= 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.errs}
+}
+
+// add 1 violation
+func (v *Validator) add(field, rule, message string) {
+	v.errs = append(v.errs, FieldError{Field: field, Rule: rule, Message: message})
+}
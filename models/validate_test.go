@@ -0,0 +1,136 @@
+package models_test
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::VALIDATION", func() {
+
+	AfterEach(func() {
+		models.SetRules(models.DefaultRules())
+	})
+
+	params := func(payload string) *models.BuildingCreateParams {
+		p := models.NewBuildingCreate()
+		if err := json.Unmarshal([]byte(payload), p); err != nil {
+			Fail(err.Error())
+		}
+		return p
+	}
+
+	fields := func(err error) []string {
+		verr, ok := err.(*models.ValidationError)
+		Expect(ok).To(BeTrue())
+		var list []string
+		for _, f := range verr.Fields {
+			list = append(list, f.Field+":"+f.Rule)
+		}
+		return list
+	}
+
+	Context("Default rules", func() {
+
+		It("should accept a good payload", func() {
+			p := params(`{"name":"tower-1","address":"Marina Boulevard","floors":["lobby","office"]}`)
+			Expect(p.Validate()).To(BeZero())
+			By("Valid payload ok")
+		})
+
+		It("should collect every violation", func() {
+			long := strings.Repeat("x", 600)
+			p := params(`{"name":"   ","address":"` + long + `","floors":["lobby"," ","Lobby"]}`)
+			Expect(fields(p.Validate())).To(Equal([]string{
+				"name:trimmed",
+				"address:max_length",
+				"floors[1].label:required",
+				"floors[2].label:unique",
+			}))
+			By("All violations ok")
+
+			p = params(`{"floors":[{"level":1,"label":"a","rooms":[{"code":"r1","capacity":-2},{"code":"R1"}]},{"level":1,"label":"b","gross_area":-1}]}`)
+			Expect(fields(p.Validate())).To(Equal([]string{
+				"name:required",
+				"floors[0].rooms[0].capacity:min",
+				"floors[0].rooms[1].code:unique",
+				"floors[1].gross_area:min",
+				"floors[1].level:unique",
+			}))
+			By("Nested violations ok")
+		})
+	})
+
+	Context("Patch", func() {
+
+		It("should hold the patched building to the same rules", func() {
+			store := drivers.NewStorage()
+			p := params(`{"name":"tower-1","floors":[{"level":1,"label":"lobby","rooms":[{"code":"r1"}]},{"level":2,"label":"office"}]}`)
+			pid, err := p.Create(store)
+			Expect(err).To(BeZero())
+			long := strings.Repeat("x", 600)
+			for _, tc := range []struct {
+				patch string
+				want  []string
+			}{
+				{`{"name":null}`, []string{"name:required"}},
+				{`{"name":"  "}`, []string{"name:trimmed"}},
+				{`{"name":"` + long + `"}`, []string{"name:max_length"}},
+				{`{"address":"` + long + `"}`, []string{"address:max_length"}},
+				{`{"floors":[{"level":1}]}`, []string{"floors[0].label:required"}},
+				{`{"floors":[{"level":1,"label":" "}]}`, []string{"floors[0].label:trimmed"}},
+				{`{"floors":[{"level":1,"label":"a"},{"level":2,"label":"A "}]}`, []string{"floors[1].label:unique"}},
+				{`{"floors":[{"level":1,"label":"a"},{"level":1,"label":"b"}]}`, []string{"floors[1].level:unique"}},
+				{`{"floors":[{"level":1,"label":"a","gross_area":-1}]}`, []string{"floors[0].gross_area:min"}},
+				{`{"floors":[{"level":1,"label":"a","usage_type":"` + long + `"}]}`, []string{"floors[0].usage_type:max_length"}},
+				{`{"floors":[{"level":1,"label":"a","rooms":[{"code":""}]}]}`, []string{"floors[0].rooms[0].code:required"}},
+				{`{"floors":[{"level":1,"label":"a","rooms":[{"code":"r1"},{"code":"R1"}]}]}`, []string{"floors[0].rooms[1].code:unique"}},
+				{`{"floors":[{"level":1,"label":"a","rooms":[{"code":"r1","capacity":-1,"area":-1}]}]}`,
+					[]string{"floors[0].rooms[0].capacity:min", "floors[0].rooms[0].area:min"}},
+			} {
+				_, err := models.NewBuildingPatch(pid, models.ContentTypeMergePatch, []byte(tc.patch)).Patch(store)
+				Expect(fields(err)).To(Equal(tc.want), tc.patch)
+			}
+			_, err = models.NewBuildingPatch(pid, models.ContentTypeJSONPatch,
+				[]byte(`[{"op":"replace","path":"/floors/1/label","value":"LOBBY"}]`)).Patch(store)
+			Expect(fields(err)).To(Equal([]string{"floors[1].label:unique"}))
+			By("Default rules ok")
+
+			pattern := "^[a-z0-9-]+$"
+			Expect(models.OverrideRules(map[string]*models.RuleOverride{"name": {Pattern: &pattern}})).To(BeZero())
+			_, err = models.NewBuildingPatch(pid, models.ContentTypeMergePatch, []byte(`{"name":"Tower 1"}`)).Patch(store)
+			Expect(fields(err)).To(Equal([]string{"name:pattern"}))
+			row, err := models.NewBuildingGetOne(pid).Get(store)
+			Expect(err).To(BeZero())
+			Expect(row.Name).To(Equal("tower-1"))
+			Expect(row.Version).To(Equal(int64(1)))
+			By("Overridden rules ok")
+		})
+	})
+
+	Context("Config overrides", func() {
+
+		It("should tighten and relax the rules", func() {
+			pattern, maxLength, required := "^[a-z0-9-]+$", 5, false
+			err := models.OverrideRules(map[string]*models.RuleOverride{
+				"name":         {Pattern: &pattern, MaxLength: &maxLength},
+				"floors.label": {Required: &required},
+			})
+			Expect(err).To(BeZero())
+			p := params(`{"name":"Tower 01","floors":[""]}`)
+			Expect(fields(p.Validate())).To(Equal([]string{"name:max_length", "name:pattern"}))
+			By("Overrides ok")
+		})
+
+		It("should reject unknown fields and bad patterns", func() {
+			bad := "("
+			Expect(models.OverrideRules(map[string]*models.RuleOverride{"nickname": {}})).To(HaveOccurred())
+			Expect(models.OverrideRules(map[string]*models.RuleOverride{"name": {Pattern: &bad}})).To(HaveOccurred())
+			By("Bad overrides rejected")
+		})
+	})
+})
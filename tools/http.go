@@ -1,6 +1,8 @@
 package tools
 
 import (
+	"bytes"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -8,6 +10,9 @@ import (
 	"time"
 )
 
+// maxPostReply bytes of a POST reply read, the receivers are not trusted
+const maxPostReply = 64 << 10
+
 // HTTPCurl helpers for http requests
 type HTTPCurl struct {
 	HTTPClient *http.Client
@@ -63,3 +68,25 @@ func (g *HTTPCurl) Get(url string) (string, int, error) {
 	// read the body
 	return strings.TrimSpace(string(contents)), resp.StatusCode, nil
 }
+
+// Post request via post with the extra headers, only the start of the reply body is kept
+func (g *HTTPCurl) Post(url string, body []byte, headers map[string]string) (string, int, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return "", -1, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := g.HTTPClient.Do(req)
+	if err != nil {
+		return "", -1, err
+	}
+	defer resp.Body.Close()
+	contents, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPostReply))
+	if err != nil {
+		return "", resp.StatusCode, err
+	}
+	// read the body
+	return strings.TrimSpace(string(contents)), resp.StatusCode, nil
+}
@@ -0,0 +1,377 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level of a log entry
+type Level int
+
+// levels, lowest first
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Redacted the value given in place of a redacted field
+const Redacted = "[REDACTED]"
+
+var (
+	// ErrUnknownLevel level name not one of debug, info, warn, error
+	ErrUnknownLevel = errors.New("unknown log level")
+
+	// DefaultRedact field names never written as is
+	DefaultRedact = []string{"password", "secret", "token", "authorization", "api_key"}
+
+	// Log the process wide logger
+	Log = NewLogger()
+
+	levelNames = []string{"debug", "info", "warn", "error"}
+)
+
+// String name of the level
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return "unknown"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel level by name, empty means info
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return LevelInfo, nil
+	}
+	if s == "warning" {
+		return LevelWarn, nil
+	}
+	for i, name := range levelNames {
+		if name == s {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, ErrUnknownLevel
+}
+
+// Fields the key values of a log entry
+type Fields map[string]interface{}
+
+// Logger json lines logger, 1 object per entry
+type Logger struct {
+	level  *int32
+	out    io.Writer
+	mtx    *sync.Mutex
+	redact map[string]bool
+	fields Fields
+	scope  *LogScope
+}
+
+// LoggerSetup options settings
+type LoggerSetup func(*Logger)
+
+// WithLoggerOptLevel opts for the lowest level written
+func WithLoggerOptLevel(r Level) LoggerSetup {
+	return func(args *Logger) {
+		atomic.StoreInt32(args.level, int32(r))
+	}
+}
+
+// WithLoggerOptOutput opts for the writer
+func WithLoggerOptOutput(r io.Writer) LoggerSetup {
+	return func(args *Logger) {
+		args.out = r
+	}
+}
+
+// WithLoggerOptRedact opts for more field names to redact, on top of DefaultRedact
+func WithLoggerOptRedact(r ...string) LoggerSetup {
+	return func(args *Logger) {
+		for _, name := range r {
+			args.redact[strings.ToLower(name)] = true
+		}
+	}
+}
+
+// NewLogger new instance, info level to stderr
+func NewLogger(opts ...LoggerSetup) *Logger {
+	level := int32(LevelInfo)
+	l := &Logger{
+		level:  &level,
+		out:    os.Stderr,
+		mtx:    new(sync.Mutex),
+		redact: make(map[string]bool),
+	}
+	for _, name := range DefaultRedact {
+		l.redact[name] = true
+	}
+	//add options if any
+	for _, setter := range opts {
+		setter(l)
+	}
+	return l
+}
+
+// SetLogger replace the process wide logger, the standard log package included
+func SetLogger(l *Logger) {
+	Log = l
+	log.SetFlags(0)
+	log.SetOutput(l.Writer(LevelInfo))
+}
+
+// Enabled true when the level is written
+func (l *Logger) Enabled(level Level) bool {
+	return int32(level) >= atomic.LoadInt32(l.level)
+}
+
+// SetLevel change the lowest level written, the child loggers included
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(l.level, int32(level))
+}
+
+// With child logger adding the fields to each entry
+func (l *Logger) With(fields Fields) *Logger {
+	child := *l
+	child.fields = make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		child.fields[k] = v
+	}
+	for k, v := range fields {
+		child.fields[k] = v
+	}
+	return &child
+}
+
+// Scoped child logger adding the fields of the scope as they are at each entry
+func (l *Logger) Scoped(scope *LogScope) *Logger {
+	child := *l
+	child.scope = scope
+	return &child
+}
+
+// Debug log at debug level
+func (l *Logger) Debug(msg string, fields ...Fields) {
+	l.Log(LevelDebug, msg, fields...)
+}
+
+// Info log at info level
+func (l *Logger) Info(msg string, fields ...Fields) {
+	l.Log(LevelInfo, msg, fields...)
+}
+
+// Warn log at warn level
+func (l *Logger) Warn(msg string, fields ...Fields) {
+	l.Log(LevelWarn, msg, fields...)
+}
+
+// Error log at error level
+func (l *Logger) Error(msg string, fields ...Fields) {
+	l.Log(LevelError, msg, fields...)
+}
+
+// Fatal log at error level then exit
+func (l *Logger) Fatal(msg string, fields ...Fields) {
+	l.Log(LevelError, msg, fields...)
+	os.Exit(1)
+}
+
+// Dump debug log of any values, the redacted fields masked
+func (l *Logger) Dump(msg string, infos ...interface{}) {
+	if !l.Enabled(LevelDebug) {
+		return
+	}
+	l.Log(LevelDebug, msg, Fields{"data": infos})
+}
+
+// Log write 1 entry, later fields win over the earlier ones
+func (l *Logger) Log(level Level, msg string, fields ...Fields) {
+	if !l.Enabled(level) {
+		return
+	}
+	all := make(Fields)
+	for k, v := range l.fields {
+		all[k] = v
+	}
+	if l.scope != nil {
+		for k, v := range l.scope.Fields() {
+			all[k] = v
+		}
+	}
+	for _, f := range fields {
+		for k, v := range f {
+			all[k] = v
+		}
+	}
+	delete(all, "time")
+	delete(all, "level")
+	delete(all, "msg")
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeJSON(&buf, time.Now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSON(&buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSON(&buf, msg)
+	var keys []string
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf.WriteByte(',')
+		writeJSON(&buf, k)
+		buf.WriteByte(':')
+		writeJSON(&buf, l.mask(k, all[k]))
+	}
+	buf.WriteString("}\n")
+
+	// ensure
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.out.Write(buf.Bytes())
+}
+
+// mask the value of a field, nested objects are walked
+func (l *Logger) mask(key string, v interface{}) interface{} {
+	if l.redact[strings.ToLower(key)] {
+		return Redacted
+	}
+	switch val := v.(type) {
+	case nil, string, bool, int, int64, float64:
+		return v
+	case error:
+		return val.Error()
+	case fmt.Stringer:
+		return val.String()
+	}
+	//anything else as its json
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	var tree interface{}
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return l.maskTree(tree)
+}
+
+func (l *Logger) maskTree(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if l.redact[strings.ToLower(k)] {
+				val[k] = Redacted
+				continue
+			}
+			val[k] = l.maskTree(child)
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = l.maskTree(child)
+		}
+	}
+	return v
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		raw, _ = json.Marshal(fmt.Sprintf("%+v", v))
+	}
+	buf.Write(raw)
+}
+
+// Writer each line written is 1 entry at the level, for the standard log package
+func (l *Logger) Writer(level Level) io.Writer {
+	return &lineWriter{logger: l, level: level}
+}
+
+// lineWriter entry per line
+type lineWriter struct {
+	logger *Logger
+	level  Level
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			w.logger.Log(w.level, line)
+		}
+	}
+	return len(p), nil
+}
+
+// LogScope fields of 1 request, filled in as it goes
+type LogScope struct {
+	mtx    *sync.Mutex
+	fields Fields
+}
+
+// NewLogScope new scope with the initial fields
+func NewLogScope(fields Fields) *LogScope {
+	scope := &LogScope{mtx: new(sync.Mutex), fields: make(Fields)}
+	for k, v := range fields {
+		scope.fields[k] = v
+	}
+	return scope
+}
+
+// Set add or replace 1 field
+func (s *LogScope) Set(key string, v interface{}) {
+	// ensure
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.fields[key] = v
+}
+
+// Fields copy of the fields
+func (s *LogScope) Fields() Fields {
+	// ensure
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	fields := make(Fields, len(s.fields))
+	for k, v := range s.fields {
+		fields[k] = v
+	}
+	return fields
+}
+
+type logContextKey struct{}
+
+// WithLogger context carrying the logger
+func WithLogger(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, logContextKey{}, l)
+}
+
+// LoggerFrom logger of the context, the process wide one if none
+func LoggerFrom(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(logContextKey{}).(*Logger); ok {
+			return l
+		}
+	}
+	return Log
+}
+
+// SetLogField add a field to each later entry of the context logger
+func SetLogField(ctx context.Context, key string, v interface{}) {
+	if l := LoggerFrom(ctx); l.scope != nil {
+		l.scope.Set(key, v)
+	}
+}
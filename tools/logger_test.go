@@ -0,0 +1,161 @@
+package tools_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/bayugyug/building-custom-api/tools"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::LOGGER", func() {
+
+	//init
+	var buf *bytes.Buffer
+	var logger *tools.Logger
+
+	BeforeEach(func() {
+		buf = new(bytes.Buffer)
+		logger = tools.NewLogger(tools.WithLoggerOptOutput(buf), tools.WithLoggerOptLevel(tools.LevelDebug))
+	})
+
+	entries := func() []map[string]interface{} {
+		var list []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			entry := make(map[string]interface{})
+			Expect(json.Unmarshal([]byte(line), &entry)).To(BeZero(), line)
+			delete(entry, "time")
+			list = append(list, entry)
+		}
+		return list
+	}
+
+	Context("Levels", func() {
+
+		It("should parse the level names", func() {
+			for _, tc := range []struct {
+				in   string
+				want tools.Level
+				err  error
+			}{
+				{"", tools.LevelInfo, nil},
+				{"debug", tools.LevelDebug, nil},
+				{" INFO ", tools.LevelInfo, nil},
+				{"warn", tools.LevelWarn, nil},
+				{"warning", tools.LevelWarn, nil},
+				{"Error", tools.LevelError, nil},
+				{"trace", tools.LevelInfo, tools.ErrUnknownLevel},
+			} {
+				level, err := tools.ParseLevel(tc.in)
+				Expect(level).To(Equal(tc.want), tc.in)
+				if tc.err == nil {
+					Expect(err).To(BeZero(), tc.in)
+					continue
+				}
+				Expect(err).To(Equal(tc.err), tc.in)
+			}
+			Expect(tools.Level(9).String()).To(Equal("unknown"))
+			By("Level names ok")
+		})
+
+		It("should drop the entries below the level, the child loggers included", func() {
+			child := logger.With(tools.Fields{"svc": "api"})
+			logger.SetLevel(tools.LevelWarn)
+			for _, tc := range []struct {
+				level   tools.Level
+				enabled bool
+			}{
+				{tools.LevelDebug, false},
+				{tools.LevelInfo, false},
+				{tools.LevelWarn, true},
+				{tools.LevelError, true},
+			} {
+				Expect(child.Enabled(tc.level)).To(Equal(tc.enabled), tc.level.String())
+				child.Log(tc.level, tc.level.String())
+			}
+			Expect(entries()).To(Equal([]map[string]interface{}{
+				{"level": "warn", "msg": "warn", "svc": "api"},
+				{"level": "error", "msg": "error", "svc": "api"},
+			}))
+			By("Level filter ok")
+		})
+	})
+
+	Context("Fields", func() {
+
+		It("should merge the fields, later ones winning", func() {
+			scope := tools.NewLogScope(tools.Fields{"request_id": "r1", "svc": "scope"})
+			l := logger.With(tools.Fields{"svc": "with", "user": "u1"}).Scoped(scope)
+			scope.Set("status", 200)
+			l.Info("done", tools.Fields{"user": "u2", "level": "x", "msg": "y", "time": "z"})
+			Expect(entries()).To(Equal([]map[string]interface{}{
+				{"level": "info", "msg": "done", "request_id": "r1", "status": float64(200), "svc": "scope", "user": "u2"},
+			}))
+			By("Merged fields ok")
+		})
+
+		It("should redact the sensitive fields", func() {
+			l := tools.NewLogger(tools.WithLoggerOptOutput(buf), tools.WithLoggerOptRedact("Card"))
+			for _, tc := range []struct {
+				name   string
+				fields tools.Fields
+				want   map[string]interface{}
+			}{
+				{"top level", tools.Fields{"Password": "p", "user": "u"},
+					map[string]interface{}{"Password": tools.Redacted, "user": "u"}},
+				{"extra names", tools.Fields{"card": "4111"},
+					map[string]interface{}{"card": tools.Redacted}},
+				{"nested", tools.Fields{"body": map[string]interface{}{"auth": map[string]string{"token": "t", "kind": "bearer"}}},
+					map[string]interface{}{"body": map[string]interface{}{"auth": map[string]interface{}{"token": tools.Redacted, "kind": "bearer"}}}},
+				{"in arrays", tools.Fields{"list": []map[string]string{{"secret": "s"}}},
+					map[string]interface{}{"list": []interface{}{map[string]interface{}{"secret": tools.Redacted}}}},
+				{"errors as text", tools.Fields{"err": errors.New("boom")},
+					map[string]interface{}{"err": "boom"}},
+			} {
+				buf.Reset()
+				l.Info(tc.name, tc.fields)
+				got := entries()
+				Expect(got).To(HaveLen(1), tc.name)
+				delete(got[0], "level")
+				delete(got[0], "msg")
+				Expect(got[0]).To(Equal(tc.want), tc.name)
+			}
+			By("Redacted fields ok")
+		})
+	})
+
+	Context("Writers", func() {
+
+		It("should log each line of the writer", func() {
+			w := logger.Writer(tools.LevelWarn)
+			n, err := w.Write([]byte("first\n\n  second  \n"))
+			Expect(err).To(BeZero())
+			Expect(n).To(Equal(18))
+			Expect(entries()).To(Equal([]map[string]interface{}{
+				{"level": "warn", "msg": "first"},
+				{"level": "warn", "msg": "second"},
+			}))
+			By("Line writer ok")
+		})
+
+		It("should carry the logger in the context", func() {
+			Expect(tools.LoggerFrom(context.Background())).To(BeIdenticalTo(tools.Log))
+			scope := tools.NewLogScope(nil)
+			ctx := tools.WithLogger(context.Background(), logger.Scoped(scope))
+			tools.SetLogField(ctx, "building_id", "b1")
+			tools.LoggerFrom(ctx).Debug("hit")
+			Expect(entries()).To(Equal([]map[string]interface{}{
+				{"level": "debug", "msg": "hit", "building_id": "b1"},
+			}))
+			By("Context logger ok")
+		})
+	})
+})
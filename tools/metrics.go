@@ -0,0 +1,375 @@
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric types of the text exposition format
+const (
+	MetricCounter   = "counter"
+	MetricGauge     = "gauge"
+	MetricHistogram = "histogram"
+)
+
+// DefBuckets latency buckets in seconds, http sized
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Sample 1 value given by a collector on each scrape
+type Sample struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Metrics registry of the metric families, rendered in the prometheus text format
+type Metrics struct {
+	mtx        *sync.Mutex
+	families   map[string]family
+	collectors []func() []Sample
+}
+
+// family 1 named metric and its series
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// NewMetrics new registry
+func NewMetrics() *Metrics {
+	return &Metrics{
+		mtx:      new(sync.Mutex),
+		families: make(map[string]family),
+	}
+}
+
+// Counter register a counter, the same name gives back the same counter
+func (m *Metrics) Counter(name, help string, labels ...string) *CounterVec {
+	// ensure
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if c, ok := m.families[name].(*CounterVec); ok {
+		return c
+	}
+	c := &CounterVec{vec: newVec(name, help, labels)}
+	m.families[name] = c
+	return c
+}
+
+// Histogram register a histogram, nil buckets means DefBuckets
+func (m *Metrics) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	// ensure
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if h, ok := m.families[name].(*HistogramVec); ok {
+		return h
+	}
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	bounds := append([]float64{}, buckets...)
+	sort.Float64s(bounds)
+	h := &HistogramVec{vec: newVec(name, help, labels), buckets: bounds}
+	m.families[name] = h
+	return h
+}
+
+// Gauge register a gauge read on each scrape
+func (m *Metrics) Gauge(name, help string, fn func() float64) {
+	m.Collect(func() []Sample {
+		return []Sample{{Name: name, Help: help, Type: MetricGauge, Value: fn()}}
+	})
+}
+
+// Collect register a func giving its samples on each scrape
+func (m *Metrics) Collect(fn func() []Sample) {
+	// ensure
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.collectors = append(m.collectors, fn)
+}
+
+// WriteTo render all metrics in the text exposition format
+func (m *Metrics) WriteTo(out io.Writer) (int64, error) {
+	m.mtx.Lock()
+	families := make(map[string]family, len(m.families))
+	for name, f := range m.families {
+		families[name] = f
+	}
+	collectors := append([]func() []Sample{}, m.collectors...)
+	m.mtx.Unlock()
+
+	//collected samples are grouped by name
+	for _, fn := range collectors {
+		for _, s := range fn() {
+			g, ok := families[s.Name].(*sampleGroup)
+			if !ok {
+				g = &sampleGroup{name: s.Name, help: s.Help, kind: s.Type}
+				families[s.Name] = g
+			}
+			g.samples = append(g.samples, s)
+		}
+	}
+	var names []string
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := &countWriter{w: out}
+	w := bufio.NewWriter(cw)
+	for _, name := range names {
+		families[name].write(w)
+	}
+	err := w.Flush()
+	return cw.n, err
+}
+
+// vec series of 1 family keyed by the label values
+type vec struct {
+	name   string
+	help   string
+	labels []string
+	mtx    *sync.Mutex
+	series map[string][]string
+}
+
+func newVec(name, help string, labels []string) vec {
+	return vec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		mtx:    new(sync.Mutex),
+		series: make(map[string][]string),
+	}
+}
+
+// key of the label values, missing values are blank
+func (v *vec) key(values []string) string {
+	vals := make([]string, len(v.labels))
+	copy(vals, values)
+	return strings.Join(vals, "\xff")
+}
+
+// add key of the label values, the series is kept for the output
+func (v *vec) add(values []string) string {
+	key := v.key(values)
+	if _, ok := v.series[key]; !ok {
+		vals := make([]string, len(v.labels))
+		copy(vals, values)
+		v.series[key] = vals
+	}
+	return key
+}
+
+// sortedKeys keys in a stable order
+func (v *vec) sortedKeys() []string {
+	var keys []string
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec counter per label values
+type CounterVec struct {
+	vec
+	values map[string]float64
+}
+
+// Inc add 1
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add add v, a counter never goes down so negatives are dropped
+func (c *CounterVec) Add(v float64, values ...string) {
+	if v < 0 {
+		return
+	}
+	// ensure
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.values == nil {
+		c.values = make(map[string]float64)
+	}
+	c.values[c.add(values)] += v
+}
+
+// Value current value of the label values
+func (c *CounterVec) Value(values ...string) float64 {
+	// ensure
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.values[c.key(values)]
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	writeHeader(w, c.name, c.help, MetricCounter)
+	for _, key := range c.sortedKeys() {
+		writeSample(w, c.name, c.labels, c.series[key], nil, c.values[key])
+	}
+}
+
+// HistogramVec histogram per label values
+type HistogramVec struct {
+	vec
+	buckets []float64
+	values  map[string]*histogram
+}
+
+// histogram counts per upper bound, not cumulative
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe add 1 value
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	// ensure
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.values == nil {
+		h.values = make(map[string]*histogram)
+	}
+	key := h.add(values)
+	row, ok := h.values[key]
+	if !ok {
+		row = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = row
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		row.counts[i]++
+	}
+	row.count++
+	row.sum += v
+}
+
+// Count number of values observed for the label values
+func (h *HistogramVec) Count(values ...string) uint64 {
+	// ensure
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if row, ok := h.values[h.key(values)]; ok {
+		return row.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	writeHeader(w, h.name, h.help, MetricHistogram)
+	labels := append(append([]string{}, h.labels...), "le")
+	for _, key := range h.sortedKeys() {
+		row, ok := h.values[key]
+		if !ok {
+			continue
+		}
+		vals := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += row.counts[i]
+			writeSample(w, h.name+"_bucket", labels, vals, []string{formatFloat(bound)}, float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", labels, vals, []string{"+Inf"}, float64(row.count))
+		writeSample(w, h.name+"_sum", h.labels, vals, nil, row.sum)
+		writeSample(w, h.name+"_count", h.labels, vals, nil, float64(row.count))
+	}
+}
+
+// sampleGroup samples of 1 name given by the collectors
+type sampleGroup struct {
+	name    string
+	help    string
+	kind    string
+	samples []Sample
+}
+
+func (g *sampleGroup) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, g.kind)
+	for _, s := range g.samples {
+		var labels, vals []string
+		for k := range s.Labels {
+			labels = append(labels, k)
+		}
+		sort.Strings(labels)
+		for _, k := range labels {
+			vals = append(vals, s.Labels[k])
+		}
+		writeSample(w, g.name, labels, vals, nil, s.Value)
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	if help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(help))
+	}
+	if kind == "" {
+		kind = "untyped"
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func writeSample(w *bufio.Writer, name string, labels, vals, extra []string, v float64) {
+	w.WriteString(name)
+	vals = append(append([]string{}, vals...), extra...)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label)
+			w.WriteString(`="`)
+			if i < len(vals) {
+				w.WriteString(labelEscaper.Replace(vals[i]))
+			}
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countWriter bytes written for WriteTo
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
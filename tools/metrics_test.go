@@ -0,0 +1,132 @@
+package tools_test
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/bayugyug/building-custom-api/tools"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::METRICS", func() {
+
+	render := func(m *tools.Metrics) string {
+		var buf bytes.Buffer
+		n, err := m.WriteTo(&buf)
+		Expect(err).To(BeZero())
+		Expect(n).To(Equal(int64(buf.Len())))
+		return buf.String()
+	}
+
+	Context("Text format", func() {
+
+		It("should render each metric type", func() {
+			for _, tc := range []struct {
+				name  string
+				setup func(m *tools.Metrics)
+				want  string
+			}{
+				{
+					name:  "empty registry",
+					setup: func(m *tools.Metrics) {},
+					want:  "",
+				},
+				{
+					name: "counter per label values",
+					setup: func(m *tools.Metrics) {
+						c := m.Counter("http_requests_total", "Requests served.", "method", "code")
+						c.Inc("GET", "200")
+						c.Add(2, "POST", "201")
+						c.Add(-5, "POST", "201")
+						c.Inc("GET", "200")
+					},
+					want: "# HELP http_requests_total Requests served.\n" +
+						"# TYPE http_requests_total counter\n" +
+						"http_requests_total{method=\"GET\",code=\"200\"} 2\n" +
+						"http_requests_total{method=\"POST\",code=\"201\"} 2\n",
+				},
+				{
+					name: "missing label values are blank",
+					setup: func(m *tools.Metrics) {
+						m.Counter("errors_total", "", "kind").Inc()
+					},
+					want: "# TYPE errors_total counter\n" +
+						"errors_total{kind=\"\"} 1\n",
+				},
+				{
+					name: "histogram buckets are cumulative",
+					setup: func(m *tools.Metrics) {
+						h := m.Histogram("latency_seconds", "Latency.", []float64{1, 0.5}, "path")
+						h.Observe(0.2, "/a")
+						h.Observe(0.7, "/a")
+						h.Observe(3, "/a")
+					},
+					want: "# HELP latency_seconds Latency.\n" +
+						"# TYPE latency_seconds histogram\n" +
+						"latency_seconds_bucket{path=\"/a\",le=\"0.5\"} 1\n" +
+						"latency_seconds_bucket{path=\"/a\",le=\"1\"} 2\n" +
+						"latency_seconds_bucket{path=\"/a\",le=\"+Inf\"} 3\n" +
+						"latency_seconds_sum{path=\"/a\"} 3.9\n" +
+						"latency_seconds_count{path=\"/a\"} 3\n",
+				},
+				{
+					name: "gauge and collected samples",
+					setup: func(m *tools.Metrics) {
+						m.Gauge("up", "Up.", func() float64 { return 1 })
+						m.Collect(func() []tools.Sample {
+							return []tools.Sample{
+								{Name: "rows", Type: tools.MetricGauge, Labels: map[string]string{"z": "1", "a": "2"}, Value: math.Inf(1)},
+								{Name: "raw", Value: math.NaN()},
+							}
+						})
+					},
+					want: "# TYPE raw untyped\n" +
+						"raw NaN\n" +
+						"# TYPE rows gauge\n" +
+						"rows{a=\"2\",z=\"1\"} +Inf\n" +
+						"# HELP up Up.\n" +
+						"# TYPE up gauge\n" +
+						"up 1\n",
+				},
+				{
+					name: "help and label values are escaped",
+					setup: func(m *tools.Metrics) {
+						m.Counter("odd_total", "a \\ b\nc", "v").Inc("say \"hi\"\n")
+					},
+					want: "# HELP odd_total a \\\\ b\\nc\n" +
+						"# TYPE odd_total counter\n" +
+						"odd_total{v=\"say \\\"hi\\\"\\n\"} 1\n",
+				},
+			} {
+				m := tools.NewMetrics()
+				tc.setup(m)
+				Expect(render(m)).To(Equal(tc.want), tc.name)
+			}
+			By("Text format ok")
+		})
+	})
+
+	Context("Registry", func() {
+
+		It("should give back the same metric for the same name", func() {
+			m := tools.NewMetrics()
+			c := m.Counter("hits_total", "Hits.", "path")
+			Expect(m.Counter("hits_total", "Other.", "path")).To(BeIdenticalTo(c))
+			c.Inc("/a")
+			c.Inc("/a")
+			Expect(c.Value("/a")).To(Equal(float64(2)))
+			Expect(c.Value("/b")).To(BeZero())
+			By("Same counter ok")
+
+			h := m.Histogram("size_bytes", "Size.", nil)
+			Expect(m.Histogram("size_bytes", "", nil)).To(BeIdenticalTo(h))
+			Expect(h.Count()).To(BeZero())
+			h.Observe(5)
+			Expect(h.Count()).To(Equal(uint64(1)))
+			Expect(render(m)).To(ContainSubstring("size_bytes_bucket{le=\"2.5\"} 0\nsize_bytes_bucket{le=\"5\"} 1\n"))
+			By("Same histogram with the default buckets ok")
+		})
+	})
+})
@@ -0,0 +1,283 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrPatchInvalid patch document cannot be applied
+	ErrPatchInvalid = errors.New("invalid patch document")
+	// ErrPatchTestFailed a test operation did not match
+	ErrPatchTestFailed = errors.New("patch test failed")
+)
+
+// patchOperation 1 operation of a JSON Patch document
+type patchOperation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// MergePatch apply a JSON Merge Patch (RFC 7396) to the document
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, merge interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &merge); err != nil {
+		return nil, ErrPatchInvalid
+	}
+	return json.Marshal(mergeValue(target, merge))
+}
+
+// mergeValue recursive merge of the patch into the target
+func mergeValue(target, patch interface{}) interface{} {
+	obj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	base, ok := target.(map[string]interface{})
+	if !ok {
+		base = make(map[string]interface{})
+	}
+	for k, v := range obj {
+		if v == nil {
+			delete(base, k)
+			continue
+		}
+		base[k] = mergeValue(base[k], v)
+	}
+	return base
+}
+
+// JSONPatch apply a JSON Patch (RFC 6902) to the document, all or nothing
+func JSONPatch(doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	var ops []patchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, ErrPatchInvalid
+	}
+	var err error
+	for _, op := range ops {
+		if target, err = applyOperation(target, op); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(target)
+}
+
+// applyOperation run 1 operation against the document
+func applyOperation(doc interface{}, op patchOperation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, ErrPatchInvalid
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, ErrPatchInvalid
+		}
+		if err := json.Unmarshal(*op.Value, &value); err != nil {
+			return nil, ErrPatchInvalid
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return nil, ErrPatchInvalid
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = pointerGet(doc, from); err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(*op.Path+"/", *op.From+"/") && *op.Path != *op.From {
+				return nil, ErrPatchInvalid
+			}
+			if doc, err = pointerRemove(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = deepCopy(value)
+		}
+	}
+	switch op.Op {
+	case "add", "move", "copy":
+		return pointerAdd(doc, path, value)
+	case "remove":
+		return pointerRemove(doc, path)
+	case "replace":
+		//the whole document, nothing to remove first
+		if len(path) == 0 {
+			return value, nil
+		}
+		if _, err := pointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		if doc, err = pointerRemove(doc, path); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	case "test":
+		current, err := pointerGet(doc, path)
+		if err != nil || !reflect.DeepEqual(current, value) {
+			return nil, ErrPatchTestFailed
+		}
+		return doc, nil
+	}
+	return nil, ErrPatchInvalid
+}
+
+// parsePointer split a JSON Pointer (RFC 6901) into unescaped tokens
+func parsePointer(s string) ([]string, error) {
+	if s == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return nil, ErrPatchInvalid
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// arrayIndex position in the array, "-" or len allowed only when adding
+func arrayIndex(token string, size int, adding bool) (int, error) {
+	if adding && token == "-" {
+		return size, nil
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, ErrPatchInvalid
+	}
+	if idx > size || (!adding && idx == size) {
+		return 0, ErrPatchInvalid
+	}
+	return idx, nil
+}
+
+// pointerGet value at the path
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, ErrPatchInvalid
+			}
+			doc = v
+		case []interface{}:
+			idx, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[idx]
+		default:
+			return nil, ErrPatchInvalid
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd insert or set the value at the path, returning the new document
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		idx, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node, nil)
+		copy(node[idx+1:], node[idx:])
+		node[idx] = value
+		return pointerSet(doc, path[:len(path)-1], node)
+	}
+	return nil, ErrPatchInvalid
+}
+
+// pointerRemove drop the value at the path, returning the new document
+func pointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, ErrPatchInvalid
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := node[last]; !ok {
+			return nil, ErrPatchInvalid
+		}
+		delete(node, last)
+		return doc, nil
+	case []interface{}:
+		idx, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node[:idx:idx], node[idx+1:]...)
+		return pointerSet(doc, path[:len(path)-1], node)
+	}
+	return nil, ErrPatchInvalid
+}
+
+// pointerSet replace the container at the path, arrays change identity on resize
+func pointerSet(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		idx, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[idx] = value
+	default:
+		return nil, ErrPatchInvalid
+	}
+	return doc, nil
+}
+
+// deepCopy clone a decoded json value
+func deepCopy(v interface{}) interface{} {
+	raw, _ := json.Marshal(v)
+	var out interface{}
+	json.Unmarshal(raw, &out)
+	return out
+}
@@ -0,0 +1,100 @@
+package tools_test
+
+import (
+	"github.com/bayugyug/building-custom-api/tools"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// patchCase 1 patch document against a document with the expected result or error
+type patchCase struct {
+	name  string
+	doc   string
+	patch string
+	want  string
+	err   error
+}
+
+var _ = Describe("REST Building API Service::PATCH", func() {
+
+	Context("JSON Patch", func() {
+
+		It("should apply the operations", func() {
+			for _, tc := range []patchCase{
+				{name: "add member", doc: `{"a":1}`, patch: `[{"op":"add","path":"/b","value":2}]`, want: `{"a":1,"b":2}`},
+				{name: "add replaces member", doc: `{"a":1}`, patch: `[{"op":"add","path":"/a","value":[1]}]`, want: `{"a":[1]}`},
+				{name: "add in array", doc: `{"a":[1,3]}`, patch: `[{"op":"add","path":"/a/1","value":2}]`, want: `{"a":[1,2,3]}`},
+				{name: "append with -", doc: `{"a":[1]}`, patch: `[{"op":"add","path":"/a/-","value":2}]`, want: `{"a":[1,2]}`},
+				{name: "add whole document", doc: `{"a":1}`, patch: `[{"op":"add","path":"","value":{"b":2}}]`, want: `{"b":2}`},
+				{name: "remove member", doc: `{"a":1,"b":2}`, patch: `[{"op":"remove","path":"/a"}]`, want: `{"b":2}`},
+				{name: "remove in array", doc: `{"a":[1,2,3]}`, patch: `[{"op":"remove","path":"/a/0"}]`, want: `{"a":[2,3]}`},
+				{name: "replace", doc: `{"a":{"b":1}}`, patch: `[{"op":"replace","path":"/a/b","value":"x"}]`, want: `{"a":{"b":"x"}}`},
+				{name: "replace whole document", doc: `{"a":1}`, patch: `[{"op":"replace","path":"","value":[1,2]}]`, want: `[1,2]`},
+				{name: "move member", doc: `{"a":{"b":1},"c":{}}`, patch: `[{"op":"move","from":"/a/b","path":"/c/d"}]`, want: `{"a":{},"c":{"d":1}}`},
+				{name: "move in array", doc: `{"a":[1,2,3]}`, patch: `[{"op":"move","from":"/a/0","path":"/a/-"}]`, want: `{"a":[2,3,1]}`},
+				{name: "copy is a deep copy", doc: `{"a":{"b":[1]}}`,
+					patch: `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/-","value":2}]`,
+					want:  `{"a":{"b":[1]},"c":{"b":[1,2]}}`},
+				{name: "test then replace", doc: `{"a":[1,{"b":true}]}`,
+					patch: `[{"op":"test","path":"/a/1","value":{"b":true}},{"op":"replace","path":"/a/0","value":0}]`,
+					want:  `{"a":[0,{"b":true}]}`},
+				{name: "escaped ~1 is a slash", doc: `{"a/b":1}`, patch: `[{"op":"replace","path":"/a~1b","value":2}]`, want: `{"a/b":2}`},
+				{name: "escaped ~0 is a tilde", doc: `{"m~n":1}`, patch: `[{"op":"remove","path":"/m~0n"}]`, want: `{}`},
+				{name: "~01 unescapes to ~1", doc: `{"~1":1,"/":2}`, patch: `[{"op":"remove","path":"/~01"}]`, want: `{"/":2}`},
+			} {
+				got, err := tools.JSONPatch([]byte(tc.doc), []byte(tc.patch))
+				Expect(err).NotTo(HaveOccurred(), tc.name)
+				Expect(got).To(MatchJSON(tc.want), tc.name)
+			}
+			By("Operations ok")
+		})
+
+		It("should refuse the bad operations and keep nothing", func() {
+			for _, tc := range []patchCase{
+				{name: "test mismatch", doc: `{"a":1}`, patch: `[{"op":"test","path":"/a","value":2}]`, err: tools.ErrPatchTestFailed},
+				{name: "test missing path", doc: `{"a":1}`, patch: `[{"op":"test","path":"/b","value":1}]`, err: tools.ErrPatchTestFailed},
+				{name: "failed test undoes earlier ops", doc: `{"a":1}`,
+					patch: `[{"op":"add","path":"/b","value":2},{"op":"test","path":"/a","value":0}]`, err: tools.ErrPatchTestFailed},
+				{name: "unknown op", doc: `{}`, patch: `[{"op":"swap","path":"/a"}]`, err: tools.ErrPatchInvalid},
+				{name: "no path", doc: `{}`, patch: `[{"op":"add","value":1}]`, err: tools.ErrPatchInvalid},
+				{name: "no value", doc: `{}`, patch: `[{"op":"add","path":"/a"}]`, err: tools.ErrPatchInvalid},
+				{name: "no from", doc: `{"a":1}`, patch: `[{"op":"copy","path":"/b"}]`, err: tools.ErrPatchInvalid},
+				{name: "relative pointer", doc: `{"a":1}`, patch: `[{"op":"remove","path":"a"}]`, err: tools.ErrPatchInvalid},
+				{name: "remove missing", doc: `{"a":1}`, patch: `[{"op":"remove","path":"/b"}]`, err: tools.ErrPatchInvalid},
+				{name: "replace missing", doc: `{"a":1}`, patch: `[{"op":"replace","path":"/b","value":1}]`, err: tools.ErrPatchInvalid},
+				{name: "- only when adding", doc: `{"a":[1]}`, patch: `[{"op":"remove","path":"/a/-"}]`, err: tools.ErrPatchInvalid},
+				{name: "index past the end", doc: `{"a":[1]}`, patch: `[{"op":"add","path":"/a/2","value":1}]`, err: tools.ErrPatchInvalid},
+				{name: "leading zero index", doc: `{"a":[1,2]}`, patch: `[{"op":"remove","path":"/a/01"}]`, err: tools.ErrPatchInvalid},
+				{name: "move into itself", doc: `{"a":{"b":{}}}`, patch: `[{"op":"move","from":"/a","path":"/a/b/c"}]`, err: tools.ErrPatchInvalid},
+				{name: "not an array", doc: `{}`, patch: `{"op":"add"}`, err: tools.ErrPatchInvalid},
+			} {
+				got, err := tools.JSONPatch([]byte(tc.doc), []byte(tc.patch))
+				Expect(err).To(Equal(tc.err), tc.name)
+				Expect(got).To(BeNil(), tc.name)
+			}
+			By("Bad operations as expected")
+		})
+	})
+
+	Context("Merge Patch", func() {
+
+		It("should merge the objects and drop the nulls", func() {
+			for _, tc := range []patchCase{
+				{name: "set member", doc: `{"a":1}`, patch: `{"b":2}`, want: `{"a":1,"b":2}`},
+				{name: "null removes", doc: `{"a":1,"b":2}`, patch: `{"a":null}`, want: `{"b":2}`},
+				{name: "nested merge", doc: `{"a":{"b":1,"c":2}}`, patch: `{"a":{"c":null,"d":3}}`, want: `{"a":{"b":1,"d":3}}`},
+				{name: "arrays are replaced", doc: `{"a":[1,2]}`, patch: `{"a":[3]}`, want: `{"a":[3]}`},
+				{name: "object over scalar", doc: `{"a":1}`, patch: `{"a":{"b":null,"c":1}}`, want: `{"a":{"c":1}}`},
+				{name: "non object replaces all", doc: `{"a":1}`, patch: `["x"]`, want: `["x"]`},
+			} {
+				got, err := tools.MergePatch([]byte(tc.doc), []byte(tc.patch))
+				Expect(err).NotTo(HaveOccurred(), tc.name)
+				Expect(got).To(MatchJSON(tc.want), tc.name)
+			}
+			_, err := tools.MergePatch([]byte(`{}`), []byte(`{`))
+			Expect(err).To(Equal(tools.ErrPatchInvalid))
+			By("Merge ok")
+		})
+	})
+})
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLimiterKeys clients tracked at most, the least recently seen is dropped past it
+	DefaultLimiterKeys = 10000
+	// DefaultLimiterIdle clients not seen for this long are dropped
+	DefaultLimiterIdle = 10 * time.Minute
+)
+
+// Limiter token bucket per key, bounded in keys and dropping the idle ones
+type Limiter struct {
+	rate    float64
+	burst   float64
+	maxKeys int
+	idle    time.Duration
+	now     func() time.Time
+	mtx     *sync.Mutex
+	lru     *list.List
+	buckets map[string]*list.Element
+}
+
+// bucket tokens of 1 key as of seen
+type bucket struct {
+	key    string
+	tokens float64
+	seen   time.Time
+}
+
+// LimitResult outcome of 1 take
+type LimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// LimiterSetup options settings
+type LimiterSetup func(*Limiter)
+
+// WithLimiterOptMaxKeys opts for the keys tracked at most
+func WithLimiterOptMaxKeys(r int) LimiterSetup {
+	return func(args *Limiter) {
+		if r > 0 {
+			args.maxKeys = r
+		}
+	}
+}
+
+// WithLimiterOptIdle opts for the time after which an unseen key is dropped
+func WithLimiterOptIdle(r time.Duration) LimiterSetup {
+	return func(args *Limiter) {
+		if r > 0 {
+			args.idle = r
+		}
+	}
+}
+
+// WithLimiterOptClock opts for the time source, for tests
+func WithLimiterOptClock(r func() time.Time) LimiterSetup {
+	return func(args *Limiter) {
+		args.now = r
+	}
+}
+
+// NewLimiter new instance, up to requests at once refilled at requests per period
+func NewLimiter(requests int, per time.Duration, opts ...LimiterSetup) *Limiter {
+	if per <= 0 {
+		per = time.Second
+	}
+	l := &Limiter{
+		rate:    float64(requests) / per.Seconds(),
+		burst:   float64(requests),
+		maxKeys: DefaultLimiterKeys,
+		idle:    DefaultLimiterIdle,
+		now:     time.Now,
+		mtx:     new(sync.Mutex),
+		lru:     list.New(),
+		buckets: make(map[string]*list.Element),
+	}
+	//add options if any
+	for _, setter := range opts {
+		setter(l)
+	}
+	return l
+}
+
+// Allow take 1 token of the key
+func (l *Limiter) Allow(key string) LimitResult {
+	return l.take(key, 1)
+}
+
+// Peek whether the key has a token left, without taking it
+func (l *Limiter) Peek(key string) LimitResult {
+	return l.take(key, 0)
+}
+
+// take refill the bucket of the key then take n tokens if there is 1 left
+func (l *Limiter) take(key string, n float64) LimitResult {
+	// ensure
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	now := l.now()
+	l.evict(now)
+	var b *bucket
+	if el, ok := l.buckets[key]; ok {
+		b = el.Value.(*bucket)
+		b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.seen).Seconds()*l.rate)
+		b.seen = now
+		l.lru.MoveToFront(el)
+	} else {
+		b = &bucket{key: key, tokens: l.burst, seen: now}
+		l.buckets[key] = l.lru.PushFront(b)
+		if l.lru.Len() > l.maxKeys {
+			l.drop(l.lru.Back())
+		}
+	}
+
+	result := LimitResult{Limit: int(l.burst)}
+	if b.tokens >= 1 {
+		b.tokens -= n
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.wait(1 - b.tokens)
+	}
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = l.wait(l.burst - b.tokens)
+	return result
+}
+
+// Len keys tracked now
+func (l *Limiter) Len() int {
+	// ensure
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.lru.Len()
+}
+
+// evict drop the keys idle for too long, the oldest are at the back
+func (l *Limiter) evict(now time.Time) {
+	for el := l.lru.Back(); el != nil; el = l.lru.Back() {
+		if now.Sub(el.Value.(*bucket).seen) < l.idle {
+			return
+		}
+		l.drop(el)
+	}
+}
+
+func (l *Limiter) drop(el *list.Element) {
+	delete(l.buckets, el.Value.(*bucket).key)
+	l.lru.Remove(el)
+}
+
+// wait time to refill the tokens
+func (l *Limiter) wait(tokens float64) time.Duration {
+	if tokens <= 0 || l.rate <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
@@ -0,0 +1,109 @@
+package tools_test
+
+import (
+	"time"
+
+	"github.com/bayugyug/building-custom-api/tools"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("REST Building API Service::RATE LIMIT", func() {
+
+	//init
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	})
+
+	clock := tools.WithLimiterOptClock(func() time.Time {
+		return now
+	})
+
+	Context("Token bucket", func() {
+
+		It("should refill the tokens over time up to the burst", func() {
+			l := tools.NewLimiter(2, time.Second, clock)
+			for i, tc := range []struct {
+				advance time.Duration
+				key     string
+				want    tools.LimitResult
+			}{
+				{0, "a", tools.LimitResult{Allowed: true, Limit: 2, Remaining: 1, Reset: 500 * time.Millisecond}},
+				{0, "a", tools.LimitResult{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Second}},
+				{0, "a", tools.LimitResult{Limit: 2, Remaining: 0, Reset: time.Second, RetryAfter: 500 * time.Millisecond}},
+				{250 * time.Millisecond, "a", tools.LimitResult{Limit: 2, Remaining: 0, Reset: 750 * time.Millisecond, RetryAfter: 250 * time.Millisecond}},
+				{250 * time.Millisecond, "a", tools.LimitResult{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Second}},
+				{0, "b", tools.LimitResult{Allowed: true, Limit: 2, Remaining: 1, Reset: 500 * time.Millisecond}},
+				{time.Minute, "a", tools.LimitResult{Allowed: true, Limit: 2, Remaining: 1, Reset: 500 * time.Millisecond}},
+			} {
+				now = now.Add(tc.advance)
+				Expect(l.Allow(tc.key)).To(Equal(tc.want), "step %d", i)
+			}
+			By("Refill ok")
+		})
+
+		It("should peek without taking a token", func() {
+			l := tools.NewLimiter(1, time.Second, clock)
+			Expect(l.Peek("a")).To(Equal(tools.LimitResult{Allowed: true, Limit: 1, Remaining: 1}))
+			Expect(l.Allow("a").Allowed).To(BeTrue())
+			Expect(l.Peek("a")).To(Equal(tools.LimitResult{Limit: 1, Remaining: 0, Reset: time.Second, RetryAfter: time.Second}))
+			By("Peek ok")
+		})
+
+		It("should never allow with a zero rate", func() {
+			l := tools.NewLimiter(0, time.Second, clock)
+			Expect(l.Allow("a")).To(Equal(tools.LimitResult{}))
+			By("Zero rate ok")
+		})
+	})
+
+	Context("Eviction", func() {
+
+		It("should drop the least recently seen key past the max keys", func() {
+			l := tools.NewLimiter(1, time.Hour, clock, tools.WithLimiterOptMaxKeys(2))
+			for i, tc := range []struct {
+				key     string
+				allowed bool
+				size    int
+			}{
+				{"a", true, 1},
+				{"b", true, 2},
+				{"a", false, 2},
+				{"c", true, 2},
+				{"a", false, 2},
+				{"b", true, 2},
+				{"a", false, 2},
+				{"c", true, 2},
+			} {
+				Expect(l.Allow(tc.key).Allowed).To(Equal(tc.allowed), "step %d", i)
+				Expect(l.Len()).To(Equal(tc.size), "step %d", i)
+			}
+			By("Max keys ok")
+		})
+
+		It("should drop the keys idle for too long", func() {
+			l := tools.NewLimiter(1, time.Hour, clock, tools.WithLimiterOptIdle(time.Minute))
+			for i, tc := range []struct {
+				advance time.Duration
+				key     string
+				allowed bool
+				size    int
+			}{
+				{0, "a", true, 1},
+				{30 * time.Second, "b", true, 2},
+				{30 * time.Second, "c", true, 2},
+				{0, "b", false, 2},
+				{0, "a", true, 3},
+				{time.Minute, "d", true, 1},
+			} {
+				now = now.Add(tc.advance)
+				Expect(l.Allow(tc.key).Allowed).To(Equal(tc.allowed), "step %d", i)
+				Expect(l.Len()).To(Equal(tc.size), "step %d", i)
+			}
+			By("Idle keys ok")
+		})
+	})
+})
@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// SchemaRegistry OpenAPI schemas of Go types, named structs are kept as components
+type SchemaRegistry struct {
+	Schemas map[string]map[string]interface{}
+}
+
+// NewSchemaRegistry new instance
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		Schemas: make(map[string]map[string]interface{}),
+	}
+}
+
+// Ref schema of the value, a reference if it is a named struct
+func (s *SchemaRegistry) Ref(v interface{}) map[string]interface{} {
+	return s.schemaOf(reflect.TypeOf(v))
+}
+
+// Component schema registered under the type name of the value
+func (s *SchemaRegistry) Component(v interface{}) map[string]interface{} {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	s.schemaOf(t)
+	return s.Schemas[t.Name()]
+}
+
+// schemaOf map the go type to its schema
+func (s *SchemaRegistry) schemaOf(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == rawMessageType {
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structOf(t)
+		}
+		if _, ok := s.Schemas[t.Name()]; !ok {
+			//placeholder first, the type may refer to itself
+			s.Schemas[t.Name()] = map[string]interface{}{}
+			s.Schemas[t.Name()] = s.structOf(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	//interface and the rest, any value
+	return map[string]interface{}{}
+}
+
+// structOf object schema of the struct, embedded structs are flattened
+func (s *SchemaRegistry) structOf(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	s.fieldsOf(t, props)
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": props,
+	}
+}
+
+// fieldsOf collect the json fields of the struct
+func (s *SchemaRegistry) fieldsOf(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := tag
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name = tag[:idx]
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			s.fieldsOf(ft, props)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		props[name] = s.schemaOf(field.Type)
+	}
+}
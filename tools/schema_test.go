@@ -0,0 +1,100 @@
+package tools_test
+
+import (
+	"encoding/json"
+
+	"github.com/bayugyug/building-custom-api/tools"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type schemaBase struct {
+	ID string `json:"id"`
+}
+
+type schemaNode struct {
+	schemaBase
+	Name     string          `json:"name,omitempty"`
+	Count    int             `json:"count"`
+	Total    int64           `json:"total"`
+	Ratio    float64         `json:"ratio"`
+	Active   *bool           `json:"active"`
+	Tags     []string        `json:"tags"`
+	Labels   map[string]int  `json:"labels"`
+	Raw      json.RawMessage `json:"raw"`
+	Any      interface{}     `json:"any"`
+	Children []*schemaNode   `json:"children"`
+	Inline   struct{ X int } `json:"inline"`
+	Hidden   string          `json:"-"`
+	Plain    string
+	private  string
+}
+
+var _ = Describe("REST Building API Service::SCHEMA", func() {
+
+	Context("Go types", func() {
+
+		It("should map the scalar and container types", func() {
+			reg := tools.NewSchemaRegistry()
+			for _, tc := range []struct {
+				name string
+				v    interface{}
+				want map[string]interface{}
+			}{
+				{"bool", true, map[string]interface{}{"type": "boolean"}},
+				{"int", 1, map[string]interface{}{"type": "integer", "format": "int32"}},
+				{"uint8", uint8(1), map[string]interface{}{"type": "integer", "format": "int32"}},
+				{"int64", int64(1), map[string]interface{}{"type": "integer", "format": "int64"}},
+				{"float", 1.5, map[string]interface{}{"type": "number"}},
+				{"string pointer", new(string), map[string]interface{}{"type": "string"}},
+				{"slice", []int64{}, map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "integer", "format": "int64"}}},
+				{"map", map[string]bool{}, map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "boolean"}}},
+				{"raw message", json.RawMessage(`{}`), map[string]interface{}{}},
+				{"nil", nil, map[string]interface{}{}},
+			} {
+				Expect(reg.Ref(tc.v)).To(Equal(tc.want), tc.name)
+			}
+			Expect(reg.Schemas).To(BeEmpty())
+			By("Scalar types ok")
+		})
+	})
+
+	Context("Structs", func() {
+
+		It("should register the named struct as a component", func() {
+			reg := tools.NewSchemaRegistry()
+			ref := map[string]interface{}{"$ref": "#/components/schemas/schemaNode"}
+			Expect(reg.Ref(&schemaNode{})).To(Equal(ref))
+			Expect(reg.Ref([]schemaNode{})).To(Equal(map[string]interface{}{"type": "array", "items": ref}))
+			Expect(reg.Schemas).To(HaveLen(1))
+			By("Reference ok")
+
+			props := reg.Component(schemaNode{})["properties"].(map[string]interface{})
+			for _, tc := range []struct {
+				field string
+				want  interface{}
+			}{
+				{"id", map[string]interface{}{"type": "string"}},
+				{"name", map[string]interface{}{"type": "string"}},
+				{"count", map[string]interface{}{"type": "integer", "format": "int32"}},
+				{"total", map[string]interface{}{"type": "integer", "format": "int64"}},
+				{"ratio", map[string]interface{}{"type": "number"}},
+				{"active", map[string]interface{}{"type": "boolean"}},
+				{"tags", map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}},
+				{"labels", map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "integer", "format": "int32"}}},
+				{"raw", map[string]interface{}{}},
+				{"any", map[string]interface{}{}},
+				{"children", map[string]interface{}{"type": "array", "items": ref}},
+				{"inline", map[string]interface{}{"type": "object", "properties": map[string]interface{}{
+					"X": map[string]interface{}{"type": "integer", "format": "int32"}}}},
+				{"Plain", map[string]interface{}{"type": "string"}},
+			} {
+				Expect(props).To(HaveKeyWithValue(tc.field, tc.want), tc.field)
+			}
+			Expect(props).To(HaveLen(13))
+			Expect(reg.Schemas).NotTo(HaveKey("schemaBase"))
+			By("Component fields ok")
+		})
+	})
+})
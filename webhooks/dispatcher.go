@@ -0,0 +1,545 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/models"
+	"github.com/bayugyug/building-custom-api/tools"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultAttempts tries of a delivery before it goes to the dead letters
+	DefaultAttempts = 6
+	// DefaultBackoff wait before the 1st retry, doubled on each next one
+	DefaultBackoff = time.Second
+	// DefaultMaxBackoff longest wait between 2 retries
+	DefaultMaxBackoff = 5 * time.Minute
+	// DefaultWorkers deliveries sent at once
+	DefaultWorkers = 4
+	// DefaultTimeout time a receiver gets to reply
+	DefaultTimeout = 10 * time.Second
+	// DefaultLogSize attempts and dead letters kept each, the oldest are dropped past it
+	DefaultLogSize = 1000
+
+	// queueSize deliveries waiting for a worker, the change feed is not read while it is full
+	queueSize = 1024
+	userAgent = "building-api-webhooks"
+)
+
+// ErrClosed the dispatcher was shut down
+var ErrClosed = errors.New("webhooks closed")
+
+// Dispatcher the subscriptions and the deliveries of the building changes to them.
+// The subscriptions, queue and logs live in memory: they are gone after a restart.
+// The receivers are reached from inside the network, so unless AllowPrivate is set
+// the loopback, private, link-local and cluster addresses are refused.
+type Dispatcher struct {
+	Attempts     int
+	Backoff      time.Duration
+	MaxBackoff   time.Duration
+	Workers      int
+	Timeout      time.Duration
+	LogSize      int
+	AllowPrivate bool
+	Client       *tools.HTTPCurl
+	Logger       *tools.Logger
+	feed         *drivers.ChangeFeed
+	results      *tools.CounterVec
+
+	mtx     *sync.Mutex
+	wg      *sync.WaitGroup
+	order   []string
+	subs    map[string]*Subscription
+	log     []Delivery
+	dead    []DeadLetter
+	queue   chan *job
+	quit    chan struct{}
+	started bool
+	closed  bool
+}
+
+// job 1 event on its way to 1 subscription
+type job struct {
+	id      string
+	sub     string
+	event   Event
+	body    []byte
+	attempt int
+}
+
+// DispatcherSetup options settings
+type DispatcherSetup func(*Dispatcher)
+
+// WithDispatcherOptRetry opts for the tries of a delivery and the waits between them, zero keeps the default
+func WithDispatcherOptRetry(attempts int, backoff, maxBackoff time.Duration) DispatcherSetup {
+	return func(args *Dispatcher) {
+		if attempts > 0 {
+			args.Attempts = attempts
+		}
+		if backoff > 0 {
+			args.Backoff = backoff
+		}
+		if maxBackoff > 0 {
+			args.MaxBackoff = maxBackoff
+		}
+	}
+}
+
+// WithDispatcherOptWorkers opts for the deliveries sent at once
+func WithDispatcherOptWorkers(r int) DispatcherSetup {
+	return func(args *Dispatcher) {
+		if r > 0 {
+			args.Workers = r
+		}
+	}
+}
+
+// WithDispatcherOptTimeout opts for the time a receiver gets to reply, in whole seconds
+func WithDispatcherOptTimeout(r time.Duration) DispatcherSetup {
+	return func(args *Dispatcher) {
+		if r > 0 {
+			args.Timeout = r
+		}
+	}
+}
+
+// WithDispatcherOptLogSize opts for the attempts and dead letters kept
+func WithDispatcherOptLogSize(r int) DispatcherSetup {
+	return func(args *Dispatcher) {
+		if r > 0 {
+			args.LogSize = r
+		}
+	}
+}
+
+// WithDispatcherOptAllowPrivate opts for receivers on the private addresses, e.g. inside the cluster
+func WithDispatcherOptAllowPrivate(r bool) DispatcherSetup {
+	return func(args *Dispatcher) {
+		args.AllowPrivate = r
+	}
+}
+
+// WithDispatcherOptLogger opts for the logger
+func WithDispatcherOptLogger(r *tools.Logger) DispatcherSetup {
+	return func(args *Dispatcher) {
+		args.Logger = r
+	}
+}
+
+// WithDispatcherOptMetrics opts for the webhook_deliveries_total counter
+func WithDispatcherOptMetrics(r *tools.Metrics) DispatcherSetup {
+	return func(args *Dispatcher) {
+		args.results = r.Counter("webhook_deliveries_total",
+			"Webhook delivery attempts by result (ok, retry, dead).", "result")
+	}
+}
+
+// NewDispatcher new instance delivering the changes of the store, nothing runs until the 1st subscription
+func NewDispatcher(store drivers.StorageDriver, opts ...DispatcherSetup) *Dispatcher {
+	d := &Dispatcher{
+		Attempts:   DefaultAttempts,
+		Backoff:    DefaultBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		Workers:    DefaultWorkers,
+		Timeout:    DefaultTimeout,
+		LogSize:    DefaultLogSize,
+		Logger:     tools.Log,
+		feed:       drivers.Changes(store),
+		mtx:        new(sync.Mutex),
+		wg:         new(sync.WaitGroup),
+		subs:       make(map[string]*Subscription),
+		queue:      make(chan *job, queueSize),
+		quit:       make(chan struct{}),
+	}
+	//add options if any
+	for _, setter := range opts {
+		setter(d)
+	}
+	if d.Client == nil {
+		d.Client = &tools.HTTPCurl{Timeout: time.Duration(math.Ceil(d.Timeout.Seconds()))}
+		d.Client.Init()
+		if !d.AllowPrivate {
+			guard(d.Client)
+		}
+	}
+	return d
+}
+
+// Add a subscription, it gets the changes from now on; the reply is the only one showing the secret
+func (d *Dispatcher) Add(p *SubscriptionParams) (*Subscription, error) {
+	if d.feed == nil {
+		return nil, ErrNoChanges
+	}
+	if !d.AllowPrivate && privateTarget(p.URL) {
+		return nil, ErrPrivateURL
+	}
+	secret := p.Secret
+	if secret == "" {
+		var err error
+		if secret, err = newSecret(); err != nil {
+			return nil, err
+		}
+	}
+	sub := &Subscription{
+		ID:      tools.Helper{}.UUID(),
+		URL:     p.URL,
+		Events:  p.Events,
+		Secret:  secret,
+		Created: time.Now().Format(time.RFC3339),
+	}
+	// ensure
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.closed {
+		return nil, ErrClosed
+	}
+	d.subs[sub.ID] = sub
+	d.order = append(d.order, sub.ID)
+	if !d.started {
+		d.start()
+	}
+	created := *sub
+	return &created, nil
+}
+
+// Subscriptions all of them in the order they were added, without the secrets
+func (d *Dispatcher) Subscriptions() []Subscription {
+	// ensure
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	all := make([]Subscription, 0, len(d.order))
+	for _, id := range d.order {
+		sub := *d.subs[id]
+		sub.Secret = ""
+		all = append(all, sub)
+	}
+	return all
+}
+
+// Subscription 1 of them without the secret
+func (d *Dispatcher) Subscription(id string) (*Subscription, error) {
+	// ensure
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	sub, ok := d.subs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	one := *sub
+	one.Secret = ""
+	return &one, nil
+}
+
+// Remove the subscription, its pending retries are dropped
+func (d *Dispatcher) Remove(id string) error {
+	// ensure
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if _, ok := d.subs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(d.subs, id)
+	for i, sid := range d.order {
+		if sid == id {
+			d.order = append(d.order[:i], d.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Deliveries the attempts of the subscription still in the log, newest first
+func (d *Dispatcher) Deliveries(id string) ([]Delivery, error) {
+	// ensure
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if _, ok := d.subs[id]; !ok {
+		return nil, ErrNotFound
+	}
+	all := []Delivery{}
+	for i := len(d.log) - 1; i >= 0; i-- {
+		if d.log[i].Subscription == id {
+			all = append(all, d.log[i])
+		}
+	}
+	return all, nil
+}
+
+// DeadLetters the deliveries that used up their attempts, newest first
+func (d *Dispatcher) DeadLetters() []DeadLetter {
+	// ensure
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	all := make([]DeadLetter, 0, len(d.dead))
+	for i := len(d.dead) - 1; i >= 0; i-- {
+		all = append(all, d.dead[i])
+	}
+	return all
+}
+
+// Redeliver send the dead letter again with fresh attempts, its subscription must still exist.
+// The letter is kept until the delivery is queued, so a dispatcher closing meanwhile loses nothing
+func (d *Dispatcher) Redeliver(id string) error {
+	// ensure
+	d.mtx.Lock()
+	if d.closed {
+		d.mtx.Unlock()
+		return ErrClosed
+	}
+	var j *job
+	for _, dl := range d.dead {
+		if dl.ID != id {
+			continue
+		}
+		if _, ok := d.subs[dl.Subscription]; !ok {
+			break
+		}
+		body, err := json.Marshal(dl.Payload)
+		if err != nil {
+			d.mtx.Unlock()
+			return err
+		}
+		j = &job{id: dl.ID, sub: dl.Subscription, event: dl.Payload, body: body, attempt: 1}
+		break
+	}
+	d.mtx.Unlock()
+	if j == nil {
+		return ErrNotFound
+	}
+	if !d.enqueue(j) {
+		return ErrClosed
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for i, dl := range d.dead {
+		if dl.ID == id {
+			d.dead = append(d.dead[:i], d.dead[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Close stop reading the changes and wait for the deliveries in flight, the queued ones are dropped
+func (d *Dispatcher) Close(ctx context.Context) error {
+	// ensure
+	d.mtx.Lock()
+	if d.closed {
+		d.mtx.Unlock()
+		return nil
+	}
+	d.closed = true
+	close(d.quit)
+	d.mtx.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// start the change reader and the workers, caller must hold the lock
+func (d *Dispatcher) start() {
+	d.started = true
+	d.wg.Add(1 + d.Workers)
+	go d.consume(d.feed.Seq())
+	for i := 0; i < d.Workers; i++ {
+		go d.work()
+	}
+}
+
+// consume turn the changes into deliveries, resuming from the log after falling behind
+func (d *Dispatcher) consume(after uint64) {
+	defer d.wg.Done()
+	for {
+		sub, backlog, err := d.feed.Subscribe(after, 0)
+		if err != nil {
+			//left the log while the queue was full, the receivers miss them
+			d.Logger.Warn("webhook changes lost", tools.Fields{"after": after, "error": err})
+			after = d.feed.Seq()
+			continue
+		}
+		for _, change := range backlog {
+			if !d.fanout(change) {
+				sub.Close()
+				return
+			}
+			after = change.Seq
+		}
+		for live := true; live; {
+			select {
+			case <-d.quit:
+				sub.Close()
+				return
+			case change, ok := <-sub.C:
+				if !ok {
+					live = false
+					break
+				}
+				if !d.fanout(change) {
+					sub.Close()
+					return
+				}
+				after = change.Seq
+			}
+		}
+	}
+}
+
+// fanout queue the change for each subscription asking for it, false once closed
+func (d *Dispatcher) fanout(change drivers.Change) bool {
+	before, _ := change.Before.(*models.BuildingData)
+	after, _ := change.After.(*models.BuildingData)
+	ev := Event{
+		ID:     uuid.New().String(),
+		Type:   "building." + change.Type,
+		Seq:    change.Seq,
+		Time:   change.Time.UTC().Format(time.RFC3339Nano),
+		Key:    change.Key,
+		Before: before,
+		After:  after,
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		d.Logger.Error("webhook event", tools.Fields{"seq": ev.Seq, "error": err})
+		return true
+	}
+	d.mtx.Lock()
+	var targets []string
+	for _, id := range d.order {
+		if d.subs[id].wants(ev.Type) {
+			targets = append(targets, id)
+		}
+	}
+	d.mtx.Unlock()
+	for _, id := range targets {
+		if !d.enqueue(&job{id: uuid.New().String(), sub: id, event: ev, body: body, attempt: 1}) {
+			return false
+		}
+	}
+	return true
+}
+
+// enqueue wait for room in the queue, false once closed
+func (d *Dispatcher) enqueue(j *job) bool {
+	select {
+	case d.queue <- j:
+		return true
+	case <-d.quit:
+		return false
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.quit:
+			return
+		case j := <-d.queue:
+			d.deliver(j)
+		}
+	}
+}
+
+// deliver 1 attempt, a failure is retried after the backoff until the attempts are used up
+func (d *Dispatcher) deliver(j *job) {
+	d.mtx.Lock()
+	sub, ok := d.subs[j.sub]
+	var target, secret string
+	if ok {
+		target, secret = sub.URL, sub.Secret
+	}
+	d.mtx.Unlock()
+	if !ok {
+		//removed since
+		return
+	}
+
+	now := time.Now()
+	_, status, err := d.Client.Post(target, j.body, map[string]string{
+		"Content-Type":  "application/json",
+		"User-Agent":    userAgent,
+		EventHeader:     j.event.Type,
+		DeliveryHeader:  j.id,
+		TimestampHeader: strconv.FormatInt(now.Unix(), 10),
+		SignatureHeader: Sign(secret, now.Unix(), j.body),
+	})
+	rec := Delivery{
+		ID:           j.id,
+		Subscription: j.sub,
+		Event:        j.event.Type,
+		EventID:      j.event.ID,
+		Attempt:      j.attempt,
+		LatencyMS:    float64(time.Since(now)) / float64(time.Millisecond),
+		Time:         now.Format(time.RFC3339),
+	}
+	switch {
+	case err != nil:
+		rec.Error = err.Error()
+	case status < 200 || status > 299:
+		rec.Status, rec.Error = status, "receiver replied "+strconv.Itoa(status)
+	default:
+		rec.Status, rec.OK = status, true
+	}
+
+	// ensure
+	d.mtx.Lock()
+	d.log = append(d.log, rec)
+	if len(d.log) > d.LogSize {
+		d.log = d.log[len(d.log)-d.LogSize:]
+	}
+	switch {
+	case rec.OK:
+		d.count("ok")
+	case j.attempt >= d.Attempts:
+		d.count("dead")
+		d.dead = append(d.dead, DeadLetter{Delivery: rec, URL: target, Payload: j.event})
+		if len(d.dead) > d.LogSize {
+			d.dead = d.dead[len(d.dead)-d.LogSize:]
+		}
+		d.Logger.Warn("webhook dead letter", tools.Fields{"subscription": j.sub, "delivery": j.id, "error": rec.Error})
+	default:
+		d.count("retry")
+		wait := d.backoff(j.attempt)
+		j.attempt++
+		time.AfterFunc(wait, func() { d.enqueue(j) })
+	}
+	d.mtx.Unlock()
+}
+
+// backoff wait after the failed attempt, doubling up to the max
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.Backoff
+	for i := 1; i < attempt && wait < d.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.MaxBackoff {
+		wait = d.MaxBackoff
+	}
+	return wait
+}
+
+// count 1 result when the metrics are on
+func (d *Dispatcher) count(result string) {
+	if d.results != nil {
+		d.results.Inc(result)
+	}
+}
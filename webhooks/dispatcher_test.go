@@ -0,0 +1,269 @@
+package webhooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/drivers"
+	"github.com/bayugyug/building-custom-api/models"
+	"github.com/bayugyug/building-custom-api/tools"
+	"github.com/bayugyug/building-custom-api/webhooks"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// receiver httptest end-point keeping what it got, replying the next status in line then 200
+type receiver struct {
+	*httptest.Server
+	mtx      sync.Mutex
+	statuses []int
+	got      []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(statuses ...int) *receiver {
+	rc := &receiver{statuses: statuses}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		rc.mtx.Lock()
+		rc.got = append(rc.got, r)
+		rc.bodies = append(rc.bodies, body)
+		status := http.StatusOK
+		if len(rc.statuses) > 0 {
+			status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+		}
+		rc.mtx.Unlock()
+		w.WriteHeader(status)
+	}))
+	return rc
+}
+
+func (rc *receiver) count() int {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+	return len(rc.got)
+}
+
+func (rc *receiver) request(i int) (*http.Request, []byte) {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+	return rc.got[i], rc.bodies[i]
+}
+
+var _ = Describe("REST Building API Service::WEBHOOKS", func() {
+
+	var store *drivers.Storage
+	var dispatcher *webhooks.Dispatcher
+
+	BeforeEach(func() {
+		store = drivers.NewStorage()
+		dispatcher = webhooks.NewDispatcher(store,
+			webhooks.WithDispatcherOptRetry(3, 10*time.Millisecond, 20*time.Millisecond),
+			webhooks.WithDispatcherOptAllowPrivate(true),
+			webhooks.WithDispatcherOptLogger(tools.NewLogger(tools.WithLoggerOptOutput(ioutil.Discard))),
+		)
+	})
+
+	AfterEach(func() {
+		Expect(dispatcher.Close(context.Background())).To(Succeed())
+	})
+
+	subscribe := func(url string, events ...string) *webhooks.Subscription {
+		params := &webhooks.SubscriptionParams{URL: url, Events: events}
+		Expect(params.Bind(nil)).To(Succeed())
+		sub, err := dispatcher.Add(params)
+		Expect(err).NotTo(HaveOccurred())
+		return sub
+	}
+
+	save := func(id string) {
+		store.Set(id, &models.BuildingData{ID: id, Name: "building " + id})
+	}
+
+	Context("Delivery", func() {
+
+		It("should POST the signed event", func() {
+			rc := newReceiver()
+			defer rc.Close()
+			sub := subscribe(rc.URL)
+			Expect(sub.Secret).To(HaveLen(64))
+
+			save("b1")
+			Eventually(rc.count).Should(Equal(1))
+			req, body := rc.request(0)
+			Expect(req.Header.Get(webhooks.EventHeader)).To(Equal(webhooks.EventCreated))
+			Expect(req.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(webhooks.Verify(sub.Secret, req.Header, body, time.Minute)).To(BeTrue())
+			Expect(webhooks.Verify("other", req.Header, body, time.Minute)).To(BeFalse())
+
+			var ev webhooks.Event
+			Expect(json.Unmarshal(body, &ev)).To(Succeed())
+			Expect(ev.Key).To(Equal("b1"))
+			Expect(ev.Before).To(BeNil())
+			Expect(ev.After.Name).To(Equal("building b1"))
+			Expect(ev.Seq).To(Equal(uint64(1)))
+
+			Eventually(func() []webhooks.Delivery {
+				log, _ := dispatcher.Deliveries(sub.ID)
+				return log
+			}).Should(HaveLen(1))
+			log, _ := dispatcher.Deliveries(sub.ID)
+			Expect(log[0].OK).To(BeTrue())
+			Expect(log[0].Status).To(Equal(http.StatusOK))
+			Expect(log[0].ID).To(Equal(req.Header.Get(webhooks.DeliveryHeader)))
+			By("Delivery ok")
+		})
+
+		It("should only send the events asked for", func() {
+			rc := newReceiver()
+			defer rc.Close()
+			subscribe(rc.URL, webhooks.EventDeleted)
+			save("b1")
+			save("b1")
+			Expect(store.Unset("b1")).To(Succeed())
+			Eventually(rc.count).Should(Equal(1))
+			Consistently(rc.count, 100*time.Millisecond).Should(Equal(1))
+			req, _ := rc.request(0)
+			Expect(req.Header.Get(webhooks.EventHeader)).To(Equal(webhooks.EventDeleted))
+			By("Filter ok")
+		})
+
+		It("should hide the secret after the create", func() {
+			sub := subscribe("http://127.0.0.1:1/hook")
+			one, err := dispatcher.Subscription(sub.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(one.Secret).To(BeEmpty())
+			Expect(dispatcher.Subscriptions()[0].Secret).To(BeEmpty())
+			Expect(dispatcher.Remove(sub.ID)).To(Succeed())
+			_, err = dispatcher.Deliveries(sub.ID)
+			Expect(err).To(Equal(webhooks.ErrNotFound))
+			By("Secret ok")
+		})
+	})
+
+	Context("Retries", func() {
+
+		It("should retry the failures with the same delivery id", func() {
+			rc := newReceiver(http.StatusInternalServerError, http.StatusBadGateway)
+			defer rc.Close()
+			sub := subscribe(rc.URL)
+			save("b1")
+			Eventually(rc.count).Should(Equal(3))
+			first, _ := rc.request(0)
+			last, _ := rc.request(2)
+			Expect(last.Header.Get(webhooks.DeliveryHeader)).To(Equal(first.Header.Get(webhooks.DeliveryHeader)))
+
+			Eventually(func() []webhooks.Delivery {
+				log, _ := dispatcher.Deliveries(sub.ID)
+				return log
+			}).Should(HaveLen(3))
+			log, _ := dispatcher.Deliveries(sub.ID)
+			Expect(log[0].OK).To(BeTrue())
+			Expect(log[0].Attempt).To(Equal(3))
+			Expect(log[2].Status).To(Equal(http.StatusInternalServerError))
+			Expect(dispatcher.DeadLetters()).To(BeEmpty())
+			By("Retry ok")
+		})
+
+		It("should keep the dead letters and send them again", func() {
+			rc := newReceiver(500, 500, 500)
+			defer rc.Close()
+			sub := subscribe(rc.URL)
+			save("b1")
+			Eventually(dispatcher.DeadLetters).Should(HaveLen(1))
+			dead := dispatcher.DeadLetters()[0]
+			Expect(dead.Subscription).To(Equal(sub.ID))
+			Expect(dead.Attempt).To(Equal(3))
+			Expect(dead.Payload.Key).To(Equal("b1"))
+			Expect(rc.count()).To(Equal(3))
+
+			Expect(dispatcher.Redeliver(dead.ID)).To(Succeed())
+			Eventually(rc.count).Should(Equal(4))
+			Expect(dispatcher.DeadLetters()).To(BeEmpty())
+			Expect(dispatcher.Redeliver(dead.ID)).To(Equal(webhooks.ErrNotFound))
+			By("Dead letter ok")
+		})
+
+		It("should keep the dead letter when closed", func() {
+			rc := newReceiver(500, 500, 500)
+			defer rc.Close()
+			subscribe(rc.URL)
+			save("b1")
+			Eventually(dispatcher.DeadLetters).Should(HaveLen(1))
+			dead := dispatcher.DeadLetters()[0]
+
+			Expect(dispatcher.Close(context.Background())).To(Succeed())
+			Expect(dispatcher.Redeliver(dead.ID)).To(Equal(webhooks.ErrClosed))
+			Expect(dispatcher.Redeliver("not-exists")).To(Equal(webhooks.ErrClosed))
+			Expect(dispatcher.DeadLetters()).To(Equal([]webhooks.DeadLetter{dead}))
+			Expect(rc.count()).To(Equal(3))
+			By("Dead letter kept ok")
+		})
+	})
+
+	Context("Subscription params", func() {
+
+		It("should refuse a bad url or event", func() {
+			Expect((&webhooks.SubscriptionParams{}).Bind(nil)).To(Equal(models.ErrMissingRequiredParameters))
+			Expect((&webhooks.SubscriptionParams{URL: "ftp://host/x"}).Bind(nil)).To(Equal(webhooks.ErrInvalidURL))
+			Expect((&webhooks.SubscriptionParams{URL: "/relative"}).Bind(nil)).To(Equal(webhooks.ErrInvalidURL))
+			Expect((&webhooks.SubscriptionParams{URL: "https://host/x", Events: []string{"building.moved"}}).Bind(nil)).
+				To(Equal(webhooks.ErrUnknownEvent))
+			params := &webhooks.SubscriptionParams{URL: " https://host/x ",
+				Events: []string{webhooks.EventCreated, webhooks.EventCreated}}
+			Expect(params.Bind(nil)).To(Succeed())
+			Expect(params.URL).To(Equal("https://host/x"))
+			Expect(params.Events).To(Equal([]string{webhooks.EventCreated}))
+			By("Params ok")
+		})
+
+		It("should refuse the private receivers unless allowed", func() {
+			other := webhooks.NewDispatcher(store)
+			defer other.Close(context.Background())
+			for _, tc := range []struct {
+				url string
+				err error
+			}{
+				{"http://127.0.0.1:8080/x", webhooks.ErrPrivateURL},
+				{"http://[::1]/x", webhooks.ErrPrivateURL},
+				{"http://localhost/x", webhooks.ErrPrivateURL},
+				{"http://api.LOCALHOST./x", webhooks.ErrPrivateURL},
+				{"http://10.0.0.5/x", webhooks.ErrPrivateURL},
+				{"http://172.16.0.1/x", webhooks.ErrPrivateURL},
+				{"http://192.168.1.1/x", webhooks.ErrPrivateURL},
+				{"http://169.254.169.254/latest/meta-data", webhooks.ErrPrivateURL},
+				{"http://100.64.0.1/x", webhooks.ErrPrivateURL},
+				{"http://[fd00::1]/x", webhooks.ErrPrivateURL},
+				{"http://[::ffff:10.0.0.1]/x", webhooks.ErrPrivateURL},
+				{"http://0.0.0.0/x", webhooks.ErrPrivateURL},
+				{"https://93.184.216.34/x", nil},
+				{"https://hooks.example.com/x", nil},
+			} {
+				_, err := other.Add(&webhooks.SubscriptionParams{URL: tc.url})
+				if tc.err == nil {
+					Expect(err).NotTo(HaveOccurred(), tc.url)
+					continue
+				}
+				Expect(err).To(Equal(tc.err), tc.url)
+			}
+			By("Private receivers refused")
+
+			_, err := dispatcher.Add(&webhooks.SubscriptionParams{URL: "http://127.0.0.1:8080/x"})
+			Expect(err).NotTo(HaveOccurred())
+			By("Private receivers allowed")
+		})
+
+		It("should need a store with a change feed", func() {
+			other := webhooks.NewDispatcher(nil)
+			_, err := other.Add(&webhooks.SubscriptionParams{URL: "https://host/x"})
+			Expect(err).To(Equal(webhooks.ErrNoChanges))
+			By("No feed ok")
+		})
+	})
+})
@@ -0,0 +1,72 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/tools"
+)
+
+var (
+	// ErrPrivateURL target is a loopback, private, link-local or cluster address
+	ErrPrivateURL = errors.New("webhook url must not reach a private, loopback or link-local address")
+
+	//shared address space, the pod and service ranges of some clusters
+	sharedNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+)
+
+// isPrivate the address is not reachable from the internet
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() ||
+		sharedNet.Contains(ip)
+}
+
+// privateTarget the url names a private address or the local host, other names are checked once resolved
+func privateTarget(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && isPrivate(ip)
+}
+
+// publicOnly dialer check of the resolved address, so a name pointing inside is refused too
+func publicOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivate(ip) {
+		return ErrPrivateURL
+	}
+	return nil
+}
+
+// guard the client only connects to public addresses
+func guard(c *tools.HTTPCurl) {
+	t, ok := c.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		return
+	}
+	t.Dial = nil
+	t.DialContext = (&net.Dialer{
+		Timeout: c.Timeout * time.Second,
+		Control: publicOnly,
+	}).DialContext
+}
@@ -0,0 +1,172 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bayugyug/building-custom-api/models"
+)
+
+// the events a subscription may ask for, none means all
+const (
+	EventCreated = "building.created"
+	EventUpdated = "building.updated"
+	EventDeleted = "building.deleted"
+)
+
+// headers of each delivery
+const (
+	// EventHeader type of the event
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader id of the delivery, the same on every retry so receivers drop the duplicates
+	DeliveryHeader = "X-Webhook-Delivery"
+	// TimestampHeader unix time of the attempt, part of the signed content
+	TimestampHeader = "X-Webhook-Timestamp"
+	// SignatureHeader "sha256=" plus the hex HMAC-SHA256 of timestamp + "." + body with the secret
+	SignatureHeader = "X-Webhook-Signature"
+
+	signaturePrefix = "sha256="
+)
+
+var (
+	// ErrInvalidURL target not an absolute http or https url
+	ErrInvalidURL = errors.New("webhook url must be an absolute http or https url")
+	// ErrUnknownEvent event filter names an event that does not exist
+	ErrUnknownEvent = errors.New("unknown webhook event")
+	// ErrNotFound no subscription or dead letter with the id
+	ErrNotFound = errors.New("webhook not found")
+	// ErrNoChanges the storage keeps no change feed to deliver from
+	ErrNoChanges = errors.New("storage has no change feed")
+
+	events = map[string]bool{EventCreated: true, EventUpdated: true, EventDeleted: true}
+)
+
+// Subscription 1 receiver of the building events, the secret is only shown on create
+type Subscription struct {
+	ID      string   `json:"id"`
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	Secret  string   `json:"secret,omitempty"`
+	Created string   `json:"created"`
+}
+
+// SubscriptionParams create parameter, a random secret is made when none is given
+type SubscriptionParams struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// Event the JSON body POSTed to the receivers, Before is null on create and After on delete
+type Event struct {
+	ID     string               `json:"id"`
+	Type   string               `json:"type"`
+	Seq    uint64               `json:"seq"`
+	Time   string               `json:"time"`
+	Key    string               `json:"building_id"`
+	Before *models.BuildingData `json:"before"`
+	After  *models.BuildingData `json:"after"`
+}
+
+// Delivery 1 attempt to hand an event to a receiver
+type Delivery struct {
+	ID           string  `json:"id"`
+	Subscription string  `json:"subscription"`
+	Event        string  `json:"event"`
+	EventID      string  `json:"event_id"`
+	Attempt      int     `json:"attempt"`
+	Status       int     `json:"status,omitempty"`
+	Error        string  `json:"error,omitempty"`
+	OK           bool    `json:"ok"`
+	LatencyMS    float64 `json:"latency_ms"`
+	Time         string  `json:"time"`
+}
+
+// DeadLetter a delivery that used up its attempts, with what was sent so it can be sent again
+type DeadLetter struct {
+	Delivery
+	URL     string `json:"url"`
+	Payload Event  `json:"payload"`
+}
+
+// Bind filter parameter
+func (p *SubscriptionParams) Bind(r *http.Request) error {
+	//sanity check
+	if p == nil {
+		return models.ErrMissingRequiredParameters
+	}
+	p.URL = strings.TrimSpace(p.URL)
+	if p.URL == "" {
+		return models.ErrMissingRequiredParameters
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	var filter []string
+	seen := make(map[string]bool)
+	for _, ev := range p.Events {
+		ev = strings.TrimSpace(ev)
+		if !events[ev] {
+			return ErrUnknownEvent
+		}
+		if !seen[ev] {
+			seen[ev] = true
+			filter = append(filter, ev)
+		}
+	}
+	p.Events = filter
+	return nil
+}
+
+// wants the subscription asked for the event
+func (s *Subscription) wants(event string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, ev := range s.Events {
+		if ev == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign the SignatureHeader value of the body sent at the unix time ts
+func Sign(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify the signature headers of a delivery, for the receivers; a timestamp further than
+// tolerance from now is refused so a captured delivery cannot be replayed later, zero skips the check
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) bool {
+	ts, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := time.Since(time.Unix(ts, 0)); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(header.Get(SignatureHeader)))
+}
+
+// newSecret random 32 bytes as hex
+func newSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}